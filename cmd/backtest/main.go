@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grafana/kost/cmd/internal/cli"
+	"github.com/grafana/kost/cmd/internal/manifests"
+	"github.com/grafana/kost/pkg/costmodel"
+	"github.com/grafana/kost/pkg/git"
+)
+
+// change is a pair of commits whose manifests differences are backtested.
+type change struct {
+	from, to string
+}
+
+func main() {
+	var repoPath, fromRef, toRef string
+	var prs, days int
+	flag.StringVar(&repoPath, "repo", ".", "The git repository holding the manifests")
+	flag.StringVar(&fromRef, "from", "", "The git ref to compare from. If empty, the last -prs merged pull requests of -to are backtested")
+	flag.StringVar(&toRef, "to", "HEAD", "The git ref to compare to")
+	flag.IntVar(&prs, "prs", 10, "The number of merged pull requests, following the first parents of -to, to backtest")
+	flag.IntVar(&days, "days", 7, "The number of days before and after each change over which the actual cost is observed")
+	shared := cli.Register(flag.CommandLine)
+	flag.Parse()
+
+	opts, err := shared.Load()
+	if err != nil {
+		fmt.Printf("Could not load configuration: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	if err := run(ctx, git.NewRepository(repoPath), fromRef, toRef, prs, time.Duration(days)*24*time.Hour, opts); err != nil {
+		fmt.Printf("Could not run: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, repo git.Repository, fromRef, toRef string, prs int, window time.Duration, opts *cli.Options) error {
+	client, err := costmodel.NewClient(opts.Client)
+	if err != nil {
+		return fmt.Errorf("could not create cost model client: %s", err)
+	}
+
+	cur, err := opts.Currency(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	changes, err := findChanges(ctx, repo, fromRef, toRef, prs)
+	if err != nil {
+		return err
+	}
+
+	b := &backtester{
+		repo:      repo,
+		client:    client,
+		querierAt: func(at time.Time) querier { return client.At(at) },
+		cache:     opts.Cache,
+		discounts: opts.Discounts,
+		window:    window,
+		costs:     make(map[string]*costmodel.CostModel),
+	}
+
+	var samples []sample
+	for _, c := range changes {
+		ss, err := b.backtest(ctx, c)
+		if err != nil {
+			return fmt.Errorf("backtesting %s..%s: %w", c.from, c.to, err)
+		}
+		samples = append(samples, ss...)
+	}
+	if b.skipped > 0 {
+		slog.Warn("skipped workloads that could not be backtested, see the errors above", "skipped", b.skipped, "samples", len(samples))
+	}
+
+	switch opts.ReportType() {
+	case "table":
+		return writeTable(os.Stdout, distributions(samples), cur)
+	case "csv":
+		return writeCSV(os.Stdout, samples, cur)
+	default:
+		return fmt.Errorf("report type %s not supported", opts.ReportType())
+	}
+}
+
+// findChanges returns the change between two refs, or the changes
+// introduced by the last merged pull requests when fromRef is empty.
+func findChanges(ctx context.Context, repo git.Repository, fromRef, toRef string, prs int) ([]change, error) {
+	if fromRef != "" {
+		from, err := repo.GetCommit(ctx, fromRef)
+		if err != nil {
+			return nil, fmt.Errorf("getting commit: %w", err)
+		}
+		to, err := repo.GetCommit(ctx, toRef)
+		if err != nil {
+			return nil, fmt.Errorf("getting commit: %w", err)
+		}
+		return []change{{from: from, to: to}}, nil
+	}
+
+	commits, err := repo.FirstParentCommits(ctx, toRef, prs)
+	if err != nil {
+		return nil, fmt.Errorf("listing merged pull requests: %w", err)
+	}
+
+	changes := make([]change, 0, len(commits))
+	for _, c := range commits {
+		parent, err := repo.GetCommit(ctx, c+"^")
+		if err != nil {
+			// The root commit has no parent to compare to.
+			continue
+		}
+		changes = append(changes, change{from: parent, to: c})
+	}
+
+	return changes, nil
+}
+
+// repository is the subset of git.Repository the changes are backtested
+// with.
+type repository interface {
+	CommitTime(ctx context.Context, ref string) (time.Time, error)
+	ChangedFiles(ctx context.Context, oldCommit, newCommit string) (git.ChangedFiles, error)
+	Contents(ctx context.Context, commit, path string) ([]byte, error)
+}
+
+// querier is the subset of *costmodel.Client the replicas and usage of
+// workloads are queried with.
+type querier interface {
+	costmodel.HPAResolver
+	GetWorkloadUsage(ctx context.Context, cluster, namespace, kind, name string, at time.Time, window time.Duration) (costmodel.WorkloadUsage, error)
+}
+
+type backtester struct {
+	repo   repository
+	client *costmodel.Client
+	// querierAt returns a querier evaluating its queries at a time, like
+	// (*costmodel.Client).At.
+	querierAt func(at time.Time) querier
+	cache     costmodel.Cache
+	discounts *costmodel.Discounts
+	window    time.Duration
+	costs     map[string]*costmodel.CostModel
+	// skipped counts the files and workloads that failed to be
+	// backtested, so that one failure doesn't abort the others.
+	skipped int
+}
+
+// costModel returns the cost model of a cluster at the prices of the
+// flags, current ones by default. The same prices are used for both the
+// prediction and the actual cost so that price changes don't count as
+// prediction errors.
+func (b *backtester) costModel(ctx context.Context, cluster string) (*costmodel.CostModel, error) {
+	if cm, ok := b.costs[cluster]; ok {
+		return cm, nil
+	}
+	cm, err := costmodel.GetCachedCostModelForCluster(ctx, b.client, b.cache, cluster)
+	if err != nil {
+		return nil, err
+	}
+	cm = b.discounts.Apply(cm)
+	b.costs[cluster] = cm
+	return cm, nil
+}
+
+// backtest compares the predicted and actual cost change of every
+// workload changed between the commits of c.
+func (b *backtester) backtest(ctx context.Context, c change) ([]sample, error) {
+	at, err := b.repo.CommitTime(ctx, c.to)
+	if err != nil {
+		return nil, fmt.Errorf("getting commit time: %w", err)
+	}
+	if at.Add(b.window).After(time.Now()) {
+		slog.Info("skipping change too recent to observe its actual cost", "commit", c.to, "time", at)
+		return nil, nil
+	}
+
+	cf, err := b.repo.ChangedFiles(ctx, c.from, c.to)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct{ old, new string }
+	var files []file
+	for _, f := range cf.Added {
+		files = append(files, file{new: f})
+	}
+	for _, f := range cf.Deleted {
+		files = append(files, file{old: f})
+	}
+	for _, f := range cf.Modified {
+		files = append(files, file{old: f, new: f})
+	}
+	for o, n := range cf.Renamed {
+		files = append(files, file{old: o, new: n})
+	}
+
+	var samples []sample
+	for _, f := range files {
+		path := f.new
+		if path == "" {
+			path = f.old
+		}
+		cluster := manifests.Cluster(path)
+		if cluster == "" {
+			continue
+		}
+
+		cm, err := b.costModel(ctx, cluster)
+		if err != nil {
+			slog.Error("getting cost model", "cluster", cluster, "error", err)
+			continue
+		}
+
+		pairs, err := b.pairs(ctx, c, f.old, f.new, cm)
+		if err != nil {
+			slog.Error("skipping file", "commit", c.to, "path", path, "error", err)
+			b.skipped++
+			continue
+		}
+		for _, p := range pairs {
+			s, err := b.sample(ctx, c.to, at, cm, p)
+			if err != nil {
+				slog.Error("skipping workload", "commit", c.to, "path", path, "error", err)
+				b.skipped++
+				continue
+			}
+			samples = append(samples, s)
+		}
+	}
+
+	return samples, nil
+}
+
+// pairs parses the workloads of a file before and after the change.
+func (b *backtester) pairs(ctx context.Context, c change, oldPath, newPath string, cm *costmodel.CostModel) ([]costmodel.RequirementsPair, error) {
+	from, err := b.parse(ctx, c.from, oldPath, cm)
+	if err != nil {
+		return nil, err
+	}
+	to, err := b.parse(ctx, c.to, newPath, cm)
+	if err != nil {
+		return nil, err
+	}
+	return costmodel.PairRequirements(from, to)
+}
+
+func (b *backtester) parse(ctx context.Context, commit, path string, cm *costmodel.CostModel) ([]costmodel.Requirements, error) {
+	if path == "" {
+		return nil, nil
+	}
+	src, err := b.repo.Contents(ctx, commit, path)
+	if err != nil {
+		return nil, fmt.Errorf("checking %s:%s contents: %w", commit, path, err)
+	}
+	return costmodel.ParseManifests(src, cm)
+}
+
+// sample computes the predicted cost change of a workload the same way
+// the bot does, and the actual change observed over the windows before and
+// after the change was committed.
+func (b *backtester) sample(ctx context.Context, commit string, at time.Time, cm *costmodel.CostModel, p costmodel.RequirementsPair) (sample, error) {
+	id := p.To
+	if id.Kind == "" {
+		id = p.From
+	}
+
+	// Replicas are resolved as the bot would have when the change was
+	// committed, on each side so that replica changes of the manifests
+	// count.
+	q := b.querierAt(at)
+	for _, req := range []*costmodel.Requirements{&p.From, &p.To} {
+		if req.Kind != "Deployment" && req.Kind != "StatefulSet" {
+			continue
+		}
+		replicas, _, err := costmodel.ResolveReplicas(ctx, q, cm.Cluster.Name, req.Namespace, req.Kind, req.Name, req.Replicas)
+		if errors.Is(err, costmodel.ErrNoResults) {
+			continue
+		} else if err != nil {
+			return sample{}, fmt.Errorf("resolving replicas for %s: %w", req.Key(), err)
+		}
+		req.Replicas = replicas
+	}
+
+	predicted := cm.TotalCostForPeriod(costmodel.Monthly, p.To) - cm.TotalCostForPeriod(costmodel.Monthly, p.From)
+
+	before, err := q.GetWorkloadUsage(ctx, cm.Cluster.Name, id.Namespace, id.Kind, id.Name, at, b.window)
+	if err != nil {
+		return sample{}, fmt.Errorf("getting usage of %s before change: %w", id.Key(), err)
+	}
+	after, err := q.GetWorkloadUsage(ctx, cm.Cluster.Name, id.Namespace, id.Kind, id.Name, at.Add(b.window), b.window)
+	if err != nil {
+		return sample{}, fmt.Errorf("getting usage of %s after change: %w", id.Key(), err)
+	}
+
+	return sample{
+		Commit:    commit,
+		Cluster:   cm.Cluster.Name,
+		Kind:      id.Kind,
+		Namespace: id.Namespace,
+		Name:      id.Name,
+		Predicted: predicted,
+		Actual:    cm.UsageCostForPeriod(costmodel.Monthly, after) - cm.UsageCostForPeriod(costmodel.Monthly, before),
+	}, nil
+}
+
+func writeTable(w io.Writer, ds []distribution, cur costmodel.Currency) error {
+	tw := tabwriter.NewWriter(w, 8, 6, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Cluster\tKind\tSamples\tBias\tMean |Error|\tMedian |Error|\tP90 |Error|"); err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", d.Cluster, d.Kind, d.Samples, cur.Format(d.Bias), cur.Format(d.MeanAbsError), cur.Format(d.MedianAbsError), cur.Format(d.P90AbsError)); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, samples []sample, cur costmodel.Currency) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"commit", "cluster", "namespace", "kind", "name", "predicted_monthly_delta", "actual_monthly_delta", "error"}); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		row := []string{
+			s.Commit, s.Cluster, s.Namespace, s.Kind, s.Name,
+			strconv.FormatFloat(cur.Convert(s.Predicted), 'f', 2, 64),
+			strconv.FormatFloat(cur.Convert(s.Actual), 'f', 2, 64),
+			strconv.FormatFloat(cur.Convert(s.Error()), 'f', 2, 64),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/kost/pkg/costmodel"
+	"github.com/grafana/kost/pkg/git"
+)
+
+// fakeRepo is a repository of a change between the commits old and new.
+type fakeRepo struct {
+	at      time.Time
+	changed git.ChangedFiles
+	// files are the contents of the files by commit:path.
+	files map[string]string
+}
+
+func (r fakeRepo) CommitTime(_ context.Context, _ string) (time.Time, error) {
+	return r.at, nil
+}
+
+func (r fakeRepo) ChangedFiles(_ context.Context, _, _ string) (git.ChangedFiles, error) {
+	return r.changed, nil
+}
+
+func (r fakeRepo) Contents(_ context.Context, commit, path string) ([]byte, error) {
+	src, ok := r.files[commit+":"+path]
+	if !ok {
+		return nil, fmt.Errorf("no file %s at %s", path, commit)
+	}
+	return []byte(src), nil
+}
+
+// fakeQuerier returns the observed replicas of an HPA, if any, and the
+// CPU requested by the workload before and after the time of the change.
+type fakeQuerier struct {
+	at               time.Time
+	hpa              string
+	observed         float64
+	before, after    float64
+	queriedReplicaAt *time.Time
+}
+
+func (q fakeQuerier) HPATargeting(_ context.Context, _, _, _, _ string) (string, error) {
+	return q.hpa, nil
+}
+
+func (q fakeQuerier) GetObservedReplicas(_ context.Context, _, _, _, _ string) (float64, error) {
+	*q.queriedReplicaAt = q.at
+	return q.observed, nil
+}
+
+func (q fakeQuerier) GetWorkloadUsage(_ context.Context, _, _, _, _ string, at time.Time, _ time.Duration) (costmodel.WorkloadUsage, error) {
+	if at.After(q.at) {
+		return costmodel.WorkloadUsage{CPURequests: q.after}, nil
+	}
+	return costmodel.WorkloadUsage{CPURequests: q.before}, nil
+}
+
+func TestBacktester_Backtest(t *testing.T) {
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: wk, namespace: ns}
+spec:
+  replicas: %d
+  template:
+    spec:
+      containers:
+      - name: app
+        resources: {requests: {cpu: "1"}}
+`
+	path := "flux/prod/ns/Deployment-wk.yaml"
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := fakeRepo{
+		at:      at,
+		changed: git.ChangedFiles{Modified: []string{path}},
+		files: map[string]string{
+			"old:" + path: fmt.Sprintf(deployment, 1),
+			"new:" + path: fmt.Sprintf(deployment, 3),
+		},
+	}
+
+	tests := map[string]struct {
+		hpa               string
+		predicted, actual float64
+	}{
+		// The replicas of the manifests, 1 then 3, each costing $720.
+		"manifest replicas": {predicted: 1440, actual: 1440},
+		// The HPA keeps 2 replicas whatever the manifests say.
+		"observed replicas": {hpa: "wk", predicted: 0, actual: 1440},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var queriedAt time.Time
+			b := &backtester{
+				repo: repo,
+				querierAt: func(at time.Time) querier {
+					return fakeQuerier{at: at, hpa: tt.hpa, observed: 2, before: 1, after: 3, queriedReplicaAt: &queriedAt}
+				},
+				window: 7 * 24 * time.Hour,
+				costs: map[string]*costmodel.CostModel{
+					"prod": {Cluster: &costmodel.Cluster{Name: "prod"}, CPU: costmodel.Cost{NonSpot: 1}},
+				},
+			}
+
+			samples, err := b.backtest(context.Background(), change{from: "old", to: "new"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.skipped != 0 {
+				t.Errorf("expecting no skipped workloads, got %d", b.skipped)
+			}
+			if len(samples) != 1 {
+				t.Fatalf("expecting 1 sample, got %d", len(samples))
+			}
+			s := samples[0]
+			if s.Commit != "new" || s.Cluster != "prod" || s.Kind != "Deployment" || s.Namespace != "ns" || s.Name != "wk" {
+				t.Errorf("expecting the sample of prod/ns/Deployment/wk at new, got %+v", s)
+			}
+			if s.Predicted != tt.predicted {
+				t.Errorf("expecting a predicted delta of %v, got %v", tt.predicted, s.Predicted)
+			}
+			if s.Actual != tt.actual {
+				t.Errorf("expecting an actual delta of %v, got %v", tt.actual, s.Actual)
+			}
+			if tt.hpa != "" && !queriedAt.Equal(at) {
+				t.Errorf("expecting replicas observed at %s, got %s", at, queriedAt)
+			}
+		})
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	var s strings.Builder
+	ds := []distribution{{Cluster: "prod", Kind: "Deployment", Samples: 2, Bias: -10, MeanAbsError: 20, MedianAbsError: 20, P90AbsError: 28}}
+	if err := writeTable(&s, ds, costmodel.Currency{Code: "EUR", Rate: 0.5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(s.String(), "-€5.00  €10.00") || strings.Contains(s.String(), "$") {
+		t.Errorf("expecting the errors in euros, got:\n%s", s.String())
+	}
+}
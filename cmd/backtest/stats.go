@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// sample compares the predicted and actual change in monthly cost of a
+// workload after a change was merged.
+type sample struct {
+	Commit    string
+	Cluster   string
+	Kind      string
+	Namespace string
+	Name      string
+	Predicted float64
+	Actual    float64
+}
+
+// Error is the amount by which the prediction overestimated the actual
+// change. It is negative when the change was underestimated.
+func (s sample) Error() float64 {
+	return s.Predicted - s.Actual
+}
+
+// distribution summarizes the prediction errors of a group of samples.
+type distribution struct {
+	Cluster string
+	Kind    string
+	Samples int
+	// Bias is the mean error; a positive bias means kost
+	// overestimates changes.
+	Bias float64
+	// MeanAbsError, MedianAbsError and P90AbsError are computed on
+	// the absolute errors, in dollars per month.
+	MeanAbsError   float64
+	MedianAbsError float64
+	P90AbsError    float64
+}
+
+// allGroup is used as the cluster and kind of the distribution across all samples.
+const allGroup = "*"
+
+// distributions groups samples by cluster and kind and returns the error
+// distribution of each group, followed by the distribution of each kind
+// across clusters and the one across all samples.
+func distributions(samples []sample) []distribution {
+	type key struct{ cluster, kind string }
+
+	groups := make(map[key][]float64)
+	for _, s := range samples {
+		for _, k := range []key{{s.Cluster, s.Kind}, {allGroup, s.Kind}, {allGroup, allGroup}} {
+			groups[k] = append(groups[k], s.Error())
+		}
+	}
+
+	keys := make([]key, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		// Aggregated groups go last.
+		if (keys[i].cluster == allGroup) != (keys[j].cluster == allGroup) {
+			return keys[j].cluster == allGroup
+		}
+		if (keys[i].kind == allGroup) != (keys[j].kind == allGroup) {
+			return keys[j].kind == allGroup
+		}
+		if keys[i].cluster != keys[j].cluster {
+			return keys[i].cluster < keys[j].cluster
+		}
+		return keys[i].kind < keys[j].kind
+	})
+
+	out := make([]distribution, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, newDistribution(k.cluster, k.kind, groups[k]))
+	}
+
+	return out
+}
+
+func newDistribution(cluster, kind string, errs []float64) distribution {
+	d := distribution{Cluster: cluster, Kind: kind, Samples: len(errs)}
+	if len(errs) == 0 {
+		return d
+	}
+
+	abs := make([]float64, 0, len(errs))
+	for _, e := range errs {
+		d.Bias += e
+		abs = append(abs, math.Abs(e))
+		d.MeanAbsError += math.Abs(e)
+	}
+	d.Bias /= float64(len(errs))
+	d.MeanAbsError /= float64(len(errs))
+
+	sort.Float64s(abs)
+	d.MedianAbsError = percentile(abs, 0.5)
+	d.P90AbsError = percentile(abs, 0.9)
+
+	return d
+}
+
+// percentile returns the p-th percentile of sorted values using linear
+// interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lo, hi := math.Floor(rank), math.Ceil(rank)
+	return sorted[int(lo)] + (sorted[int(hi)]-sorted[int(lo)])*(rank-lo)
+}
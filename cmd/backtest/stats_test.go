@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistributions(t *testing.T) {
+	samples := []sample{
+		{Cluster: "a", Kind: "Deployment", Predicted: 100, Actual: 90},
+		{Cluster: "a", Kind: "Deployment", Predicted: 100, Actual: 130},
+		{Cluster: "a", Kind: "StatefulSet", Predicted: 50, Actual: 50},
+		{Cluster: "b", Kind: "Deployment", Predicted: 0, Actual: 20},
+	}
+
+	got := distributions(samples)
+
+	exp := []distribution{
+		{Cluster: "a", Kind: "Deployment", Samples: 2, Bias: -10, MeanAbsError: 20, MedianAbsError: 20, P90AbsError: 28},
+		{Cluster: "a", Kind: "StatefulSet", Samples: 1},
+		{Cluster: "b", Kind: "Deployment", Samples: 1, Bias: -20, MeanAbsError: 20, MedianAbsError: 20, P90AbsError: 20},
+		{Cluster: allGroup, Kind: "Deployment", Samples: 3, Bias: -40.0 / 3, MeanAbsError: 20, MedianAbsError: 20, P90AbsError: 28},
+		{Cluster: allGroup, Kind: "StatefulSet", Samples: 1},
+		{Cluster: allGroup, Kind: allGroup, Samples: 4, Bias: -10, MeanAbsError: 15, MedianAbsError: 15, P90AbsError: 27},
+	}
+
+	if e, g := len(exp), len(got); e != g {
+		t.Fatalf("expecting %d distributions, got %d: %+v", e, g, got)
+	}
+
+	eq := func(a, b float64) bool { return math.Abs(a-b) < 0.001 }
+	for i, e := range exp {
+		g := got[i]
+		if e.Cluster != g.Cluster || e.Kind != g.Kind || e.Samples != g.Samples ||
+			!eq(e.Bias, g.Bias) || !eq(e.MeanAbsError, g.MeanAbsError) ||
+			!eq(e.MedianAbsError, g.MedianAbsError) || !eq(e.P90AbsError, g.P90AbsError) {
+			t.Errorf("expecting distribution %+v at index %d, got %+v", e, i, g)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		values []float64
+		p      float64
+		exp    float64
+	}{
+		{nil, 0.5, 0},
+		{[]float64{1}, 0.9, 1},
+		{[]float64{1, 2, 3, 4}, 0.5, 2.5},
+		{[]float64{0, 10}, 0.9, 9},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); got != tt.exp {
+			t.Errorf("expecting percentile %v of %v to be %v, got %v", tt.p, tt.values, tt.exp, got)
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/common/model"
 
+	"github.com/grafana/kost/pkg/costmodel"
 	"github.com/grafana/kost/pkg/github"
 )
 
@@ -17,6 +20,30 @@ type promConfig struct {
 	Username             string `envconfig:"MIMIR_USER_ID"`
 	Password             string `envconfig:"MIMIR_USER_PASSWORD"`
 	MaxConcurrentQueries int    `envconfig:"MAX_CONCURRENT_QUERIES" default:"-1"` // -1 means unlimited
+	// QueryTimeout bounds each query, including its retries.
+	QueryTimeout time.Duration `envconfig:"PROMETHEUS_QUERY_TIMEOUT" default:"1m"`
+	// MaxRetries is how many times a query failing with a 5xx or 429 status is retried.
+	MaxRetries int `envconfig:"PROMETHEUS_MAX_RETRIES" default:"3"`
+	// AllowPartial reports costs of clusters whose cost model is partially
+	// missing, instead of leaving them out of the comment.
+	AllowPartial bool `envconfig:"PROMETHEUS_ALLOW_PARTIAL"`
+	// Clusters and ClusterRegex route clusters to the datasource, when
+	// using PROMETHEUS_DATASOURCES.
+	Clusters     []string `envconfig:"PROMETHEUS_CLUSTERS"`
+	ClusterRegex string   `envconfig:"PROMETHEUS_CLUSTER_REGEX"`
+}
+
+// clientConfig returns the cost model client configuration.
+func (c promConfig) clientConfig() *costmodel.ClientConfig {
+	return &costmodel.ClientConfig{
+		Address:        c.Address,
+		HTTPConfigFile: c.HTTPConfigFile,
+		Username:       c.Username,
+		Password:       c.Password,
+		QueryTimeout:   c.QueryTimeout,
+		MaxRetries:     c.MaxRetries,
+		AllowPartial:   c.AllowPartial,
+	}
 }
 
 type config struct {
@@ -27,6 +54,124 @@ type config struct {
 
 	Prometheus struct {
 		Prod, Dev promConfig
+
+		// Datasources are the names of the datasources to query, each
+		// configured by the variables prefixed with its name, e.g.
+		// OPS_PROMETHEUS_ADDRESS for ops. If empty, dev- clusters are
+		// queried from the DEV_ prefixed datasource and the others from
+		// the unprefixed one. The lowest MAX_CONCURRENT_QUERIES of the
+		// datasources limits how many cost models are fetched at once.
+		Datasources []string `envconfig:"PROMETHEUS_DATASOURCES"`
+		// DefaultDatasource is queried for the clusters that aren't routed
+		// to any datasource. Defaults to the first datasource.
+		DefaultDatasource string `envconfig:"PROMETHEUS_DEFAULT_DATASOURCE"`
+		// ClusterMappingFile is a YAML file mapping cluster names to
+		// datasource names.
+		ClusterMappingFile string `envconfig:"PROMETHEUS_CLUSTER_MAPPING_FILE"`
+
+		// PriceWindow averages prices over a window, e.g. 30d, so that
+		// price spikes don't swing estimates.
+		PriceWindow model.Duration `envconfig:"PROMETHEUS_PRICE_WINDOW"`
+		// PriceTime evaluates prices at a given RFC 3339 time instead of now.
+		PriceTime time.Time `envconfig:"PROMETHEUS_PRICE_TIME"`
+
+		named []namedPromConfig
+	}
+
+	Cache struct {
+		// Dir is where cost models are cached between runs. Caching is
+		// disabled if empty.
+		Dir string        `envconfig:"COST_CACHE_DIR"`
+		TTL time.Duration `envconfig:"COST_CACHE_TTL" default:"24h"`
+	}
+
+	Discounts struct {
+		// File is a YAML file of the discounts applied to list prices.
+		File string `envconfig:"DISCOUNTS_FILE"`
+		// ListPrices reports the monthly cost at list prices next to
+		// the effective cost.
+		ListPrices bool `envconfig:"REPORT_LIST_PRICES"`
+	}
+
+	Carbon struct {
+		// File is a YAML file of the grid carbon intensity of each region
+		// and power coefficients of each instance family. The carbon
+		// footprint isn't reported if empty.
+		File string `envconfig:"CARBON_FILE"`
+	}
+
+	Egress struct {
+		// File is a YAML file of the egress price of each cluster. The
+		// egress cost isn't estimated if empty.
+		File string `envconfig:"EGRESS_PRICES_FILE"`
+	}
+
+	Observability struct {
+		// File is a YAML file of the signals ingested for each pod and
+		// their price. The observability cost isn't estimated if empty.
+		File string `envconfig:"OBSERVABILITY_FILE"`
+	}
+
+	Backups struct {
+		// File is a YAML file of the backup policies snapshotting
+		// persistent volumes, overriding those of the changed manifests.
+		// Only the backups of the changed manifests and the backup
+		// annotations of workloads apply if empty.
+		File string `envconfig:"BACKUPS_FILE"`
+	}
+
+	Report struct {
+		// Periods are the periods costs are reported for, the last one
+		// in the comment, e.g. monthly or 2160h for a quarter.
+		Periods string `envconfig:"REPORT_PERIODS" default:"weekly,monthly"`
+		// TemplateFile is the markdown template of the comment, replacing
+		// the embedded one or some of its templates.
+		TemplateFile string `envconfig:"REPORT_TEMPLATE_FILE"`
+		// Efficiency compares the requests of the modified workloads
+		// with their p95 usage over the last 7 days.
+		Efficiency bool `envconfig:"REPORT_EFFICIENCY"`
+		// Scenarios reports the cost at limits and with the Guaranteed QoS
+		// class next to the cost at requests.
+		Scenarios bool `envconfig:"REPORT_SCENARIOS"`
+		// BinPacking reports the cost bin-packed onto the most common node
+		// shape of each cluster next to the linear cost.
+		BinPacking bool `envconfig:"REPORT_BIN_PACKING"`
+		// NodePools predicts how many nodes the changes make the cluster
+		// autoscaler add to or remove from each node pool.
+		NodePools bool `envconfig:"REPORT_NODE_POOLS"`
+		// Assumptions reports the unit prices, node count and replica
+		// sources of each cluster the costs are computed from.
+		Assumptions bool `envconfig:"REPORT_ASSUMPTIONS"`
+		// Ranges reports the range of the costs given the spread of the
+		// prices across instance types and of the observed replicas.
+		Ranges bool `envconfig:"REPORT_RANGES"`
+	}
+
+	Currency struct {
+		// Code is the ISO 4217 code of the currency costs are reported in.
+		Code string `envconfig:"CURRENCY" default:"USD"`
+		// RatesFile maps currency codes to the amount of the currency a US
+		// dollar buys.
+		RatesFile string `envconfig:"CURRENCY_RATES_FILE"`
+		// RateMetric is the Prometheus metric holding the amount of each
+		// currency a US dollar buys, queried if the rates file doesn't
+		// have the currency.
+		RateMetric string `envconfig:"CURRENCY_RATE_METRIC"`
+	}
+
+	Teams struct {
+		// Keys are the workload labels or annotations holding the owning team.
+		Keys []string `envconfig:"TEAM_KEYS" default:"team"`
+		// CodeOwners is the path of the CODEOWNERS file, relative to the manifests repository.
+		CodeOwners string `envconfig:"TEAM_CODEOWNERS_PATH"`
+		// NamespacesFile maps namespaces to the owning team.
+		NamespacesFile string `envconfig:"TEAM_NAMESPACES_FILE"`
+		// Threshold is the increase in monthly cost, in dollars, above which
+		// the owning team is notified. Zero disables notifications.
+		Threshold float64 `envconfig:"TEAM_NOTIFY_THRESHOLD"`
+		// RequestReview requests a review from the owning team instead of
+		// mentioning it in the comment.
+		RequestReview bool `envconfig:"TEAM_REQUEST_REVIEW"`
 	}
 
 	GitHub github.Config
@@ -47,6 +192,13 @@ func parseConfig() (config, error) {
 	if err := envconfig.Process("DEV", &c.Prometheus.Dev); err != nil {
 		return c, fmt.Errorf("parsing envconfig for Prometheus dev: %w", err)
 	}
+	for _, name := range c.Prometheus.Datasources {
+		var pc promConfig
+		if err := envconfig.Process(envPrefix(name), &pc); err != nil {
+			return c, fmt.Errorf("parsing envconfig for Prometheus datasource %s: %w", name, err)
+		}
+		c.Prometheus.named = append(c.Prometheus.named, namedPromConfig{name: name, promConfig: pc})
+	}
 	return c, nil
 }
 
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/kost/pkg/costmodel"
+)
+
+// namedPromConfig is the configuration of a datasource listed in
+// PROMETHEUS_DATASOURCES.
+type namedPromConfig struct {
+	name string
+	promConfig
+}
+
+// envPrefix returns the prefix of the environment variables configuring
+// the named datasource.
+func envPrefix(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// newClients creates the registry of the configured datasources.
+func newClients(cfg config) (*costmodel.Clients, error) {
+	var (
+		clients *costmodel.Clients
+		err     error
+	)
+	if len(cfg.Prometheus.named) == 0 {
+		clients, err = costmodel.NewClients(cfg.clientConfig(cfg.Prometheus.Prod), cfg.clientConfig(cfg.Prometheus.Dev))
+	} else {
+		clients, err = costmodel.NewDatasourceClients(cfg.defaultDatasource(), cfg.datasourceConfigs()...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Prometheus.ClusterMappingFile != "" {
+		mapping, err := costmodel.LoadClusterMapping(cfg.Prometheus.ClusterMappingFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := clients.MapClusters(mapping); err != nil {
+			return nil, fmt.Errorf("mapping clusters: %w", err)
+		}
+	}
+
+	return clients, nil
+}
+
+// maxConcurrentQueries returns how many cost models are fetched at once:
+// the lowest limit of the queried datasources, since the clusters of a
+// pull request may all be routed to the same one, or -1 if none of them
+// is limited.
+func (c config) maxConcurrentQueries() int {
+	datasources := []promConfig{c.Prometheus.Prod, c.Prometheus.Dev}
+	if len(c.Prometheus.named) > 0 {
+		datasources = datasources[:0]
+		for _, n := range c.Prometheus.named {
+			datasources = append(datasources, n.promConfig)
+		}
+	}
+
+	limit := -1
+	for _, p := range datasources {
+		if p.MaxConcurrentQueries >= 0 && (limit < 0 || p.MaxConcurrentQueries < limit) {
+			limit = p.MaxConcurrentQueries
+		}
+	}
+	return limit
+}
+
+func (c config) datasourceConfigs() []costmodel.DatasourceConfig {
+	configs := make([]costmodel.DatasourceConfig, 0, len(c.Prometheus.named))
+	for _, n := range c.Prometheus.named {
+		configs = append(configs, costmodel.DatasourceConfig{
+			Name:     n.name,
+			Client:   c.clientConfig(n.promConfig),
+			Clusters: n.Clusters,
+			Match:    n.ClusterRegex,
+		})
+	}
+	return configs
+}
+
+// clientConfig returns the client configuration of a datasource, with
+// the settings shared by all datasources.
+func (c config) clientConfig(p promConfig) *costmodel.ClientConfig {
+	cc := p.clientConfig()
+	cc.PriceWindow = time.Duration(c.Prometheus.PriceWindow)
+	cc.PriceTime = c.Prometheus.PriceTime
+	return cc
+}
+
+func (c config) defaultDatasource() string {
+	if c.Prometheus.DefaultDatasource != "" || len(c.Prometheus.named) == 0 {
+		return c.Prometheus.DefaultDatasource
+	}
+	return c.Prometheus.named[0].name
+}
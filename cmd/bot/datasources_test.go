@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewClients(t *testing.T) {
+	t.Setenv("KUBE_MANIFESTS_PATH", t.TempDir())
+	t.Setenv("GITHUB_PULL_REQUEST", "1")
+
+	t.Run("prod and dev", func(t *testing.T) {
+		cfg, err := parseConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		clients, err := newClients(cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for cluster, want := range map[string]string{"dev-us-central-0": "dev", "prod-us-central-0": "prod"} {
+			if ds, err := clients.Route(cluster); err != nil || ds.Name != want {
+				t.Errorf("expecting %s to be routed to %s, got %v (%v)", cluster, want, ds, err)
+			}
+		}
+	})
+
+	t.Run("named datasources", func(t *testing.T) {
+		mapping := filepath.Join(t.TempDir(), "mapping.yaml")
+		if err := os.WriteFile(mapping, []byte("prod-us-central-0: ops\n"), 0o644); err != nil {
+			t.Fatalf("writing mapping: %v", err)
+		}
+
+		t.Setenv("PROMETHEUS_DATASOURCES", "prod-eu,ops")
+		t.Setenv("PROMETHEUS_CLUSTER_MAPPING_FILE", mapping)
+		t.Setenv("PROD_EU_PROMETHEUS_ADDRESS", "http://eu")
+		t.Setenv("PROD_EU_PROMETHEUS_CLUSTER_REGEX", "-eu-")
+		t.Setenv("OPS_PROMETHEUS_ADDRESS", "http://ops")
+		t.Setenv("OPS_PROMETHEUS_CLUSTERS", "ops-0,ops-1")
+		t.Setenv("OPS_PROMETHEUS_MAX_RETRIES", "5")
+		t.Setenv("PROMETHEUS_PRICE_WINDOW", "30d")
+
+		cfg, err := parseConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := cfg.Prometheus.named[1].MaxRetries; got != 5 {
+			t.Errorf("expecting ops datasource to have 5 retries, got %d", got)
+		}
+		if got := cfg.clientConfig(cfg.Prometheus.named[0].promConfig).PriceWindow; got != 30*24*time.Hour {
+			t.Errorf("expecting prices to be averaged over 30d, got %s", got)
+		}
+
+		clients, err := newClients(cfg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for cluster, want := range map[string]string{
+			"prod-eu-west-0":    "prod-eu",
+			"ops-1":             "ops",
+			"prod-us-central-0": "ops",
+			"dev-us-central-0":  "prod-eu", // default is the first datasource
+		} {
+			if ds, err := clients.Route(cluster); err != nil || ds.Name != want {
+				t.Errorf("expecting %s to be routed to %s, got %v (%v)", cluster, want, ds, err)
+			}
+		}
+	})
+}
+
+func TestConfig_MaxConcurrentQueries(t *testing.T) {
+	tests := map[string]struct {
+		prod, dev int
+		named     []int
+		exp       int
+	}{
+		"unlimited":               {prod: -1, dev: -1, exp: -1},
+		"prod and dev":            {prod: 8, dev: 4, exp: 4},
+		"named datasources":       {prod: 2, dev: -1, named: []int{-1, 6, 3}, exp: 3},
+		"unlimited named sources": {prod: 2, dev: 2, named: []int{-1, -1}, exp: -1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cfg config
+			cfg.Prometheus.Prod.MaxConcurrentQueries = tt.prod
+			cfg.Prometheus.Dev.MaxConcurrentQueries = tt.dev
+			for _, n := range tt.named {
+				cfg.Prometheus.named = append(cfg.Prometheus.named, namedPromConfig{promConfig: promConfig{MaxConcurrentQueries: n}})
+			}
+			if got := cfg.maxConcurrentQueries(); got != tt.exp {
+				t.Errorf("expecting a limit of %d, got %d", tt.exp, got)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -14,10 +15,12 @@ import (
 
 	"golang.org/x/sync/errgroup"
 
+	"github.com/grafana/kost/cmd/internal/manifests"
 	"github.com/grafana/kost/pkg/costmodel"
 
 	"github.com/grafana/kost/pkg/git"
 	"github.com/grafana/kost/pkg/github"
+	"github.com/grafana/kost/pkg/owners"
 )
 
 //go:embed comment.md
@@ -54,23 +57,53 @@ func realMain(ctx context.Context) error {
 		return fmt.Errorf("validating configuration: %w", err)
 	}
 
-	prometheusClients, err := costmodel.NewClients(
-		&costmodel.ClientConfig{
-			Address:        cfg.Prometheus.Prod.Address,
-			HTTPConfigFile: cfg.Prometheus.Prod.HTTPConfigFile,
-			Username:       cfg.Prometheus.Prod.Username,
-			Password:       cfg.Prometheus.Prod.Password,
-		},
-		&costmodel.ClientConfig{
-			Address:        cfg.Prometheus.Dev.Address,
-			HTTPConfigFile: cfg.Prometheus.Dev.HTTPConfigFile,
-			Username:       cfg.Prometheus.Dev.Username,
-			Password:       cfg.Prometheus.Dev.Password,
-		})
+	prometheusClients, err := newClients(cfg)
 	if err != nil {
 		return fmt.Errorf("creating cost model client: %w", err)
 	}
 
+	if cfg.Cache.Dir != "" {
+		prometheusClients.Cache, err = costmodel.NewFileCache(cfg.Cache.Dir, cfg.Cache.TTL)
+		if err != nil {
+			return fmt.Errorf("creating cost model cache: %w", err)
+		}
+	}
+
+	if cfg.Discounts.File != "" {
+		prometheusClients.Discounts, err = costmodel.LoadDiscounts(cfg.Discounts.File)
+		if err != nil {
+			return fmt.Errorf("loading discounts: %w", err)
+		}
+	}
+
+	var carbon *costmodel.Carbon
+	if cfg.Carbon.File != "" {
+		if carbon, err = costmodel.LoadCarbon(cfg.Carbon.File); err != nil {
+			return fmt.Errorf("loading carbon configuration: %w", err)
+		}
+	}
+
+	var egress *costmodel.EgressPrices
+	if cfg.Egress.File != "" {
+		if egress, err = costmodel.LoadEgressPrices(cfg.Egress.File); err != nil {
+			return fmt.Errorf("loading egress prices: %w", err)
+		}
+	}
+
+	var observability *costmodel.Observability
+	if cfg.Observability.File != "" {
+		if observability, err = costmodel.LoadObservability(cfg.Observability.File); err != nil {
+			return fmt.Errorf("loading observability configuration: %w", err)
+		}
+	}
+
+	var backups *costmodel.Backups
+	if cfg.Backups.File != "" {
+		if backups, err = costmodel.LoadBackups(cfg.Backups.File); err != nil {
+			return fmt.Errorf("loading backup policies: %w", err)
+		}
+	}
+
 	repo := git.NewRepository(cfg.Manifests.RepoPath)
 
 	oldCommit, err := repo.GetCommit(ctx, "HEAD^")
@@ -88,9 +121,42 @@ func realMain(ctx context.Context) error {
 		return err
 	}
 
+	teams, err := newTeamResolver(ctx, cfg, repo, newCommit)
+	if err != nil {
+		return fmt.Errorf("creating team resolver: %w", err)
+	}
+
+	currency, err := costmodel.CurrencyConfig(cfg.Currency).Currency(ctx, prometheusClients)
+	if err != nil {
+		return fmt.Errorf("getting currency: %w", err)
+	}
+
+	reporterOpts := []costmodel.Option{costmodel.WithCurrency(currency)}
+	if cfg.Discounts.ListPrices {
+		reporterOpts = append(reporterOpts, costmodel.WithListPrices())
+	}
+	periods, err := costmodel.ParsePeriods(cfg.Report.Periods)
+	if err != nil {
+		return fmt.Errorf("parsing report periods: %w", err)
+	}
+	reporterOpts = append(reporterOpts, costmodel.WithPeriods(periods...))
+	if cfg.Report.Scenarios {
+		reporterOpts = append(reporterOpts, costmodel.WithScenarios())
+	}
+	if cfg.Report.Assumptions {
+		reporterOpts = append(reporterOpts, costmodel.WithAssumptions())
+	}
+	if cfg.Report.TemplateFile != "" {
+		t, err := costmodel.LoadTemplate(cfg.Report.TemplateFile)
+		if err != nil {
+			return fmt.Errorf("loading comment template: %w", err)
+		}
+		reporterOpts = append(reporterOpts, costmodel.WithTemplate(t))
+	}
+
 	var (
 		comment  strings.Builder
-		reporter = costmodel.New(&comment, "markdown")
+		reporter = costmodel.New(&comment, "markdown", reporterOpts...)
 	)
 
 	costPerCluster := make(map[string]*costmodel.CostModel)
@@ -99,7 +165,7 @@ func realMain(ctx context.Context) error {
 
 	clusters := findClusters(cf)
 	g := &errgroup.Group{}
-	g.SetLimit(cfg.Prometheus.Prod.MaxConcurrentQueries)
+	g.SetLimit(cfg.maxConcurrentQueries())
 	for _, cluster := range clusters {
 		mu.RLock()
 		_, ok := costPerCluster[cluster]
@@ -111,8 +177,9 @@ func realMain(ctx context.Context) error {
 				cost, err := prometheusClients.GetClusterCosts(ctx, cluster)
 				mu.Lock()
 				if err != nil {
-					// TODO here we should probably return an error like below
 					warnings = append(warnings, fmt.Errorf("fetching cost model for cluster %s: %w", cluster, err))
+					// Explain in the comment why the cluster is left out.
+					reporter.AddCostModelError(cluster, err)
 				}
 				costPerCluster[cluster] = cost
 				mu.Unlock()
@@ -134,7 +201,7 @@ func realMain(ctx context.Context) error {
 			return nil, req, fmt.Errorf("checking %s:%s contents: %w", commit, path, err)
 		}
 
-		cm := costPerCluster[findCluster(path)]
+		cm := costPerCluster[manifests.Cluster(path)]
 		if cm == nil {
 			slog.Error("no cost model found for path", "path", path)
 			return nil, req, ErrNoClustersFound
@@ -143,6 +210,7 @@ func realMain(ctx context.Context) error {
 		if err != nil {
 			return nil, req, fmt.Errorf("parsing manifest %s:%s: %w", commit, path, err)
 		}
+		req.Team = teams.Team(path, req)
 
 		return cm, req, nil
 	}
@@ -222,6 +290,52 @@ func realMain(ctx context.Context) error {
 	}
 	slog.Info("Finished processing renamed files", "count", len(cf.Renamed), "duration", time.Since(start))
 
+	if cfg.Report.Efficiency {
+		start = time.Now()
+		reporter.AddUsage(ctx, prometheusClients)
+		slog.Info("Finished querying usage", "duration", time.Since(start))
+	}
+
+	if cfg.Report.BinPacking {
+		start = time.Now()
+		reporter.AddNodeShapes(ctx, prometheusClients)
+		slog.Info("Finished querying node shapes", "duration", time.Since(start))
+	}
+
+	if cfg.Report.NodePools {
+		start = time.Now()
+		reporter.AddNodePools(ctx, prometheusClients)
+		slog.Info("Finished querying node pools", "duration", time.Since(start))
+	}
+
+	if cfg.Report.Ranges {
+		start = time.Now()
+		reporter.AddRanges(ctx, prometheusClients)
+		slog.Info("Finished querying price and replica ranges", "duration", time.Since(start))
+	}
+
+	if carbon != nil {
+		start = time.Now()
+		reporter.AddCarbon(ctx, carbon, prometheusClients)
+		slog.Info("Finished estimating the carbon footprint", "duration", time.Since(start))
+	}
+
+	if egress != nil {
+		start = time.Now()
+		reporter.AddEgress(ctx, egress, prometheusClients)
+		slog.Info("Finished querying traffic", "duration", time.Since(start))
+	}
+
+	if observability != nil {
+		start = time.Now()
+		reporter.AddObservability(ctx, observability, prometheusClients)
+		slog.Info("Finished querying observability signals", "duration", time.Since(start))
+	}
+
+	// The backups configuration overrides those of the manifests.
+	fromBackups, toBackups := changedBackups(ctx, repo, cf, oldCommit, newCommit)
+	reporter.AddBackups(costmodel.MergeBackups(backups, fromBackups), costmodel.MergeBackups(backups, toBackups))
+
 	if err := reporter.Write(); errors.Is(err, costmodel.ErrNoReports) {
 		return nil
 	} else if err != nil {
@@ -229,6 +343,11 @@ func realMain(ctx context.Context) error {
 	}
 	slog.Info("Finished", "method", "cost-model:write-report", "duration", time.Since(start))
 
+	notifyTeams := teamsAboveThreshold(reporter.TeamDeltas(), cfg.Teams.Threshold)
+	if len(notifyTeams) > 0 && !cfg.Teams.RequestReview {
+		comment.WriteString(teamsMention(cfg.GitHub.Owner, notifyTeams, cfg.Teams.Threshold))
+	}
+
 	gh, err := github.NewClient(ctx, cfg.GitHub)
 	if err != nil {
 		return fmt.Errorf("creating GitHub client: %w", err)
@@ -248,6 +367,15 @@ func realMain(ctx context.Context) error {
 	}
 	slog.Info("Finished", "method", "GitHub:comment", "duration", time.Since(start))
 
+	if len(notifyTeams) > 0 && cfg.Teams.RequestReview {
+		start = time.Now()
+		users, teams := owners.Reviewers(notifyTeams)
+		if err := gh.RequestReviews(ctx, cfg.GitHub.Owner, cfg.GitHub.Repo, cfg.PR, users, teams); err != nil {
+			warnings = append(warnings, fmt.Errorf("requesting review from teams %v: %w", notifyTeams, err))
+		}
+		slog.Info("Finished", "method", "GitHub:request-reviews", "duration", time.Since(start))
+	}
+
 	if len(warnings) > 0 {
 		fmt.Fprintln(os.Stderr, "WARNINGS:")
 		for _, w := range warnings {
@@ -258,13 +386,45 @@ func realMain(ctx context.Context) error {
 	return nil
 }
 
-func findCluster(path string) string {
-	ps := strings.SplitN(path, "/", 3)
-	// Prevent panic if the path is not in the expected format
-	if len(ps) <= 1 {
-		return ""
+// contentsReader reads the contents of a file at a commit.
+type contentsReader interface {
+	Contents(ctx context.Context, commit, path string) ([]byte, error)
+}
+
+// changedBackups returns the backup policies set up by the changed files
+// at the old and the new commit, each in the cluster of its file. Files
+// outside of the manifests of a cluster are skipped, and those that can't
+// be read or parsed are logged and skipped.
+func changedBackups(ctx context.Context, repo contentsReader, cf git.ChangedFiles, oldCommit, newCommit string) (from, to *costmodel.Backups) {
+	parse := func(commit string, paths []string) *costmodel.Backups {
+		var bs []*costmodel.Backups
+		for _, path := range paths {
+			cluster := manifests.Cluster(path)
+			if cluster == "" {
+				continue
+			}
+			src, err := repo.Contents(ctx, commit, path)
+			if err != nil {
+				slog.Error("reading backups", "commit", commit, "path", path, "error", err)
+				continue
+			}
+			b, err := costmodel.ParseBackups(src)
+			if err != nil {
+				slog.Error("parsing backups", "commit", commit, "path", path, "error", err)
+				continue
+			}
+			bs = append(bs, b.InCluster(cluster))
+		}
+		return costmodel.MergeBackups(bs...)
+	}
+
+	oldPaths := append(slices.Clone(cf.Deleted), cf.Modified...)
+	newPaths := append(slices.Clone(cf.Added), cf.Modified...)
+	for o, n := range cf.Renamed {
+		oldPaths = append(oldPaths, o)
+		newPaths = append(newPaths, n)
 	}
-	return ps[1]
+	return parse(oldCommit, oldPaths), parse(newCommit, newPaths)
 }
 
 func findClusters(cf git.ChangedFiles) []string {
@@ -281,8 +441,8 @@ func findClusters(cf git.ChangedFiles) []string {
 
 	for _, f := range fs {
 		// TODO find a better way to find the clusters
-		if strings.HasPrefix(f, "flux/") || strings.HasPrefix(f, "flux-disabled/") {
-			cs[findCluster(f)] = struct{}{}
+		if c := manifests.Cluster(f); c != "" {
+			cs[c] = struct{}{}
 		}
 	}
 
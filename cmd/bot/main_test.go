@@ -1,26 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
 	"github.com/grafana/kost/pkg/git"
 )
 
-func TestFindCluster(t *testing.T) {
-	tests := map[string]string{
-		"flux/ops-us-east-0/exporters/Deployment-gcp-compute-exporter-grafanalabs-dev.yaml":          "ops-us-east-0",
-		"flux/dev-us-central-0/default/StatefulSet-prometheus.yaml":                                  "dev-us-central-0",
-		"flux/prod-us-central-0/default/StatefulSet-prometheus.yaml":                                 "prod-us-central-0",
-		"flux-disabled/ops-us-east-0/ctank-migrations/StatefulSet-cassandra-chunk-extractor-us.yaml": "ops-us-east-0",
-	}
-
-	for f, exp := range tests {
-		if got := findCluster(f); exp != got {
-			t.Errorf("expecting cluster %s for file %s, got %s", exp, f, got)
-		}
-	}
-}
-
 func TestFindClusters(t *testing.T) {
 	cf := git.ChangedFiles{
 		Added: []string{
@@ -53,3 +40,74 @@ func TestFindClusters(t *testing.T) {
 		}
 	}
 }
+
+type fakeRepo map[string]string
+
+func (r fakeRepo) Contents(_ context.Context, commit, path string) ([]byte, error) {
+	src, ok := r[commit+":"+path]
+	if !ok {
+		return nil, fmt.Errorf("no file %s at %s", path, commit)
+	}
+	return []byte(src), nil
+}
+
+func TestChangedBackups(t *testing.T) {
+	schedule := `apiVersion: velero.io/v1
+kind: Schedule
+metadata: {name: daily, namespace: velero}
+spec:
+  schedule: 0 1 * * *
+  template:
+    includedNamespaces: [db]
+    ttl: %s
+`
+	path := "flux/prod-us-central-0/velero/Schedule-daily.yaml"
+	repo := fakeRepo{
+		"old:" + path: fmt.Sprintf(schedule, "168h0m0s"),
+		"new:" + path: fmt.Sprintf(schedule, "336h0m0s"),
+		"new:flux/prod-us-central-0/db/StatefulSet-wk.yaml": "apiVersion: apps/v1\nkind: StatefulSet\nmetadata: {name: wk}\n",
+	}
+	cf := git.ChangedFiles{
+		Added:    []string{"flux/prod-us-central-0/db/StatefulSet-wk.yaml", "flux/prod-us-central-0/db/missing.yaml"},
+		Modified: []string{path},
+	}
+
+	from, to := changedBackups(context.Background(), repo, cf, "old", "new")
+	if len(from.Policies) != 1 || len(to.Policies) != 1 {
+		t.Fatalf("expecting one policy at each commit, got %+v and %+v", from.Policies, to.Policies)
+	}
+	if p := from.Policies[0]; p.Retention != 7 || p.Cluster != "prod-us-central-0" || p.Namespace != "db" {
+		t.Errorf("expecting the daily policy of prod-us-central-0 keeping 7 backups, got %+v", p)
+	}
+	if p := to.Policies[0]; p.Retention != 14 || p.Cluster != "prod-us-central-0" {
+		t.Errorf("expecting the daily policy of prod-us-central-0 keeping 14 backups, got %+v", p)
+	}
+}
+
+func TestTeamsAboveThreshold(t *testing.T) {
+	deltas := map[string]float64{
+		"mimir":    500,
+		"loki":     99,
+		"platform": -1000,
+		"tempo":    101,
+	}
+
+	if got := teamsAboveThreshold(deltas, 0); got != nil {
+		t.Errorf("expecting no teams when threshold is disabled, got %v", got)
+	}
+
+	exp := []string{"mimir", "tempo"}
+	got := teamsAboveThreshold(deltas, 100)
+	if e, g := len(exp), len(got); e != g {
+		t.Fatalf("expecting %d teams, got %d", e, g)
+	}
+	for i, e := range exp {
+		if g := got[i]; e != g {
+			t.Errorf("expecting team %s at index %d, got %s", e, i, g)
+		}
+	}
+
+	if e, g := "\ncc @grafana/mimir, @grafana/tempo: the monthly cost of your workloads increases by more than $100.00.\n", teamsMention("grafana", got, 100); e != g {
+		t.Errorf("expecting mention %q, got %q", e, g)
+	}
+}
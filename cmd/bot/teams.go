@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/kost/pkg/git"
+	"github.com/grafana/kost/pkg/owners"
+)
+
+// newTeamResolver builds the owners resolver from the configuration. The
+// CODEOWNERS file is read from the manifests repository at the given
+// commit, so changes to it in the pull request are taken into account.
+func newTeamResolver(ctx context.Context, cfg config, repo git.Repository, commit string) (owners.Resolver, error) {
+	r := owners.Resolver{Keys: cfg.Teams.Keys}
+
+	if cfg.Teams.CodeOwners != "" {
+		src, err := repo.Contents(ctx, commit, cfg.Teams.CodeOwners)
+		if err != nil {
+			return r, fmt.Errorf("reading CODEOWNERS: %w", err)
+		}
+		r.CodeOwners, err = owners.ParseCodeOwners(bytes.NewReader(src))
+		if err != nil {
+			return r, err
+		}
+	}
+
+	if cfg.Teams.NamespacesFile != "" {
+		ns, err := owners.LoadNamespaces(cfg.Teams.NamespacesFile)
+		if err != nil {
+			return r, err
+		}
+		r.Namespaces = ns
+	}
+
+	return r, nil
+}
+
+// teamsAboveThreshold returns the teams whose monthly cost increases by
+// more than threshold dollars, sorted by name.
+func teamsAboveThreshold(deltas map[string]float64, threshold float64) []string {
+	if threshold <= 0 {
+		return nil
+	}
+
+	var teams []string
+	for t, d := range deltas {
+		if d > threshold {
+			teams = append(teams, t)
+		}
+	}
+	sort.Strings(teams)
+
+	return teams
+}
+
+// teamsMention returns a comment footer mentioning the given teams.
+func teamsMention(org string, teams []string, threshold float64) string {
+	ms := make([]string, 0, len(teams))
+	for _, t := range teams {
+		ms = append(ms, owners.Mention(org, t))
+	}
+	return fmt.Sprintf("\ncc %s: the monthly cost of your workloads increases by more than $%.2f.\n", strings.Join(ms, ", "), threshold)
+}
@@ -2,74 +2,262 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/grafana/kost/cmd/internal/cli"
 	"github.com/grafana/kost/pkg/costmodel"
+	"github.com/grafana/kost/pkg/helm"
+	"github.com/grafana/kost/pkg/kustomize"
 )
 
+// options are the estimators of a run: those shared with the inventory,
+// and those of changes only.
+type options struct {
+	*cli.Options
+	Egress     *costmodel.EgressPrices
+	Efficiency bool
+	NodePools  bool
+	Ranges     bool
+}
+
 func main() {
-	var fromFile, toFile, prometheusAddress, httpConfigFile, reportType, username, password string
+	var fromFile, toFile string
+	var kustomizeFrom, kustomizeTo, kustomizeDir, gitFrom, gitTo string
+	var helmChart, helmChartFrom, helmChartTo, helmValues, helmValuesFrom, helmValuesTo, helmRelease, helmNamespace string
+	var egressFile string
+	var opts options
 	flag.StringVar(&fromFile, "from", "", "The file to compare from")
-	flag.StringVar(&toFile, "to", "", "The file to compare to")
-	flag.StringVar(&prometheusAddress, "prometheus.address", "http://localhost:9093/prometheus", "The Address of the prometheus server")
-	flag.StringVar(&httpConfigFile, "http.config.file", "", "The path to the http config file")
-	flag.StringVar(&username, "username", "", "Mimir username")
-	flag.StringVar(&password, "password", "", "Mimir password")
-	flag.StringVar(&reportType, "report.type", "table", "The type of report to generate. Options are: table, summary")
+	flag.StringVar(&toFile, "to", "", "The file to compare to. If empty, the cost of the from file is reported")
+	flag.StringVar(&kustomizeFrom, "kustomize.from", "", "The kustomize overlay directory to compare from")
+	flag.StringVar(&kustomizeTo, "kustomize.to", "", "The kustomize overlay directory to compare to")
+	flag.StringVar(&kustomizeDir, "kustomize.dir", "", "The kustomize overlay directory to compare between -git.from and -git.to")
+	flag.StringVar(&gitFrom, "git.from", "HEAD^", "The git ref to compare from when using -kustomize.dir")
+	flag.StringVar(&gitTo, "git.to", "HEAD", "The git ref to compare to when using -kustomize.dir")
+	flag.StringVar(&helmChart, "helm.chart", "", "The Helm chart to template with -helm.values.from and -helm.values.to")
+	flag.StringVar(&helmValuesFrom, "helm.values.from", "", "Comma separated list of values files to template the chart to compare from with, after -helm.values")
+	flag.StringVar(&helmValuesTo, "helm.values.to", "", "Comma separated list of values files to template the chart to compare to with, after -helm.values")
+	flag.StringVar(&helmChartFrom, "helm.chart.from", "", "The Helm chart version, as a directory or archive, to compare from")
+	flag.StringVar(&helmChartTo, "helm.chart.to", "", "The Helm chart version, as a directory or archive, to compare to")
+	flag.StringVar(&helmValues, "helm.values", "", "Comma separated list of values files to template both charts with")
+	flag.StringVar(&helmRelease, "helm.release", "", "The Helm release name, defaults to the chart name")
+	flag.StringVar(&helmNamespace, "helm.namespace", "default", "The namespace the Helm release is installed to")
+	flag.StringVar(&egressFile, "egress.file", "", "The YAML file of the egress price of each cluster, to estimate the egress cost of workloads whose replicas change from their current traffic")
+	flag.BoolVar(&opts.Efficiency, "report.efficiency", false, "Compare the requests of the modified workloads with their p95 usage over the last 7 days, flagging over-provisioned ones")
+	flag.BoolVar(&opts.NodePools, "report.node-pools", false, "Predict how many nodes the change makes the cluster autoscaler add to or remove from each node pool")
+	flag.BoolVar(&opts.Ranges, "report.ranges", false, "Report the range of the costs given the spread of the prices across instance types and of the observed replicas")
+	shared := cli.Register(flag.CommandLine)
 	flag.Parse()
 
+	var err error
+	if opts.Options, err = shared.Load(); err != nil {
+		fmt.Printf("Could not load configuration: %s\n", err)
+		os.Exit(1)
+	}
+	if egressFile != "" {
+		if opts.Egress, err = costmodel.LoadEgressPrices(egressFile); err != nil {
+			fmt.Printf("Could not load egress prices: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	clusters := flag.Args()
 
 	ctx := context.Background()
-	if err := run(ctx, fromFile, toFile, prometheusAddress, httpConfigFile, reportType, username, password, clusters); err != nil {
+
+	var from, to []byte
+	switch {
+	case helmChart != "" || helmChartFrom != "" || helmChartTo != "":
+		from, to, err = templateHelmCharts(helmChart, helmChartFrom, helmChartTo, splitList(helmValues), splitList(helmValuesFrom), splitList(helmValuesTo), helm.Options{
+			ReleaseName: helmRelease,
+			Namespace:   helmNamespace,
+		})
+	case kustomizeDir != "":
+		from, to, clusters, err = buildKustomizeAtRefs(ctx, kustomizeDir, gitFrom, gitTo, clusters)
+	case kustomizeFrom != "" || kustomizeTo != "":
+		from, to, clusters, err = buildKustomizeOverlays(kustomizeFrom, kustomizeTo, clusters)
+	default:
+		from, to, err = readFiles(fromFile, toFile)
+	}
+	if err != nil {
+		fmt.Printf("Could not read manifests: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := run(ctx, from, to, clusters, opts); err != nil {
 		fmt.Printf("Could not run: %s\n", err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, fromFile, toFile, address, httpConfigFile, reportType, username, password string, clusters []string) error {
+func readFiles(fromFile, toFile string) ([]byte, []byte, error) {
 	from, err := os.ReadFile(fromFile)
 	if err != nil {
-		return fmt.Errorf("could not read file: %s", err)
+		return nil, nil, fmt.Errorf("could not read file: %s", err)
+	}
+
+	// If the to file is not set, report the cost of the current
+	// configuration as a change to itself.
+	if toFile == "" {
+		return from, from, nil
 	}
 
-	// TODO: If the to file is not set, we should default to printing out the cost of the current configuration
 	to, err := os.ReadFile(toFile)
 	if err != nil {
-		return fmt.Errorf("could not read file: %s", err)
+		return nil, nil, fmt.Errorf("could not read file: %s", err)
+	}
+
+	return from, to, nil
+}
+
+// buildKustomizeOverlays renders two overlay directories. If no clusters
+// are given, the cluster is taken from the name of the overlays, which must
+// target the same cluster since both sides are priced in it.
+func buildKustomizeOverlays(fromDir, toDir string, clusters []string) ([]byte, []byte, []string, error) {
+	if fromDir == "" || toDir == "" {
+		return nil, nil, nil, errors.New("both -kustomize.from and -kustomize.to must be set")
+	}
+	fromCluster, toCluster := kustomize.ClusterFromPath(fromDir), kustomize.ClusterFromPath(toDir)
+	if len(clusters) == 0 && fromCluster != toCluster {
+		return nil, nil, nil, fmt.Errorf("the overlays target different clusters, %s and %s: give the cluster to price both in", fromCluster, toCluster)
+	}
+
+	from, err := kustomize.Build(fromDir)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	client, err := costmodel.NewClient(&costmodel.ClientConfig{
-		Address:        address,
-		HTTPConfigFile: httpConfigFile,
-		Username:       username,
-		Password:       password,
-	})
+	to, err := kustomize.Build(toDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
+	if len(clusters) == 0 {
+		clusters = []string{toCluster}
+	}
+
+	return from, to, clusters, nil
+}
+
+// buildKustomizeAtRefs renders the same overlay directory at two git refs.
+// If no clusters are given, the cluster is taken from the overlay name.
+func buildKustomizeAtRefs(ctx context.Context, dir, fromRef, toRef string, clusters []string) ([]byte, []byte, []string, error) {
+	from, err := kustomize.BuildAtRef(ctx, dir, fromRef)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	to, err := kustomize.BuildAtRef(ctx, dir, toRef)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(clusters) == 0 {
+		clusters = []string{kustomize.ClusterFromPath(dir)}
+	}
+
+	return from, to, clusters, nil
+}
+
+// templateHelmCharts renders a chart, or two versions of it, with the
+// shared values files followed by those of each side.
+func templateHelmCharts(chart, fromChart, toChart string, values, fromValues, toValues []string, opts helm.Options) ([]byte, []byte, error) {
+	switch {
+	case chart != "" && (fromChart != "" || toChart != ""):
+		return nil, nil, errors.New("-helm.chart can't be set with -helm.chart.from or -helm.chart.to")
+	case chart != "":
+		fromChart, toChart = chart, chart
+	case fromChart == "" || toChart == "":
+		return nil, nil, errors.New("both -helm.chart.from and -helm.chart.to must be set")
+	}
+
+	opts.ValuesFiles = append(slices.Clone(values), fromValues...)
+	from, err := helm.Template(fromChart, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts.ValuesFiles = append(slices.Clone(values), toValues...)
+	to, err := helm.Template(toChart, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return from, to, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func run(ctx context.Context, from, to []byte, clusters []string, opts options) error {
+	client, err := costmodel.NewClient(opts.Client)
 	if err != nil {
 		return fmt.Errorf("could not create cost model client: %s", err)
 	}
 
-	reporter := costmodel.New(os.Stdout, reportType)
+	reporter, err := opts.NewReporter(ctx, os.Stdout, client)
+	if err != nil {
+		return err
+	}
 
 	for _, cluster := range clusters {
-		cost, err := costmodel.GetCostModelForCluster(ctx, client, cluster)
+		cost, err := costmodel.GetCachedCostModelForCluster(ctx, client, opts.Cache, cluster)
 		if err != nil {
 			return fmt.Errorf("could not get costmodel for cluster(%s): %s", cluster, err)
 		}
+		cost = opts.Discounts.Apply(cost)
+
+		fromRequests, err := costmodel.ParseManifests(from, cost)
+		if err != nil {
+			return fmt.Errorf("could not parse from manifests: %s", err)
+		}
 
-		fromRequests, err := costmodel.ParseManifest(from, cost)
+		toRequests, err := costmodel.ParseManifests(to, cost)
 		if err != nil {
-			return fmt.Errorf("could not parse manifest file(%s): %s", fromFile, err)
+			return fmt.Errorf("could not parse to manifests: %s", err)
 		}
 
-		toRequests, err := costmodel.ParseManifest(to, cost)
+		pairs, err := costmodel.PairRequirements(fromRequests, toRequests)
 		if err != nil {
-			return fmt.Errorf("could not parse manifest file(%s): %s", toFile, err)
+			return fmt.Errorf("could not pair manifests: %s", err)
 		}
-		reporter.AddReportWithResolvedReplicas(ctx, client, cost, fromRequests, toRequests)
+		for _, p := range pairs {
+			reporter.AddReportWithResolvedReplicas(ctx, client, cost, p.From, p.To)
+		}
+	}
+
+	if opts.Efficiency {
+		reporter.AddUsage(ctx, client)
+	}
+	if opts.BinPacking {
+		reporter.AddNodeShapes(ctx, client)
+	}
+	reporter.AddCarbon(ctx, opts.Carbon, client)
+	reporter.AddEgress(ctx, opts.Egress, client)
+	reporter.AddObservability(ctx, opts.Observability, client)
+	// The backups configuration overrides those of the manifests.
+	fromBackups, err := costmodel.ParseBackups(from)
+	if err != nil {
+		return fmt.Errorf("could not parse backups of from manifests: %s", err)
+	}
+	toBackups, err := costmodel.ParseBackups(to)
+	if err != nil {
+		return fmt.Errorf("could not parse backups of to manifests: %s", err)
+	}
+	reporter.AddBackups(costmodel.MergeBackups(opts.Backups, fromBackups), costmodel.MergeBackups(opts.Backups, toBackups))
+	if opts.NodePools {
+		reporter.AddNodePools(ctx, client)
+	}
+	if opts.Ranges {
+		reporter.AddRanges(ctx, client)
 	}
 
 	return reporter.Write()
@@ -0,0 +1,179 @@
+// Package cli holds the flags shared by the estimator, inventory and
+// backtest commands, and the estimators and reporter options they load.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/kost/pkg/costmodel"
+)
+
+// Flags are the flags of the Prometheus client, the cost model cache, the
+// prices, the estimators and the report.
+type Flags struct {
+	client       costmodel.ClientConfig
+	priceWindow  model.Duration
+	currency     costmodel.CurrencyConfig
+	reportType   string
+	reporterOpts []costmodel.Option
+
+	cacheDir, discountsFile, carbonFile, observabilityFile, backupsFile string
+	cacheTTL                                                            time.Duration
+
+	listPrices, scenarios, assumptions, binPacking bool
+}
+
+// Register registers the flags on fs.
+func Register(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	fs.StringVar(&f.client.Address, "prometheus.address", "http://localhost:9093/prometheus", "The Address of the prometheus server")
+	fs.StringVar(&f.client.HTTPConfigFile, "http.config.file", "", "The path to the http config file")
+	fs.StringVar(&f.client.Username, "username", "", "Mimir username")
+	fs.StringVar(&f.client.Password, "password", "", "Mimir password")
+	fs.DurationVar(&f.client.QueryTimeout, "prometheus.timeout", time.Minute, "The timeout of each Prometheus query, including retries. Zero disables it")
+	fs.IntVar(&f.client.MaxRetries, "prometheus.retries", 3, "How many times a Prometheus query failing with a 5xx or 429 status is retried")
+	fs.BoolVar(&f.client.AllowPartial, "prometheus.partial", false, "Report costs with the parts of a cost model that couldn't be queried counting as $0, instead of failing")
+	fs.Var(&f.priceWindow, "prices.window", "Average prices over this window, e.g. 30d, to smooth out spikes. Zero uses instant prices")
+	fs.Func("prices.time", "Evaluate prices at this RFC 3339 time, e.g. 2024-01-01T00:00:00Z, instead of now", func(s string) (err error) {
+		f.client.PriceTime, err = time.Parse(time.RFC3339, s)
+		return err
+	})
+	fs.StringVar(&f.cacheDir, "cache.dir", "", "The directory to cache cost models in between runs. Caching is disabled if empty")
+	fs.DurationVar(&f.cacheTTL, "cache.ttl", 24*time.Hour, "How long cached cost models are used for")
+	fs.StringVar(&f.discountsFile, "discounts.file", "", "The YAML file of the discounts to apply to list prices")
+	fs.StringVar(&f.carbonFile, "carbon.file", "", "The YAML file of the grid carbon intensity of each region and power coefficients of each instance family, to report the carbon footprint")
+	fs.StringVar(&f.observabilityFile, "observability.file", "", "The YAML file of the signals ingested for each pod and their price, to estimate the observability cost of workloads from their current signals")
+	fs.StringVar(&f.backupsFile, "backups.file", "", "The YAML file of the backup policies snapshotting persistent volumes, overriding the Velero Schedules and VolumeSnapshots of the manifests, to report the cost of the snapshots")
+	fs.BoolVar(&f.listPrices, "report.list-prices", false, "Report the monthly cost at list prices next to the effective cost")
+	fs.BoolVar(&f.scenarios, "report.scenarios", false, "Report the cost at limits and with the Guaranteed QoS class next to the cost at requests")
+	fs.BoolVar(&f.assumptions, "report.assumptions", false, "Report the unit prices, node count and replica sources of each cluster the costs are computed from")
+	fs.BoolVar(&f.binPacking, "report.bin-packing", false, "Report the cost bin-packed onto the most common node shape of the node pool of each workload next to the linear cost")
+	fs.StringVar(&f.currency.Code, "currency", "USD", "The ISO 4217 code of the currency to report costs in")
+	fs.StringVar(&f.currency.RatesFile, "currency.rates-file", "", "The YAML file mapping currency codes to the amount of the currency a US dollar buys")
+	fs.StringVar(&f.currency.RateMetric, "currency.rate-metric", "", "The Prometheus metric holding the amount of each currency, by its currency label, a US dollar buys")
+	fs.Func("report.periods", "Comma separated list of the periods to report costs for, e.g. weekly,monthly or 2160h for a quarter. The last one is used where a single period is reported (default weekly,monthly)", func(s string) error {
+		periods, err := costmodel.ParsePeriods(s)
+		if err != nil {
+			return err
+		}
+		f.reporterOpts = append(f.reporterOpts, costmodel.WithPeriods(periods...))
+		return nil
+	})
+	fs.Func("report.columns", "Comma separated list of the columns of the table and csv reports, e.g. cluster,namespace,name,to,delta", func(s string) error {
+		columns, err := costmodel.ParseColumns(s)
+		if err != nil {
+			return err
+		}
+		f.reporterOpts = append(f.reporterOpts, costmodel.WithColumns(columns...))
+		return nil
+	})
+	fs.Func("report.template", "The template of the markdown report, replacing the embedded one or some of its templates", func(s string) error {
+		t, err := costmodel.LoadTemplate(s)
+		if err != nil {
+			return err
+		}
+		f.reporterOpts = append(f.reporterOpts, costmodel.WithTemplate(t))
+		return nil
+	})
+	fs.StringVar(&f.reportType, "report.type", "table", "The type of report to generate. Options are: table, summary, markdown, csv, json")
+	return f
+}
+
+// Options are the client configuration, the estimators and the reporter
+// options of a run. Estimators are nil, or false, when disabled.
+type Options struct {
+	Client        *costmodel.ClientConfig
+	Cache         costmodel.Cache
+	Discounts     *costmodel.Discounts
+	Carbon        *costmodel.Carbon
+	Observability *costmodel.Observability
+	Backups       *costmodel.Backups
+	BinPacking    bool
+
+	currency     costmodel.CurrencyConfig
+	reportType   string
+	reporterOpts []costmodel.Option
+}
+
+// Load loads the cache and the files of the flags once they are parsed.
+func (f *Flags) Load() (*Options, error) {
+	client := f.client
+	client.PriceWindow = time.Duration(f.priceWindow)
+	o := &Options{
+		Client:       &client,
+		BinPacking:   f.binPacking,
+		currency:     f.currency,
+		reportType:   f.reportType,
+		reporterOpts: slices.Clone(f.reporterOpts),
+	}
+
+	var err error
+	if f.cacheDir != "" {
+		if o.Cache, err = costmodel.NewFileCache(f.cacheDir, f.cacheTTL); err != nil {
+			return nil, fmt.Errorf("creating cache: %w", err)
+		}
+	}
+	if f.discountsFile != "" {
+		if o.Discounts, err = costmodel.LoadDiscounts(f.discountsFile); err != nil {
+			return nil, fmt.Errorf("loading discounts: %w", err)
+		}
+	}
+	if f.carbonFile != "" {
+		if o.Carbon, err = costmodel.LoadCarbon(f.carbonFile); err != nil {
+			return nil, fmt.Errorf("loading carbon configuration: %w", err)
+		}
+	}
+	if f.observabilityFile != "" {
+		if o.Observability, err = costmodel.LoadObservability(f.observabilityFile); err != nil {
+			return nil, fmt.Errorf("loading observability configuration: %w", err)
+		}
+	}
+	if f.backupsFile != "" {
+		if o.Backups, err = costmodel.LoadBackups(f.backupsFile); err != nil {
+			return nil, fmt.Errorf("loading backup policies: %w", err)
+		}
+	}
+
+	if f.listPrices {
+		o.reporterOpts = append(o.reporterOpts, costmodel.WithListPrices())
+	}
+	if f.scenarios {
+		o.reporterOpts = append(o.reporterOpts, costmodel.WithScenarios())
+	}
+	if f.assumptions {
+		o.reporterOpts = append(o.reporterOpts, costmodel.WithAssumptions())
+	}
+	return o, nil
+}
+
+// ReportType returns the type of report of the flags.
+func (o *Options) ReportType() string {
+	return o.reportType
+}
+
+// Currency returns the currency of the flags, for commands writing their
+// own reports.
+func (o *Options) Currency(ctx context.Context, q costmodel.ExchangeRateQuerier) (costmodel.Currency, error) {
+	cur, err := o.currency.Currency(ctx, q)
+	if err != nil {
+		return costmodel.Currency{}, fmt.Errorf("could not get currency: %s", err)
+	}
+	return cur, nil
+}
+
+// NewReporter returns a reporter of the report type and options of the
+// flags, followed by opts, in the currency of the flags.
+func (o *Options) NewReporter(ctx context.Context, w io.Writer, q costmodel.ExchangeRateQuerier, opts ...costmodel.Option) (*costmodel.Reporter, error) {
+	cur, err := o.Currency(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return costmodel.New(w, o.reportType, slices.Concat(o.reporterOpts, opts, []costmodel.Option{costmodel.WithCurrency(cur)})...), nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlags_Load(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := Register(fs)
+	if err := fs.Parse([]string{"-prometheus.address", "http://prom", "-prices.window", "30d", "-report.bin-packing", "-report.list-prices"}); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	o, err := f.Load()
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if o.Client.Address != "http://prom" || o.Client.PriceWindow != 30*24*time.Hour || o.Client.MaxRetries != 3 {
+		t.Errorf("unexpected client configuration %+v", o.Client)
+	}
+	if !o.BinPacking || o.Cache != nil || o.Discounts != nil {
+		t.Errorf("expecting only bin-packing enabled, got %+v", o)
+	}
+	if o.ReportType() != "table" {
+		t.Errorf("expecting the table report by default, got %s", o.ReportType())
+	}
+	if len(o.reporterOpts) != 1 {
+		t.Errorf("expecting the list prices reporter option, got %d options", len(o.reporterOpts))
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f = Register(fs)
+	if err := fs.Parse([]string{"-report.periods", "fortnightly"}); err == nil {
+		t.Errorf("expecting an error parsing invalid periods")
+	}
+	if len(f.reporterOpts) != 0 {
+		t.Errorf("expecting no reporter option for invalid periods, got %d", len(f.reporterOpts))
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	f = Register(fs)
+	if err := fs.Parse([]string{"-discounts.file", "missing.yaml"}); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if _, err := f.Load(); err == nil || !strings.HasPrefix(err.Error(), "loading discounts") {
+		t.Errorf("expecting an error loading discounts, got %v", err)
+	}
+}
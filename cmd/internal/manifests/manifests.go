@@ -0,0 +1,19 @@
+// Package manifests holds the layout of the kube-manifests repository
+// shared by the bot and the backtest commands.
+package manifests
+
+import "strings"
+
+// Cluster returns the cluster of a manifest in the kube-manifests
+// repository layout, e.g. flux/<cluster>/<namespace>/<file>, or an empty
+// string if the path isn't the manifest of a cluster.
+func Cluster(path string) string {
+	if !strings.HasPrefix(path, "flux/") && !strings.HasPrefix(path, "flux-disabled/") {
+		return ""
+	}
+	ps := strings.SplitN(path, "/", 3)
+	if len(ps) <= 2 {
+		return ""
+	}
+	return ps[1]
+}
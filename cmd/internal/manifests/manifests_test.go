@@ -0,0 +1,20 @@
+package manifests
+
+import "testing"
+
+func TestCluster(t *testing.T) {
+	tests := map[string]string{
+		"flux/ops-us-east-0/exporters/Deployment-gcp-compute-exporter-grafanalabs-dev.yaml":          "ops-us-east-0",
+		"flux/dev-us-central-0/default/StatefulSet-prometheus.yaml":                                  "dev-us-central-0",
+		"flux/prod-us-central-0/default/StatefulSet-prometheus.yaml":                                 "prod-us-central-0",
+		"flux-disabled/ops-us-east-0/ctank-migrations/StatefulSet-cassandra-chunk-extractor-us.yaml": "ops-us-east-0",
+		"README.md":          "",
+		"flux/kustomization": "",
+	}
+
+	for f, exp := range tests {
+		if got := Cluster(f); exp != got {
+			t.Errorf("expecting cluster %s for file %s, got %s", exp, f, got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grafana/kost/cmd/internal/cli"
+	"github.com/grafana/kost/pkg/costmodel"
+	"github.com/grafana/kost/pkg/git"
+)
+
+// manifest is a manifest file found in the inventory along with the
+// cluster it is deployed to.
+type manifest struct {
+	cluster string
+	path    string
+	src     []byte
+}
+
+func main() {
+	var dir, repoPath, ref string
+	flag.StringVar(&dir, "dir", "flux", "The directory holding the manifests, with one subdirectory per cluster")
+	flag.StringVar(&repoPath, "repo", ".", "The git repository holding the manifests when using -ref")
+	flag.StringVar(&ref, "ref", "", "The git ref to read the manifests at. If empty, the manifests are read from disk")
+	shared := cli.Register(flag.CommandLine)
+	flag.Parse()
+
+	opts, err := shared.Load()
+	if err != nil {
+		fmt.Printf("Could not load configuration: %s\n", err)
+		os.Exit(1)
+	}
+
+	clusters := flag.Args()
+
+	ctx := context.Background()
+
+	var manifests []manifest
+	if ref != "" {
+		manifests, err = readGitManifests(ctx, git.NewRepository(repoPath), ref, dir)
+	} else {
+		manifests, err = readManifests(dir)
+	}
+	if err != nil {
+		fmt.Printf("Could not read manifests: %s\n", err)
+		os.Exit(1)
+	}
+
+	if err := run(ctx, manifests, clusters, opts); err != nil {
+		fmt.Printf("Could not run: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// readManifests walks dir and returns every manifest file found in it.
+func readManifests(dir string) ([]manifest, error) {
+	var ms []manifest
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isManifest(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		ms = append(ms, manifest{cluster: findCluster(filepath.ToSlash(rel)), path: path, src: src})
+		return nil
+	})
+
+	return ms, err
+}
+
+// readGitManifests returns every manifest file found under dir at the
+// given ref.
+func readGitManifests(ctx context.Context, repo git.Repository, ref, dir string) ([]manifest, error) {
+	commit, err := repo.GetCommit(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("getting commit: %w", err)
+	}
+
+	files, err := repo.ListFiles(ctx, commit, dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+
+	prefix := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(dir)), "/") + "/"
+
+	var ms []manifest
+	for _, f := range files {
+		if !isManifest(f) {
+			continue
+		}
+
+		src, err := repo.Contents(ctx, commit, f)
+		if err != nil {
+			return nil, fmt.Errorf("checking %s:%s contents: %w", commit, f, err)
+		}
+
+		ms = append(ms, manifest{cluster: findCluster(strings.TrimPrefix(f, prefix)), path: f, src: src})
+	}
+
+	return ms, nil
+}
+
+func isManifest(path string) bool {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// findCluster returns the cluster of a path relative to the inventory
+// directory, which is its first element.
+func findCluster(path string) string {
+	cluster, _, ok := strings.Cut(path, "/")
+	if !ok {
+		return ""
+	}
+	return cluster
+}
+
+func run(ctx context.Context, manifests []manifest, clusters []string, opts *cli.Options) error {
+	client, err := costmodel.NewClient(opts.Client)
+	if err != nil {
+		return fmt.Errorf("could not create cost model client: %s", err)
+	}
+
+	byCluster := make(map[string][]manifest)
+	for _, m := range manifests {
+		if m.cluster == "" {
+			continue
+		}
+		byCluster[m.cluster] = append(byCluster[m.cluster], m)
+	}
+
+	if len(clusters) == 0 {
+		for c := range byCluster {
+			clusters = append(clusters, c)
+		}
+	}
+	sort.Strings(clusters)
+
+	reporter, err := opts.NewReporter(ctx, os.Stdout, client, costmodel.WithInventory())
+	if err != nil {
+		return err
+	}
+
+	// The backups configuration overrides those of the manifests.
+	allBackups := []*costmodel.Backups{opts.Backups}
+
+	for _, cluster := range clusters {
+		cost, err := costmodel.GetCachedCostModelForCluster(ctx, client, opts.Cache, cluster)
+		if err != nil {
+			reporter.AddCostModelError(cluster, err)
+			continue
+		}
+		cost = opts.Discounts.Apply(cost)
+
+		var reqs []costmodel.Requirements
+		for _, m := range byCluster[cluster] {
+			rs, err := costmodel.ParseManifests(m.src, cost)
+			if err != nil {
+				reporter.AddError(fmt.Sprintf("could not parse manifest file(%s): %s", m.path, err))
+				continue
+			}
+			reqs = append(reqs, rs...)
+
+			b, err := costmodel.ParseBackups(m.src)
+			if err != nil {
+				reporter.AddError(fmt.Sprintf("could not parse backups of manifest file(%s): %s", m.path, err))
+				continue
+			}
+			allBackups = append(allBackups, b.InCluster(cluster))
+		}
+
+		// Group the inventory by namespace and kind.
+		sort.Slice(reqs, func(i, j int) bool {
+			return reqs[i].Namespace+"/"+reqs[i].Kind+"/"+reqs[i].Name < reqs[j].Namespace+"/"+reqs[j].Kind+"/"+reqs[j].Name
+		})
+
+		for _, req := range reqs {
+			reporter.AddInventory(ctx, client, cost, req)
+		}
+	}
+
+	if opts.BinPacking {
+		reporter.AddNodeShapes(ctx, client)
+	}
+	reporter.AddCarbon(ctx, opts.Carbon, client)
+	reporter.AddObservability(ctx, opts.Observability, client)
+	merged := costmodel.MergeBackups(allBackups...)
+	reporter.AddBackups(merged, merged)
+
+	return reporter.Write()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFindCluster(t *testing.T) {
+	tests := map[string]string{
+		"ops-us-east-0/exporters/Deployment-gcp-compute-exporter.yaml": "ops-us-east-0",
+		"prod-us-central-0/default/StatefulSet-prometheus.yaml":        "prod-us-central-0",
+		"kustomization.yaml": "",
+	}
+
+	for f, exp := range tests {
+		if got := findCluster(f); exp != got {
+			t.Errorf("expecting cluster %s for file %s, got %s", exp, f, got)
+		}
+	}
+}
+
+func TestReadManifests(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, f := range []string{
+		"dev-us-central-0/default/Deployment-foo.yaml",
+		"dev-us-central-0/default/README.md",
+		"prod-us-central-0/default/StatefulSet-bar.json",
+	} {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", p, err)
+		}
+	}
+
+	ms, err := readManifests(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading manifests: %v", err)
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].path < ms[j].path })
+
+	exp := []string{"dev-us-central-0", "prod-us-central-0"}
+	if e, g := len(exp), len(ms); e != g {
+		t.Fatalf("expecting %d manifests, got %d", e, g)
+	}
+	for i, e := range exp {
+		if g := ms[i].cluster; e != g {
+			t.Errorf("expecting cluster %s at index %d, got %s", e, i, g)
+		}
+	}
+}
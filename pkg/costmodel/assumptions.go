@@ -0,0 +1,101 @@
+package costmodel
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TierNonSpot is the price tier CPU and memory are priced at: workloads
+// aren't assumed to run on spot nodes.
+const TierNonSpot = "non-spot"
+
+// WithAssumptions reports the unit prices, node count and replica sources
+// of each cluster, and the hours of the period, the costs are computed
+// from.
+func WithAssumptions() Option {
+	return func(r *Reporter) {
+		r.assumptions = true
+	}
+}
+
+// Assumptions are the inputs the costs of the workloads of a cluster are
+// computed from: the cost over a period is the hourly price of each
+// resource times its requests, the replicas and the hours of the period.
+type Assumptions struct {
+	Cluster string
+	// CPU, Memory and Storage are the hourly prices of a CPU core, of a
+	// GiB of memory and of a GiB of persistent volume, in US dollars.
+	CPU     float64
+	Memory  float64
+	Storage float64
+	// Tier is the price tier of CPU and memory, see TierNonSpot.
+	Tier string
+	// Nodes is the node count of the cluster, the replicas of its
+	// DaemonSets.
+	Nodes int
+	// ReplicaSources counts the workloads by where their replicas come
+	// from, see ReplicaSource.
+	ReplicaSources map[string]int
+}
+
+// Sources formats the replica sources, e.g. 2 manifest, 1 observed.
+func (a Assumptions) Sources() string {
+	var sources []string
+	for _, s := range []ReplicaSource{SourceManifest, SourceObservedHPA} {
+		if n := a.ReplicaSources[s.String()]; n > 0 {
+			sources = append(sources, fmt.Sprintf("%d %s", n, s))
+		}
+	}
+	return strings.Join(sources, ", ")
+}
+
+// clusterAssumptions returns the assumptions of each cluster of the
+// reports, sorted by cluster name, or nil if they aren't reported.
+func (r *Reporter) clusterAssumptions() []Assumptions {
+	if !r.assumptions {
+		return nil
+	}
+	var all []Assumptions
+	for _, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil {
+			continue
+		}
+		i := slices.IndexFunc(all, func(a Assumptions) bool { return a.Cluster == m.CostModel.Cluster.Name })
+		if i < 0 {
+			all = append(all, Assumptions{
+				Cluster:        m.CostModel.Cluster.Name,
+				CPU:            m.CostModel.CPU.NonSpot,
+				Memory:         m.CostModel.RAM.NonSpot,
+				Storage:        m.CostModel.PersistentVolume.Dollars,
+				Tier:           TierNonSpot,
+				Nodes:          m.CostModel.Cluster.NodeCount,
+				ReplicaSources: make(map[string]int),
+			})
+			i = len(all) - 1
+		}
+		all[i].ReplicaSources[m.replicaSource.String()]++
+	}
+	slices.SortFunc(all, func(a, b Assumptions) int { return strings.Compare(a.Cluster, b.Cluster) })
+	return all
+}
+
+// writeAssumptions writes the assumptions of each cluster and the hours
+// of the main period, if reported.
+func (r *Reporter) writeAssumptions() error {
+	all := r.clusterAssumptions()
+	if len(all) == 0 {
+		return nil
+	}
+	p := r.mainPeriod()
+	if _, err := fmt.Fprintf(r.Writer, "%s costs are the hourly prices times the requests, the replicas and %v hours.\n", p.Title(), float64(p)); err != nil {
+		return err
+	}
+	for _, a := range all {
+		if _, err := fmt.Fprintf(r.Writer, "Assumptions for cluster %s: %s prices of %s per CPU core-hour, %s per GiB-hour of memory and %s per GiB-hour of persistent volume; %d nodes, the replicas of DaemonSets; replicas from %s.\n",
+			a.Cluster, a.Tier, r.currency.FormatPrice(a.CPU), r.currency.FormatPrice(a.Memory), r.currency.FormatPrice(a.Storage), a.Nodes, a.Sources()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
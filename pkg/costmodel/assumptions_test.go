@@ -0,0 +1,105 @@
+package costmodel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReporter_assumptions(t *testing.T) {
+	prod := &CostModel{
+		Cluster:          &Cluster{Name: "prod", NodeCount: 12},
+		CPU:              Cost{Spot: 0.01, NonSpot: 0.03},
+		RAM:              Cost{Spot: 0.001, NonSpot: 0.004},
+		PersistentVolume: Cost{Dollars: 0.000055},
+	}
+	dev := &CostModel{Cluster: &Cluster{Name: "dev", NodeCount: 3}, CPU: Cost{NonSpot: 0.02}}
+	from := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 4
+	observed := Requirements{CPUPerPod: 1000, Replicas: 3, Kind: "Deployment", Namespace: "ns", Name: "hpa"}
+
+	newReporter := func(s *strings.Builder, reportType ReportType, opts ...Option) *Reporter {
+		r := New(s, string(reportType), opts...)
+		r.AddReport(prod, from, to)
+		r.addReport(prod, observed, observed, SourceObservedHPA)
+		r.AddReport(dev, from, to)
+		return r
+	}
+
+	t.Run("clusters", func(t *testing.T) {
+		got := newReporter(nil, Table, WithAssumptions()).clusterAssumptions()
+		if len(got) != 2 || got[0].Cluster != "dev" || got[1].Cluster != "prod" {
+			t.Fatalf("expecting the assumptions of dev and prod, got %+v", got)
+		}
+		p := got[1]
+		if p.CPU != 0.03 || p.Memory != 0.004 || p.Storage != 0.000055 || p.Tier != TierNonSpot || p.Nodes != 12 {
+			t.Errorf("unexpected assumptions of prod %+v", p)
+		}
+		if s := p.Sources(); s != "1 manifest, 1 observed" {
+			t.Errorf("expecting 1 manifest, 1 observed, got %q", s)
+		}
+	})
+
+	tests := []struct {
+		reportType ReportType
+		want       []string
+	}{
+		{Summary, []string{
+			"Monthly costs are the hourly prices times the requests, the replicas and 720 hours.\n",
+			"Assumptions for cluster prod: non-spot prices of $0.030000 per CPU core-hour, $0.004000 per GiB-hour of memory and $0.000055 per GiB-hour of persistent volume; 12 nodes, the replicas of DaemonSets; replicas from 1 manifest, 1 observed.\n",
+		}},
+		{Table, []string{"Assumptions for cluster dev: non-spot prices of $0.020000 per CPU core-hour"}},
+		{CSV, []string{
+			",replica_source,cpu_per_core_hour,memory_per_gib_hour,storage_per_gib_hour\n",
+			",observed,0.030000,0.004000,0.000055\n",
+		}},
+		{Markdown, []string{
+			"<summary><strong>:abacus: Assumptions</strong>: monthly costs are the hourly prices below times the requests, the replicas and 720 hours.</summary>",
+			"| `prod` | $0.030000 | $0.004000 | $0.000055 | non-spot | 12 | 1 manifest, 1 observed |",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reportType), func(t *testing.T) {
+			var s strings.Builder
+			if err := newReporter(&s, tt.reportType, WithAssumptions()).Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(s.String(), want) {
+					t.Errorf("expecting report to contain %q, got:\n%s", want, s.String())
+				}
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var s strings.Builder
+		if err := newReporter(&s, JSON, WithAssumptions(), WithCurrency(Currency{Code: "EUR", Rate: 0.5})).Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		var got jsonReport
+		if err := json.Unmarshal([]byte(s.String()), &got); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", s.String(), err)
+		}
+		if got.Assumptions == nil || got.Assumptions.Hours != 720 || len(got.Assumptions.Clusters) != 2 {
+			t.Fatalf("unexpected assumptions %+v", got.Assumptions)
+		}
+		if c := got.Assumptions.Clusters[1]; c.Cluster != "prod" || !feq(c.CPUPerCoreHour, 0.015) || c.ReplicaSources["observed"] != 1 {
+			t.Errorf("expecting the prices of prod in EUR, got %+v", c)
+		}
+		if got.Workloads[1].ReplicaSource != "observed" {
+			t.Errorf("expecting the replicas of hpa to be observed, got %q", got.Workloads[1].ReplicaSource)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var s strings.Builder
+		if err := newReporter(&s, Summary).Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if strings.Contains(s.String(), "Assumptions") {
+			t.Errorf("expecting no assumptions, got:\n%s", s.String())
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package costmodel
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// queryNodeLabels reports the labels of each node of a cluster, as exposed by kube-state-metrics.
+	// Format args: cluster.
+	queryNodeLabels = `kube_node_labels{cluster="%s"}`
+
+	// queryNodeRequests reports the amount of a resource requested by the running pods of each node of a cluster.
+	// Format args: cluster, resource, cluster.
+	queryNodeRequests = `sum by (node) (
+		kube_pod_container_resource_requests{cluster="%s", resource="%s"}
+		* on (namespace, pod) group_left()
+		max by (namespace, pod) (kube_pod_status_phase{cluster="%s", phase="Running"} == 1)
+	)`
+)
+
+// nodePoolLabels are the node labels naming the node pool of a node, in
+// order of precedence.
+var nodePoolLabels = []string{
+	"cloud.google.com/gke-nodepool",
+	"eks.amazonaws.com/nodegroup",
+	"karpenter.sh/nodepool",
+	"kubernetes.azure.com/agentpool",
+	"agentpool",
+}
+
+// instanceTypeLabels are the node labels naming the instance type of a
+// node, in order of precedence.
+var instanceTypeLabels = []string{
+	"node.kubernetes.io/instance-type",
+	"beta.kubernetes.io/instance-type",
+}
+
+// invalidLabelChars matches the characters kube-state-metrics replaces in
+// the names of the labels of kube_node_labels.
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// nodeLabel returns the label of kube_node_labels holding a node label.
+func nodeLabel(name string) model.LabelName {
+	return model.LabelName("label_" + invalidLabelChars.ReplaceAllString(name, "_"))
+}
+
+// NodePool is a group of nodes of a cluster scaled together by the
+// autoscaler. CPU is in cores and memory in bytes.
+type NodePool struct {
+	// Name is empty if the nodes have no node pool label, e.g. because
+	// kube-state-metrics doesn't expose it.
+	Name         string
+	InstanceType string
+	Nodes        int
+	// CPU and Memory are the average allocatable resources of a node.
+	CPU    float64
+	Memory float64
+	// CPUHeadroom and MemoryHeadroom are the allocatable resources of the
+	// nodes left unrequested by their running pods.
+	CPUHeadroom    float64
+	MemoryHeadroom float64
+}
+
+// NodeDelta predicts how many nodes the autoscaler adds to the pool, or
+// removes if negative, when the pods scheduled on it request cpu more
+// cores and memory more bytes. Nodes are added when the requests outgrow
+// the headroom, and removed when whole nodes are freed by lower requests.
+func (p NodePool) NodeDelta(cpu, memory float64) int {
+	if p.CPU <= 0 || p.Memory <= 0 {
+		return 0
+	}
+	if cpu <= 0 && memory <= 0 {
+		free := func(cpu, memory float64) float64 {
+			return math.Floor(min(cpu/p.CPU, memory/p.Memory))
+		}
+		before := free(max(p.CPUHeadroom, 0), max(p.MemoryHeadroom, 0))
+		after := free(max(p.CPUHeadroom, 0)-cpu, max(p.MemoryHeadroom, 0)-memory)
+		return -int(min(after-before, float64(p.Nodes)))
+	}
+	if added := max((cpu-p.CPUHeadroom)/p.CPU, (memory-p.MemoryHeadroom)/p.Memory); added > 0 {
+		return int(math.Ceil(added))
+	}
+	return 0
+}
+
+// NodePoolQuerier is the subset of *Client behavior Reporter.AddNodePools needs.
+type NodePoolQuerier interface {
+	GetNodePools(ctx context.Context, cluster string) ([]NodePool, error)
+}
+
+var (
+	_ NodePoolQuerier = (*Client)(nil)
+	_ NodePoolQuerier = (*Clients)(nil)
+)
+
+// GetNodePools returns the node pools of a cluster with their headroom, from the
+// allocatable resources of their nodes and the requests of their running pods in
+// kube-state-metrics, the largest first. Nodes are grouped by their node pool
+// label, see nodePoolLabels, which kube-state-metrics must be allowed to expose.
+// Returns ErrNoResults if the cluster has no node.
+func (c *Client) GetNodePools(ctx context.Context, cluster string) ([]NodePool, error) {
+	vec, err := c.queryVectorNow(ctx, fmt.Sprintf(queryNodeLabels, cluster))
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]model.Metric, len(vec))
+	for _, s := range vec {
+		labels[string(s.Metric["node"])] = s.Metric
+	}
+
+	perNode := make(map[string]map[string]float64)
+	for _, q := range []struct{ name, query string }{
+		{"cpu", fmt.Sprintf(queryNodeAllocatable, cluster, "cpu")},
+		{"memory", fmt.Sprintf(queryNodeAllocatable, cluster, "memory")},
+		{"cpu_requests", fmt.Sprintf(queryNodeRequests, cluster, "cpu", cluster)},
+		{"memory_requests", fmt.Sprintf(queryNodeRequests, cluster, "memory", cluster)},
+	} {
+		if perNode[q.name], err = c.queryByNode(ctx, q.query); err != nil {
+			return nil, err
+		}
+	}
+
+	pools := make(map[string]*NodePool)
+	instanceTypes := make(map[string]map[string]int)
+	for node, cpu := range perNode["cpu"] {
+		memory, ok := perNode["memory"][node]
+		if !ok {
+			continue
+		}
+		name := firstLabel(labels[node], nodePoolLabels)
+		instanceType := firstLabel(labels[node], instanceTypeLabels)
+		p, ok := pools[name]
+		if !ok {
+			p = &NodePool{Name: name}
+			pools[name] = p
+			instanceTypes[name] = make(map[string]int)
+		}
+		p.Nodes++
+		p.CPU += cpu
+		p.Memory += memory
+		p.CPUHeadroom += cpu - perNode["cpu_requests"][node]
+		p.MemoryHeadroom += memory - perNode["memory_requests"][node]
+		instanceTypes[name][instanceType]++
+	}
+	if len(pools) == 0 {
+		return nil, ErrNoResults
+	}
+
+	out := make([]NodePool, 0, len(pools))
+	for name, p := range pools {
+		p.CPU /= float64(p.Nodes)
+		p.Memory /= float64(p.Nodes)
+		// The most common instance type of the pool.
+		for t, n := range instanceTypes[name] {
+			if n > instanceTypes[name][p.InstanceType] || (n == instanceTypes[name][p.InstanceType] && t > p.InstanceType) {
+				p.InstanceType = t
+			}
+		}
+		out = append(out, *p)
+	}
+	slices.SortFunc(out, func(a, b NodePool) int {
+		return cmp.Or(cmp.Compare(b.Nodes, a.Nodes), cmp.Compare(a.Name, b.Name))
+	})
+	return out, nil
+}
+
+// queryVectorNow runs an instant query expecting a vector.
+func (c *Client) queryVectorNow(ctx context.Context, query string) (model.Vector, error) {
+	results, err := c.query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadQuery, err)
+	}
+	vec, ok := results.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected result type %T", ErrBadQuery, results)
+	}
+	return vec, nil
+}
+
+// queryByNode runs an instant query returning a value per node, keyed by
+// the node label.
+func (c *Client) queryByNode(ctx context.Context, query string) (map[string]float64, error) {
+	vec, err := c.queryVectorNow(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64, len(vec))
+	for _, s := range vec {
+		values[string(s.Metric["node"])] = float64(s.Value)
+	}
+	return values, nil
+}
+
+// firstLabel returns the value of the first of the node labels set on a
+// kube_node_labels series.
+func firstLabel(m model.Metric, names []string) string {
+	for _, n := range names {
+		if v := m[nodeLabel(n)]; v != "" {
+			return string(v)
+		}
+	}
+	return ""
+}
+
+// AddNodePools queries the node pools of the clusters of the reports added
+// so far, to predict how many nodes the changes make the autoscaler add or
+// remove. Failed queries are added as warnings.
+func (r *Reporter) AddNodePools(ctx context.Context, q NodePoolQuerier) {
+	for _, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		if _, ok := r.nodePools[cluster]; ok {
+			continue
+		}
+		if r.nodePools == nil {
+			r.nodePools = make(map[string][]NodePool)
+		}
+		pools, err := q.GetNodePools(ctx, cluster)
+		if err != nil {
+			r.AddWarning(fmt.Sprintf("querying node pools of %s: %v", cluster, err))
+		}
+		r.nodePools[cluster] = pools
+	}
+}
+
+// NodeChange is the predicted change in the node count of a node pool.
+type NodeChange struct {
+	Cluster      string
+	Pool         string
+	InstanceType string
+	// Nodes is the number of nodes added, negative if removed.
+	Nodes int
+	// ClusterNodes is the node count of the cluster, zero if unknown.
+	ClusterNodes int
+}
+
+// String describes the change, e.g. This change likely adds ~3
+// n2-standard-8 nodes to pool X of cluster prod, 7% of its 42 nodes.
+func (c NodeChange) String() string {
+	verb, prep, n := "adds", "to", c.Nodes
+	if n < 0 {
+		verb, prep, n = "removes", "from", -n
+	}
+	nodes := "nodes"
+	if n == 1 {
+		nodes = "node"
+	}
+	if c.InstanceType != "" {
+		nodes = c.InstanceType + " " + nodes
+	}
+	where := "cluster " + c.Cluster
+	if c.Pool != "" {
+		where = fmt.Sprintf("pool %s of cluster %s", c.Pool, c.Cluster)
+	}
+	s := fmt.Sprintf("This change likely %s ~%d %s %s %s", verb, n, nodes, prep, where)
+	if c.ClusterNodes > 0 {
+		s += fmt.Sprintf(", %.0f%% of its %d nodes", float64(n)/float64(c.ClusterNodes)*100, c.ClusterNodes)
+	}
+	return s + "."
+}
+
+// pool is a node pool, or the shape of its nodes, see poolOf.
+type pool interface {
+	poolName() string
+}
+
+func (p NodePool) poolName() string {
+	return p.Name
+}
+
+// poolOf returns the index of the node pool the pods of the requirements
+// are scheduled on, among pools sorted by decreasing size: the pool their
+// node selector selects, or else the largest pool. It is -1 if the cluster
+// has no pool, or not the selected one.
+func poolOf[P pool](pools []P, req Requirements) int {
+	for _, l := range nodePoolLabels {
+		if name, ok := req.NodeSelector[l]; ok {
+			return slices.IndexFunc(pools, func(p P) bool { return p.poolName() == name })
+		}
+	}
+	if len(pools) == 0 {
+		return -1
+	}
+	return 0
+}
+
+// nodeChanges predicts the change in the node count of each node pool,
+// from the aggregate change in the requests of the workloads scheduled on
+// it. Pools whose node count doesn't change are left out.
+func (r *Reporter) nodeChanges() []NodeChange {
+	type delta struct{ cpu, memory float64 }
+	deltas := make(map[string][]delta)
+	clusterNodes := make(map[string]int)
+	for _, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		pools := r.nodePools[cluster]
+		if len(pools) == 0 {
+			continue
+		}
+		if deltas[cluster] == nil {
+			deltas[cluster] = make([]delta, len(pools))
+		}
+		clusterNodes[cluster] = m.CostModel.Cluster.NodeCount
+		if i := poolOf(pools, m.From); i >= 0 && m.From.Kind != "" {
+			deltas[cluster][i].cpu -= float64(m.From.TotalCPU()) / 1000
+			deltas[cluster][i].memory -= float64(m.From.TotalMemory())
+		}
+		if i := poolOf(pools, m.To); i >= 0 && m.To.Kind != "" {
+			deltas[cluster][i].cpu += float64(m.To.TotalCPU()) / 1000
+			deltas[cluster][i].memory += float64(m.To.TotalMemory())
+		}
+	}
+
+	var changes []NodeChange
+	for _, cluster := range slices.Sorted(maps.Keys(deltas)) {
+		for i, p := range r.nodePools[cluster] {
+			n := p.NodeDelta(deltas[cluster][i].cpu, deltas[cluster][i].memory)
+			if n == 0 {
+				continue
+			}
+			changes = append(changes, NodeChange{
+				Cluster:      cluster,
+				Pool:         p.Name,
+				InstanceType: p.InstanceType,
+				Nodes:        n,
+				ClusterNodes: clusterNodes[cluster],
+			})
+		}
+	}
+	return changes
+}
+
+// nodeChangeLines returns the lines of the predicted change in the node
+// count of each node pool.
+func (r *Reporter) nodeChangeLines() []string {
+	var lines []string
+	for _, c := range r.nodeChanges() {
+		lines = append(lines, c.String())
+	}
+	return lines
+}
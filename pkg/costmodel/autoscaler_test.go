@@ -0,0 +1,159 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type fakeNodePoolQuerier map[string][]NodePool
+
+func (f fakeNodePoolQuerier) GetNodePools(_ context.Context, cluster string) ([]NodePool, error) {
+	pools, ok := f[cluster]
+	if !ok {
+		return nil, errors.New("boom")
+	}
+	return pools, nil
+}
+
+func TestNodePool_NodeDelta(t *testing.T) {
+	pool := NodePool{Nodes: 10, CPU: 8, Memory: 32 * gib, CPUHeadroom: 2, MemoryHeadroom: 4 * gib}
+
+	tests := []struct {
+		name        string
+		cpu, memory float64
+		want        int
+	}{
+		{"within headroom", 1, gib, 0},
+		{"cpu bound", 20, 0, 3},
+		{"memory bound", 0, 70 * gib, 3},
+		{"frees nodes", -16, -64 * gib, -2},
+		{"frees less than a node", -1, -gib, 0},
+		{"mixed", 4, -8 * gib, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pool.NodeDelta(tt.cpu, tt.memory); got != tt.want {
+				t.Errorf("expecting %d nodes, got %d", tt.want, got)
+			}
+		})
+	}
+
+	if got := (NodePool{}).NodeDelta(20, 0); got != 0 {
+		t.Errorf("expecting no change without allocatable resources, got %d", got)
+	}
+}
+
+func TestClient_GetNodePools(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		q := r.Form.Get("query")
+		switch {
+		case strings.Contains(q, "kube_node_labels"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a","label_cloud_google_com_gke_nodepool":"general","label_node_kubernetes_io_instance_type":"n2-standard-8"},"value":[0,"1"]},
+				{"metric":{"node":"b","label_cloud_google_com_gke_nodepool":"general","label_node_kubernetes_io_instance_type":"n2-standard-8"},"value":[0,"1"]},
+				{"metric":{"node":"c","label_cloud_google_com_gke_nodepool":"highmem","label_node_kubernetes_io_instance_type":"n2-highmem-4"},"value":[0,"1"]}]}}`)
+		case strings.Contains(q, "kube_pod_container_resource_requests") && strings.Contains(q, `resource="cpu"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a"},"value":[0,"6"]},
+				{"metric":{"node":"b"},"value":[0,"4"]}]}}`)
+		case strings.Contains(q, "kube_pod_container_resource_requests"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case strings.Contains(q, `resource="cpu"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a"},"value":[0,"8"]},
+				{"metric":{"node":"b"},"value":[0,"8"]},
+				{"metric":{"node":"c"},"value":[0,"4"]}]}}`)
+		case strings.Contains(q, `resource="memory"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a"},"value":[0,"34359738368"]},
+				{"metric":{"node":"b"},"value":[0,"34359738368"]},
+				{"metric":{"node":"c"},"value":[0,"34359738368"]}]}}`)
+		default:
+			t.Errorf("unexpected query %s", q)
+		}
+	})
+
+	pools, err := c.GetNodePools(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	want := []NodePool{
+		{Name: "general", InstanceType: "n2-standard-8", Nodes: 2, CPU: 8, Memory: 32 * gib, CPUHeadroom: 6, MemoryHeadroom: 64 * gib},
+		{Name: "highmem", InstanceType: "n2-highmem-4", Nodes: 1, CPU: 4, Memory: 32 * gib, CPUHeadroom: 4, MemoryHeadroom: 32 * gib},
+	}
+	if len(pools) != len(want) {
+		t.Fatalf("expecting %d pools, got %+v", len(want), pools)
+	}
+	for i := range want {
+		if pools[i] != want[i] {
+			t.Errorf("expecting %+v, got %+v", want[i], pools[i])
+		}
+	}
+}
+
+func TestReporter_AddNodePools(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod", NodeCount: 42}, CPU: Cost{NonSpot: 1}}
+	dev := &CostModel{Cluster: &Cluster{Name: "dev"}, CPU: Cost{NonSpot: 1}}
+	from := Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib, Replicas: 4, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 24
+	cacheFrom := Requirements{
+		CPUPerPod: 2000, MemoryPerPod: 16 * gib, Replicas: 4, Kind: "StatefulSet", Namespace: "ns", Name: "cache",
+		NodeSelector: map[string]string{"cloud.google.com/gke-nodepool": "highmem"},
+	}
+	cacheTo := cacheFrom
+	cacheTo.Replicas = 1
+	q := fakeNodePoolQuerier{"prod": {
+		{Name: "general", InstanceType: "n2-standard-8", Nodes: 10, CPU: 8, Memory: 32 * gib, CPUHeadroom: 2, MemoryHeadroom: 4 * gib},
+		{Name: "highmem", InstanceType: "n2-highmem-4", Nodes: 2, CPU: 4, Memory: 32 * gib, CPUHeadroom: 1, MemoryHeadroom: 8 * gib},
+	}}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.AddReport(prod, cacheFrom, cacheTo)
+		r.AddReport(dev, from, to)
+		r.AddNodePools(context.Background(), q)
+		return r
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		if len(r.warnings) != 1 || r.warnings[0] != "querying node pools of dev: boom" {
+			t.Errorf("expecting a warning for the failed query, got %v", r.warnings)
+		}
+	})
+
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary: {
+			"This change likely adds ~3 n2-standard-8 nodes to pool general of cluster prod, 7% of its 42 nodes.\n",
+			"This change likely removes ~1 n2-highmem-4 node from pool highmem of cluster prod, 2% of its 42 nodes.\n",
+		},
+		Markdown: {"- :building_construction: This change likely adds ~3 n2-standard-8 nodes to pool general of cluster prod, 7% of its 42 nodes.\n"},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		want := []jsonNodeChange{
+			{Cluster: "prod", Pool: "general", InstanceType: "n2-standard-8", Nodes: 3},
+			{Cluster: "prod", Pool: "highmem", InstanceType: "n2-highmem-4", Nodes: -1},
+		}
+		if len(got.NodeChanges) != len(want) || got.NodeChanges[0] != want[0] || got.NodeChanges[1] != want[1] {
+			t.Errorf("expecting %+v, got %+v", want, got.NodeChanges)
+		}
+	})
+
+	t.Run("unlabeled pool", func(t *testing.T) {
+		c := NodeChange{Cluster: "prod", Nodes: 1}
+		if got, want := c.String(), "This change likely adds ~1 node to cluster prod."; got != want {
+			t.Errorf("expecting %q, got %q", want, got)
+		}
+	})
+}
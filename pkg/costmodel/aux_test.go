@@ -1,6 +1,12 @@
 package costmodel
 
 import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -54,3 +60,57 @@ func requirementsHelpers(t *testing.T) requirementsHelperFuncs {
 
 	return h
 }
+
+// newTestClient returns a client of a Prometheus server answering queries
+// with handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	svr := httptest.NewServer(handler)
+	t.Cleanup(svr.Close)
+	c, err := NewClient(&ClientConfig{Address: svr.URL})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	return c
+}
+
+// reporterFunc returns a reporter of the given type writing to s, with the
+// reports of a test added.
+type reporterFunc func(s *strings.Builder, reportType ReportType) *Reporter
+
+// write writes the report of the given type.
+func (f reporterFunc) write(t *testing.T, reportType ReportType) string {
+	t.Helper()
+	var s strings.Builder
+	if err := f(&s, reportType).Write(); err != nil {
+		t.Fatalf("writing %s report: %v", reportType, err)
+	}
+	return s.String()
+}
+
+// writeJSON writes and decodes the json report.
+func (f reporterFunc) writeJSON(t *testing.T) jsonReport {
+	t.Helper()
+	s := f.write(t, JSON)
+	var got jsonReport
+	if err := json.Unmarshal([]byte(s), &got); err != nil {
+		t.Fatalf("unexpected error decoding %s: %v", s, err)
+	}
+	return got
+}
+
+// assertContains checks that the report of each type contains its wanted
+// strings.
+func (f reporterFunc) assertContains(t *testing.T, want map[ReportType][]string) {
+	t.Helper()
+	for _, reportType := range slices.Sorted(maps.Keys(want)) {
+		t.Run(string(reportType), func(t *testing.T) {
+			s := f.write(t, reportType)
+			for _, w := range want[reportType] {
+				if !strings.Contains(s, w) {
+					t.Errorf("expecting report to contain %q, got:\n%s", w, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package costmodel
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/grafana/kost/pkg/costmodel/utils"
+)
+
+var ErrInvalidBackupPolicy = errors.New("invalid backup policy")
+
+// Annotations of a workload setting the backup policy of its volumes,
+// overriding the policies of the backups configuration.
+const (
+	// AnnotationBackupPolicy names the policy of the backups configuration
+	// applying, e.g. after the VolumeSnapshotClass or Velero Schedule.
+	AnnotationBackupPolicy = "kost.grafana.com/backup-policy"
+	// AnnotationBackupRetention is the number of snapshots kept.
+	AnnotationBackupRetention = "kost.grafana.com/backup-retention"
+	// AnnotationBackupChangeRate is the fraction of a volume changing
+	// between snapshots, e.g. 0.05.
+	AnnotationBackupChangeRate = "kost.grafana.com/backup-change-rate"
+)
+
+// defaultChangeRate is the change rate of policies not setting one.
+const defaultChangeRate = 0.1
+
+// BackupPolicy is a policy snapshotting the persistent volumes of the
+// workloads it matches, e.g. a VolumeSnapshot schedule or a Velero
+// Schedule.
+type BackupPolicy struct {
+	// Name identifies the policy in reports and in the backup-policy
+	// annotation.
+	Name string `json:"name"`
+	// Cluster and Namespace are globs matching the workloads, all if
+	// empty.
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Labels are the labels the workloads must have, like the label
+	// selector of a Velero Schedule.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Retention is the number of snapshots kept.
+	Retention int `json:"retention"`
+	// ChangeRate is the fraction of a volume changing between snapshots.
+	// Zero means 0.1.
+	ChangeRate float64 `json:"change_rate,omitempty"`
+	// USDPerGiBMonth is the price of a GiB of snapshot for a month. Zero
+	// means the price of the persistent volumes of the cluster.
+	USDPerGiBMonth float64 `json:"usd_per_gib_month,omitempty"`
+}
+
+// Backups are the backup policies of the clusters, the first matching
+// one applying, and the VolumeSnapshots of the manifests, applying to the
+// StatefulSets not matching any policy.
+type Backups struct {
+	Policies []BackupPolicy `json:"policies"`
+
+	// snapshots are the VolumeSnapshots found by ParseBackups.
+	snapshots []volumeSnapshot
+}
+
+// volumeSnapshot is a VolumeSnapshot of a persistent volume claim, with
+// the change rate of its VolumeSnapshotClass.
+type volumeSnapshot struct {
+	cluster    string
+	namespace  string
+	claim      string
+	class      string
+	changeRate float64
+}
+
+// ParseBackups parses the Velero Schedules, VolumeSnapshotClasses and
+// VolumeSnapshots of a stream of YAML or JSON documents, like
+// ParseManifests, and returns the backup policies they set up. The other
+// documents are skipped.
+//
+// A Schedule is a policy of each of its included namespaces matching the
+// labels of its label selector, keeping the backups made over its ttl.
+// The VolumeSnapshots of the claims of a StatefulSet are a policy keeping
+// as many snapshots, changing by the kost.grafana.com/backup-change-rate
+// annotation of their VolumeSnapshotClass.
+func ParseBackups(src []byte) (*Backups, error) {
+	var b Backups
+	classes := make(map[string]float64)
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(src)))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading manifest document: %w", err)
+		}
+
+		var obj struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name        string            `json:"name"`
+				Namespace   string            `json:"namespace"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+			Spec struct {
+				VolumeSnapshotClassName string `json:"volumeSnapshotClassName"`
+				Source                  struct {
+					PersistentVolumeClaimName string `json:"persistentVolumeClaimName"`
+				} `json:"source"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			continue
+		}
+		group, _, _ := strings.Cut(obj.APIVersion, "/")
+
+		switch {
+		case group == "velero.io" && obj.Kind == "Schedule":
+			var schedule veleroSchedule
+			if err := yaml.Unmarshal(doc, &schedule); err != nil {
+				return nil, fmt.Errorf("parsing velero schedule %s: %w", obj.Metadata.Name, err)
+			}
+			policies, err := schedule.policies()
+			if err != nil {
+				return nil, err
+			}
+			b.Policies = append(b.Policies, policies...)
+
+		case group == "snapshot.storage.k8s.io" && obj.Kind == "VolumeSnapshotClass":
+			rate, ok := obj.Metadata.Annotations[AnnotationBackupChangeRate]
+			if !ok {
+				continue
+			}
+			f, err := strconv.ParseFloat(rate, 64)
+			if err != nil || f < 0 || f > 1 {
+				return nil, fmt.Errorf("%w: volume snapshot class %s: %s must be between 0 and 1, got %q", ErrInvalidBackupPolicy, obj.Metadata.Name, AnnotationBackupChangeRate, rate)
+			}
+			classes[obj.Metadata.Name] = f
+
+		case group == "snapshot.storage.k8s.io" && obj.Kind == "VolumeSnapshot":
+			if obj.Spec.Source.PersistentVolumeClaimName == "" {
+				continue
+			}
+			b.snapshots = append(b.snapshots, volumeSnapshot{
+				namespace: obj.Metadata.Namespace,
+				claim:     obj.Spec.Source.PersistentVolumeClaimName,
+				class:     obj.Spec.VolumeSnapshotClassName,
+			})
+		}
+	}
+
+	// Classes may come after their snapshots.
+	for i, s := range b.snapshots {
+		b.snapshots[i].changeRate = classes[s.class]
+	}
+	return &b, nil
+}
+
+// MergeBackups returns the policies and snapshots of each of bs, which
+// may be nil, in order: the policies of the first ones apply over those of
+// the next ones, e.g. to override the backups of the manifests with the
+// backups configuration.
+func MergeBackups(bs ...*Backups) *Backups {
+	var merged Backups
+	for _, b := range bs {
+		if b == nil {
+			continue
+		}
+		merged.Policies = append(merged.Policies, b.Policies...)
+		merged.snapshots = append(merged.snapshots, b.snapshots...)
+	}
+	return &merged
+}
+
+// InCluster returns the policies and snapshots of b restricted to a
+// cluster, for the manifests of a single cluster.
+func (b *Backups) InCluster(cluster string) *Backups {
+	if b == nil {
+		return nil
+	}
+	in := MergeBackups(b)
+	for i := range in.Policies {
+		in.Policies[i].Cluster = cluster
+	}
+	for i := range in.snapshots {
+		in.snapshots[i].cluster = cluster
+	}
+	return in
+}
+
+// snapshotPolicy returns the policy of the VolumeSnapshots of the claims
+// of a StatefulSet of a cluster, named after its claim template, the
+// StatefulSet and the ordinal of the pod, or nil if it has none. The
+// retention is the most snapshots of a claim.
+func (b *Backups) snapshotPolicy(cluster string, req Requirements) *BackupPolicy {
+	if req.Kind != "StatefulSet" {
+		return nil
+	}
+	claim := regexp.MustCompile("^.+-" + regexp.QuoteMeta(req.Name) + "-[0-9]+$")
+
+	var p *BackupPolicy
+	counts := make(map[string]int)
+	for _, s := range b.snapshots {
+		if (s.cluster != "" && s.cluster != cluster) || s.namespace != req.Namespace || !claim.MatchString(s.claim) {
+			continue
+		}
+		counts[s.claim]++
+		if p == nil {
+			p = &BackupPolicy{Name: "volumesnapshots", ChangeRate: s.changeRate}
+		}
+		p.Retention = max(p.Retention, counts[s.claim])
+	}
+	return p
+}
+
+// LoadBackups reads the backup policies from a YAML file with a top-level
+// policies list.
+func LoadBackups(path string) (*Backups, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading backup policies: %w", err)
+	}
+
+	var b Backups
+	if err := yaml.UnmarshalStrict(src, &b); err != nil {
+		return nil, fmt.Errorf("parsing backup policies: %w", err)
+	}
+	for _, p := range b.Policies {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &b, nil
+}
+
+func (p BackupPolicy) validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: missing name", ErrInvalidBackupPolicy)
+	case p.Retention < 1:
+		return fmt.Errorf("%w: %s: retention must be at least 1, got %d", ErrInvalidBackupPolicy, p.Name, p.Retention)
+	case p.ChangeRate < 0 || p.ChangeRate > 1:
+		return fmt.Errorf("%w: %s: change_rate must be between 0 and 1, got %v", ErrInvalidBackupPolicy, p.Name, p.ChangeRate)
+	case p.USDPerGiBMonth < 0:
+		return fmt.Errorf("%w: %s: usd_per_gib_month must be positive, got %v", ErrInvalidBackupPolicy, p.Name, p.USDPerGiBMonth)
+	}
+	for _, glob := range []string{p.Cluster, p.Namespace} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("%w: %s: glob %q: %w", ErrInvalidBackupPolicy, p.Name, glob, err)
+		}
+	}
+	return nil
+}
+
+// matches returns whether the policy applies to the workload of a cluster.
+func (p BackupPolicy) matches(cluster string, req Requirements) bool {
+	if ok, _ := path.Match(p.Cluster, cluster); p.Cluster != "" && !ok {
+		return false
+	}
+	if ok, _ := path.Match(p.Namespace, req.Namespace); p.Namespace != "" && !ok {
+		return false
+	}
+	for k, v := range p.Labels {
+		if req.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// policy returns the backup policy of the workload of a cluster, from its
+// annotations, then the first matching policy, then its VolumeSnapshots,
+// or nil if it isn't backed up. b may be nil, only the annotations
+// applying.
+func (b *Backups) policy(cluster string, req Requirements) (*BackupPolicy, error) {
+	var p *BackupPolicy
+	if name, ok := req.Annotations[AnnotationBackupPolicy]; ok {
+		if b != nil {
+			for i := range b.Policies {
+				if b.Policies[i].Name == name {
+					p = &b.Policies[i]
+					break
+				}
+			}
+		}
+		if p == nil {
+			return nil, fmt.Errorf("%w: unknown policy %q", ErrInvalidBackupPolicy, name)
+		}
+	} else if b != nil {
+		for i := range b.Policies {
+			if b.Policies[i].matches(cluster, req) {
+				p = &b.Policies[i]
+				break
+			}
+		}
+		if p == nil {
+			p = b.snapshotPolicy(cluster, req)
+		}
+	}
+
+	retention, hasRetention := req.Annotations[AnnotationBackupRetention]
+	changeRate, hasChangeRate := req.Annotations[AnnotationBackupChangeRate]
+	if !hasRetention && !hasChangeRate {
+		return p, nil
+	}
+	annotated := BackupPolicy{Name: "annotations"}
+	if p != nil {
+		annotated = *p
+	}
+	if hasRetention {
+		n, err := strconv.Atoi(retention)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidBackupPolicy, AnnotationBackupRetention, err)
+		}
+		annotated.Retention = n
+	}
+	if hasChangeRate {
+		f, err := strconv.ParseFloat(changeRate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidBackupPolicy, AnnotationBackupChangeRate, err)
+		}
+		annotated.ChangeRate = f
+	}
+	if err := annotated.validate(); err != nil {
+		return nil, err
+	}
+	return &annotated, nil
+}
+
+// SnapshotGiB returns the storage of the snapshots of the persistent
+// volumes of the requirements, in GiB: a full snapshot, and the changes
+// kept by each other one.
+func (p BackupPolicy) SnapshotGiB(r Requirements) float64 {
+	changeRate := p.ChangeRate
+	if changeRate == 0 {
+		changeRate = defaultChangeRate
+	}
+	volume := utils.BytesToGiB(r.TotalPersistentVolume())
+	return volume * (1 + float64(p.Retention-1)*changeRate)
+}
+
+// CostForPeriod returns the cost of the snapshots of the requirements over
+// the period, at the price of the policy or else of persistent volumes.
+func (p BackupPolicy) CostForPeriod(period Period, r Requirements, cm *CostModel) float64 {
+	if p.USDPerGiBMonth > 0 {
+		return p.SnapshotGiB(r) * p.USDPerGiBMonth * float64(period) / Monthly
+	}
+	return p.SnapshotGiB(r) * cm.PersistentVolume.Dollars * float64(period)
+}
+
+// WorkloadBackups are the backup policies of a workload before and after
+// the change, nil where it isn't backed up.
+type WorkloadBackups struct {
+	From, To *BackupPolicy
+}
+
+// AddBackups sets the backup policies of the workloads with persistent
+// volumes in the reports added so far, to report the cost of their
+// snapshots. The policies are read from the workload annotations, then
+// matched from the backups before and after the change, which may be nil;
+// invalid annotations are added as warnings.
+func (r *Reporter) AddBackups(from, to *Backups) {
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil ||
+			(m.From.PersistentVolumePerPod == 0 && m.To.PersistentVolumePerPod == 0) {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		backups := WorkloadBackups{
+			From: r.backupPolicy(from, cluster, m.From),
+			To:   r.backupPolicy(to, cluster, m.To),
+		}
+		if backups.From != nil || backups.To != nil {
+			r.reports[i].backups = &backups
+		}
+	}
+}
+
+// backupPolicy returns the backup policy of the workload of a cluster, or
+// nil with a warning if its annotations are invalid.
+func (r *Reporter) backupPolicy(b *Backups, cluster string, req Requirements) *BackupPolicy {
+	if req.Kind == "" {
+		return nil
+	}
+	p, err := b.policy(cluster, req)
+	if err != nil {
+		r.AddWarning(fmt.Sprintf("backup policy of %s/%s/%s on %s: %v",
+			req.Namespace, req.Kind, req.Name, cluster, err))
+		return nil
+	}
+	return p
+}
+
+// backupCosts returns the snapshot cost of the report over the period
+// before and after the change, zero where it isn't backed up.
+func backupCosts(m report, p Period) (float64, float64) {
+	if m.backups == nil {
+		return 0, 0
+	}
+	var from, to float64
+	if m.backups.From != nil {
+		from = m.backups.From.CostForPeriod(p, m.From, m.CostModel)
+	}
+	if m.backups.To != nil {
+		to = m.backups.To.CostForPeriod(p, m.To, m.CostModel)
+	}
+	return from, to
+}
+
+// backupTotals returns the total snapshot cost over the main period before
+// and after the change, and whether any workload is backed up.
+func (r *Reporter) backupTotals() (float64, float64, bool) {
+	var from, to float64
+	var ok bool
+	for _, m := range r.reports {
+		if m.backups == nil {
+			continue
+		}
+		f, t := backupCosts(m, r.mainPeriod())
+		from += f
+		to += t
+		ok = true
+	}
+	return from, to, ok
+}
+
+// backupTotalLines returns the line of the total snapshot cost over the
+// main period, if any workload is backed up.
+func (r *Reporter) backupTotalLines() []string {
+	from, to, ok := r.backupTotals()
+	if !ok {
+		return nil
+	}
+	return []string{fmt.Sprintf("Total %s Snapshot Storage Cost went from %s to %s.",
+		r.mainPeriod().Title(), r.currency.Format(from), r.currency.Format(to))}
+}
@@ -0,0 +1,253 @@
+package costmodel
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBackups(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr error
+	}{
+		{
+			name: "valid",
+			src: `policies:
+  - name: velero-daily
+    cluster: prod-*
+    labels: {backup: daily}
+    retention: 7
+    change_rate: 0.05
+    usd_per_gib_month: 0.026
+  - name: snapshots
+    namespace: db-*
+    retention: 3
+`,
+		},
+		{name: "missing name", src: "policies: [{retention: 1}]", wantErr: ErrInvalidBackupPolicy},
+		{name: "no retention", src: "policies: [{name: p}]", wantErr: ErrInvalidBackupPolicy},
+		{name: "change rate above 1", src: "policies: [{name: p, retention: 1, change_rate: 2}]", wantErr: ErrInvalidBackupPolicy},
+		{name: "negative price", src: "policies: [{name: p, retention: 1, usd_per_gib_month: -1}]", wantErr: ErrInvalidBackupPolicy},
+		{name: "bad glob", src: "policies: [{name: p, retention: 1, namespace: '['}]", wantErr: ErrInvalidBackupPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "backups.yaml")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("writing backup policies: %v", err)
+			}
+
+			got, err := LoadBackups(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got.Policies) != 2 {
+				t.Errorf("expecting 2 policies, got %+v", got.Policies)
+			}
+		})
+	}
+}
+
+func TestBackups_policy(t *testing.T) {
+	b := &Backups{Policies: []BackupPolicy{
+		{Name: "velero-daily", Cluster: "prod-*", Labels: map[string]string{"backup": "daily"}, Retention: 7},
+		{Name: "snapshots", Namespace: "db-*", Retention: 3},
+	}}
+	tests := []struct {
+		name    string
+		b       *Backups
+		cluster string
+		req     Requirements
+		want    *BackupPolicy
+		wantErr error
+	}{
+		{name: "labels", b: b, cluster: "prod-eu", req: Requirements{Namespace: "ns", Labels: map[string]string{"backup": "daily"}}, want: &b.Policies[0]},
+		{name: "namespace", b: b, cluster: "dev", req: Requirements{Namespace: "db-1", Labels: map[string]string{"backup": "daily"}}, want: &b.Policies[1]},
+		{name: "not backed up", b: b, cluster: "dev", req: Requirements{Namespace: "ns"}},
+		{name: "no policies", cluster: "dev", req: Requirements{Namespace: "db-1"}},
+		{name: "named", b: b, cluster: "dev", req: Requirements{Namespace: "ns", Annotations: map[string]string{AnnotationBackupPolicy: "velero-daily"}}, want: &b.Policies[0]},
+		{name: "unknown name", b: b, cluster: "dev", req: Requirements{Annotations: map[string]string{AnnotationBackupPolicy: "nope"}}, wantErr: ErrInvalidBackupPolicy},
+		{
+			name: "annotated retention overrides policy", b: b, cluster: "dev",
+			req:  Requirements{Namespace: "db-1", Annotations: map[string]string{AnnotationBackupRetention: "14"}},
+			want: &BackupPolicy{Name: "snapshots", Namespace: "db-*", Retention: 14},
+		},
+		{
+			name: "annotations only", cluster: "dev",
+			req:  Requirements{Annotations: map[string]string{AnnotationBackupRetention: "2", AnnotationBackupChangeRate: "0.5"}},
+			want: &BackupPolicy{Name: "annotations", Retention: 2, ChangeRate: 0.5},
+		},
+		{name: "bad retention", cluster: "dev", req: Requirements{Annotations: map[string]string{AnnotationBackupRetention: "weekly"}}, wantErr: ErrInvalidBackupPolicy},
+		{name: "change rate without retention", cluster: "dev", req: Requirements{Annotations: map[string]string{AnnotationBackupChangeRate: "0.5"}}, wantErr: ErrInvalidBackupPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.b.policy(tt.cluster, tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && (got.Name != tt.want.Name || got.Retention != tt.want.Retention || got.ChangeRate != tt.want.ChangeRate)) {
+				t.Errorf("expecting %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseBackups(t *testing.T) {
+	src := `apiVersion: velero.io/v1
+kind: Schedule
+metadata: {name: daily, namespace: velero}
+spec:
+  schedule: 0 1 * * *
+  template:
+    includedNamespaces: [db, cache]
+    labelSelector: {matchLabels: {backup: daily}}
+    ttl: 168h0m0s
+---
+apiVersion: velero.io/v1
+kind: Schedule
+metadata: {name: no-volumes, namespace: velero}
+spec:
+  schedule: '@hourly'
+  template: {snapshotVolumes: false}
+---
+apiVersion: snapshot.storage.k8s.io/v1
+kind: VolumeSnapshot
+metadata: {name: data-wk-0-monday, namespace: db}
+spec: {volumeSnapshotClassName: csi, source: {persistentVolumeClaimName: data-wk-0}}
+---
+apiVersion: snapshot.storage.k8s.io/v1
+kind: VolumeSnapshot
+metadata: {name: data-wk-0-tuesday, namespace: db}
+spec: {volumeSnapshotClassName: csi, source: {persistentVolumeClaimName: data-wk-0}}
+---
+apiVersion: snapshot.storage.k8s.io/v1
+kind: VolumeSnapshot
+metadata: {name: data-wk-1-monday, namespace: db}
+spec: {volumeSnapshotClassName: csi, source: {persistentVolumeClaimName: data-wk-1}}
+---
+apiVersion: snapshot.storage.k8s.io/v1
+kind: VolumeSnapshotClass
+metadata:
+  name: csi
+  annotations: {kost.grafana.com/backup-change-rate: "0.2"}
+driver: pd.csi.storage.gke.io
+deletionPolicy: Delete
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: unrelated}
+`
+	b, err := ParseBackups([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A daily backup kept for 7 days, for each included namespace.
+	if len(b.Policies) != 2 {
+		t.Fatalf("expecting a policy per namespace of the daily schedule, got %+v", b.Policies)
+	}
+	for i, ns := range []string{"db", "cache"} {
+		if p := b.Policies[i]; p.Name != "velero/daily" || p.Namespace != ns || p.Retention != 7 || p.Labels["backup"] != "daily" {
+			t.Errorf("unexpected policy %+v", p)
+		}
+	}
+
+	sts := Requirements{Kind: "StatefulSet", Namespace: "db", Name: "wk"}
+	if p, err := b.InCluster("prod").policy("prod", sts); err != nil || p == nil || p.Name != "volumesnapshots" || p.Retention != 2 || p.ChangeRate != 0.2 {
+		t.Errorf("expecting the 2 snapshots of data-wk-0, got %+v, %v", p, err)
+	}
+	if p := b.InCluster("prod").snapshotPolicy("dev", sts); p != nil {
+		t.Errorf("expecting the snapshots of another cluster not to match, got %+v", p)
+	}
+
+	// The backups configuration overrides the manifests.
+	file := &Backups{Policies: []BackupPolicy{{Name: "file", Namespace: "db", Retention: 3}}}
+	if p, _ := MergeBackups(file, b).policy("prod", Requirements{Namespace: "db", Labels: map[string]string{"backup": "daily"}}); p == nil || p.Name != "file" {
+		t.Errorf("expecting the policy of the file, got %+v", p)
+	}
+
+	if _, err := ParseBackups([]byte("apiVersion: velero.io/v1\nkind: Schedule\nmetadata: {name: bad}\nspec: {schedule: daily}\n")); !errors.Is(err, ErrInvalidBackupPolicy) {
+		t.Errorf("expecting ErrInvalidBackupPolicy for an invalid schedule, got %v", err)
+	}
+}
+
+func TestBackupPolicy_CostForPeriod(t *testing.T) {
+	cm := &CostModel{PersistentVolume: Cost{Dollars: 0.001}}
+	req := Requirements{PersistentVolumePerPod: 100 * gib, Replicas: 2}
+
+	// 200 GiB, and 10% of it kept by each of the 6 other snapshots.
+	p := BackupPolicy{Retention: 7}
+	if got := p.SnapshotGiB(req); !feq(got, 320) {
+		t.Errorf("expecting 320 GiB, got %v", got)
+	}
+	if got := p.CostForPeriod(Monthly, req, cm); !feq(got, 320*0.001*720) {
+		t.Errorf("expecting the price of persistent volumes, got %v", got)
+	}
+	p.USDPerGiBMonth = 0.05
+	if got := p.CostForPeriod(Weekly, req, cm); !feq(got, 320*0.05*168/720) {
+		t.Errorf("expecting the price of the policy, got %v", got)
+	}
+}
+
+func TestReporter_AddBackups(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod"}, CPU: Cost{NonSpot: 1}, PersistentVolume: Cost{Dollars: 0.001}}
+	from := Requirements{CPUPerPod: 1000, PersistentVolumePerPod: 100 * gib, Replicas: 2, Kind: "StatefulSet", Namespace: "db", Name: "wk"}
+	to := from
+	to.Annotations = map[string]string{AnnotationBackupRetention: "7"}
+	volumeless := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "db", Name: "volumeless"}
+	broken := from
+	broken.Name = "broken"
+	broken.Annotations = map[string]string{AnnotationBackupPolicy: "nope"}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.AddReport(prod, volumeless, volumeless)
+		r.AddReport(prod, broken, broken)
+		r.AddBackups(nil, nil)
+		return r
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		if b := r.reports[0].backups; b == nil || b.From != nil || b.To == nil || b.To.Retention != 7 {
+			t.Errorf("expecting wk to be backed up after the change, got %+v", b)
+		}
+		if r.reports[1].backups != nil || r.reports[2].backups != nil {
+			t.Errorf("expecting no backups for the other workloads, got %+v", r.reports)
+		}
+		want := `backup policy of db/StatefulSet/broken on prod: invalid backup policy: unknown policy "nope"`
+		if len(r.warnings) != 2 || r.warnings[0] != want {
+			t.Errorf("expecting a warning for each side of broken, got %v", r.warnings)
+		}
+	})
+
+	// 320 GiB of snapshots at $0.001 per GiB-hour.
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary:  {"Total Monthly Snapshot Storage Cost went from $0.00 to $230.40.\n"},
+		Markdown: {":floppy_disk: Monthly snapshot storage cost will go from $0.00 to $230.40 ($230.40)."},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		if b := newReporter.writeJSON(t).Workloads[0].Backups; b == nil || b.FromPolicy != "" || b.ToPolicy != "annotations" || !feq(b.To, 230.4) {
+			t.Errorf("unexpected backups %+v", b)
+		}
+	})
+}
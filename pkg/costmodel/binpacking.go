@@ -0,0 +1,360 @@
+package costmodel
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/kost/pkg/costmodel/utils"
+)
+
+const (
+	// queryNodeAllocatable reports the allocatable amount of a resource of each node of a cluster.
+	// Format args: cluster, resource.
+	queryNodeAllocatable = `max by (node) (kube_node_status_allocatable{cluster="%s", resource="%s"})`
+
+	// queryNodeHourlyCost reports the hourly price of each node of a cluster, from the
+	// per-instance series of the cloudcost-exporter whose instance label is the node name.
+	// Format args: cluster, cluster, cluster.
+	queryNodeHourlyCost = `
+	max by (node) (label_replace(
+		cloudcost_aws_ec2_instance_total_usd_per_hour{cluster_name="%s"}
+		or
+		cloudcost_azure_aks_instance_total_usd_per_hour{cluster_name="%s"}
+		or
+		cloudcost_gcp_gke_instance_total_usd_per_hour{cluster_name="%s"},
+		"node", "$1", "instance", "(.+)"
+	))
+`
+)
+
+// NodeShape is the allocatable resources of the nodes of a node pool, how
+// many nodes have them and their price. CPU is in cores and memory in
+// bytes.
+type NodeShape struct {
+	// Pool is the node pool of the nodes, empty if they have no node pool
+	// label, see nodePoolLabels.
+	Pool   string
+	CPU    float64
+	Memory float64
+	Count  int
+	// HourlyCost is the average price of a node per hour, in US dollars,
+	// zero if none of the nodes is priced.
+	HourlyCost float64
+}
+
+// String describes the shape, e.g. 16 CPU, 64 GiB nodes of pool general.
+func (s NodeShape) String() string {
+	str := fmt.Sprintf("%s CPU, %s GiB nodes", formatAmount(s.CPU), formatAmount(utils.BytesToGiB(int64(s.Memory))))
+	if s.Pool != "" {
+		str += " of pool " + s.Pool
+	}
+	return str
+}
+
+func (s NodeShape) poolName() string {
+	return s.Pool
+}
+
+// PodsPerNode returns how many pods of the requirements fit on a node of
+// the shape, by CPU and memory. It is zero if a pod doesn't fit.
+func (s NodeShape) PodsPerNode(r Requirements) int {
+	fit := math.Inf(1)
+	if r.CPUPerPod > 0 {
+		fit = min(fit, s.CPU*1000/float64(r.CPUPerPod))
+	}
+	if r.MemoryPerPod > 0 {
+		fit = min(fit, s.Memory/float64(r.MemoryPerPod))
+	}
+	if math.IsInf(fit, 1) {
+		return math.MaxInt
+	}
+	return int(fit)
+}
+
+// NodeShapeQuerier is the subset of *Client behavior Reporter.AddNodeShapes needs.
+type NodeShapeQuerier interface {
+	GetNodeShapes(ctx context.Context, cluster string) ([]NodeShape, error)
+}
+
+var (
+	_ NodeShapeQuerier = (*Client)(nil)
+	_ NodeShapeQuerier = (*Clients)(nil)
+)
+
+// GetNodeShapes returns the most common shape of the nodes of each node pool of a
+// cluster, the largest pool first, from their labels and allocatable resources in
+// kube-state-metrics. Nodes are grouped by their node pool label like GetNodePools,
+// and priced from the per-instance series of the cloudcost-exporter. Returns
+// ErrNoResults if the cluster has no node.
+func (c *Client) GetNodeShapes(ctx context.Context, cluster string) ([]NodeShape, error) {
+	vec, err := c.queryVectorNow(ctx, fmt.Sprintf(queryNodeLabels, cluster))
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]model.Metric, len(vec))
+	for _, s := range vec {
+		labels[string(s.Metric["node"])] = s.Metric
+	}
+
+	perNode := make(map[string]map[string]float64)
+	for _, q := range []struct{ name, query string }{
+		{"cpu", fmt.Sprintf(queryNodeAllocatable, cluster, "cpu")},
+		{"memory", fmt.Sprintf(queryNodeAllocatable, cluster, "memory")},
+		{"price", fmt.Sprintf(queryNodeHourlyCost, cluster, cluster, cluster)},
+	} {
+		if perNode[q.name], err = c.queryByNode(ctx, q.query); err != nil {
+			return nil, err
+		}
+	}
+
+	// The nodes of each shape of each pool, and the price of those priced.
+	type priced struct {
+		count, priced int
+		price         float64
+	}
+	pools := make(map[string]map[NodeShape]*priced)
+	sizes := make(map[string]int)
+	for node, cpu := range perNode["cpu"] {
+		memory, ok := perNode["memory"][node]
+		if !ok {
+			continue
+		}
+		pool := firstLabel(labels[node], nodePoolLabels)
+		if pools[pool] == nil {
+			pools[pool] = make(map[NodeShape]*priced)
+		}
+		shape := NodeShape{Pool: pool, CPU: cpu, Memory: memory}
+		n, ok := pools[pool][shape]
+		if !ok {
+			n = &priced{}
+			pools[pool][shape] = n
+		}
+		n.count++
+		sizes[pool]++
+		if price, ok := perNode["price"][node]; ok {
+			n.priced++
+			n.price += price
+		}
+	}
+	if len(pools) == 0 {
+		return nil, ErrNoResults
+	}
+
+	shapes := make([]NodeShape, 0, len(pools))
+	for _, counts := range pools {
+		var best NodeShape
+		for s, n := range counts {
+			s.Count = n.count
+			if n.priced > 0 {
+				s.HourlyCost = n.price / float64(n.priced)
+			}
+			if cmp.Or(cmp.Compare(s.Count, best.Count), cmp.Compare(s.CPU, best.CPU), cmp.Compare(s.Memory, best.Memory)) > 0 {
+				best = s
+			}
+		}
+		shapes = append(shapes, best)
+	}
+	slices.SortFunc(shapes, func(a, b NodeShape) int {
+		return cmp.Or(cmp.Compare(sizes[b.Pool], sizes[a.Pool]), cmp.Compare(a.Pool, b.Pool))
+	})
+	return shapes, nil
+}
+
+// WorkloadShapes are the shapes of the nodes a workload is bin-packed onto
+// before and after the change, nil where it doesn't exist.
+type WorkloadShapes struct {
+	From, To *NodeShape
+}
+
+// AddNodeShapes queries the node shapes of the clusters of the reports added
+// so far, to report their cost bin-packed onto the nodes of the pool they are
+// scheduled on, see poolOf, next to the linear cost. Failed queries and pools
+// whose nodes aren't priced are added as warnings, and the linear cost is used
+// for their workloads.
+func (r *Reporter) AddNodeShapes(ctx context.Context, q NodeShapeQuerier) {
+	shapes := make(map[string][]NodeShape)
+	unpriced := make(map[string]bool)
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		ss, ok := shapes[cluster]
+		if !ok {
+			var err error
+			if ss, err = q.GetNodeShapes(ctx, cluster); err != nil {
+				r.AddWarning(fmt.Sprintf("querying node shapes of %s: %v", cluster, err))
+			}
+			shapes[cluster] = ss
+		}
+
+		// A workload is bin-packed only if each of its sides is.
+		shape := func(req Requirements) (*NodeShape, bool) {
+			if req.Kind == "" {
+				return nil, true
+			}
+			i := poolOf(ss, req)
+			if i < 0 {
+				return nil, false
+			}
+			if ss[i].HourlyCost == 0 {
+				if key := cluster + "/" + ss[i].Pool; !unpriced[key] {
+					unpriced[key] = true
+					r.AddWarning(fmt.Sprintf("no instance price for %s on %s, the linear cost of its workloads is used", ss[i], cluster))
+				}
+				return nil, false
+			}
+			return &ss[i], true
+		}
+		from, fromOK := shape(m.From)
+		to, toOK := shape(m.To)
+		if fromOK && toOK {
+			r.reports[i].nodeShapes = &WorkloadShapes{From: from, To: to}
+		}
+	}
+}
+
+// BinPacked is the cost of a workload bin-packed onto nodes of a shape over
+// a period, in US dollars: the nodes its pods fill, priced by node, and its
+// persistent volumes. Other workloads are assumed to fill the rest of the
+// last node.
+type BinPacked struct {
+	Cost  float64
+	Nodes float64
+	// Fits is false if a pod doesn't fit on a node, the linear cost being
+	// used instead.
+	Fits bool
+}
+
+// binPackedCost returns the cost of the requirements bin-packed onto
+// nodes of the shape over the period, at the price of its nodes.
+func binPackedCost(cm *CostModel, shape NodeShape, r Requirements, p Period) BinPacked {
+	pv := cm.PersistentVolume.DollarsForPeriod(p, r.TotalPersistentVolume())
+	if r.Replicas == 0 {
+		return BinPacked{Cost: pv, Fits: true}
+	}
+	perNode := shape.PodsPerNode(r)
+	if perNode == 0 {
+		return BinPacked{Cost: cm.TotalCostForPeriod(p, r)}
+	}
+	if perNode == math.MaxInt {
+		return BinPacked{Cost: pv, Fits: true}
+	}
+	nodes := float64(r.Replicas) / float64(perNode)
+	return BinPacked{
+		Cost:  nodes*shape.HourlyCost*float64(p) + pv,
+		Nodes: nodes,
+		Fits:  true,
+	}
+}
+
+// binPackedCosts returns the cost of the report bin-packed over the
+// period before and after the change, and whether it was bin-packed.
+func binPackedCosts(m report, p Period) (BinPacked, BinPacked, bool) {
+	if m.nodeShapes == nil {
+		from, to := calculateTotalCostForPeriod(p, m.From, m.To, m.CostModel)
+		return BinPacked{Cost: from}, BinPacked{Cost: to}, false
+	}
+	cost := func(shape *NodeShape, r Requirements) BinPacked {
+		if shape == nil {
+			return BinPacked{Fits: true}
+		}
+		return binPackedCost(m.CostModel, *shape, r, p)
+	}
+	return cost(m.nodeShapes.From, m.From), cost(m.nodeShapes.To, m.To), true
+}
+
+// shape returns the shape the workload of the report is bin-packed onto,
+// the shape after the change unless it removes the workload.
+func (s WorkloadShapes) shape() *NodeShape {
+	if s.To == nil {
+		return s.From
+	}
+	return s.To
+}
+
+// binPacking returns the shapes each cluster was bin-packed onto, by
+// pool, or nil if node shapes weren't added.
+func (r *Reporter) binPacking() map[string][]NodeShape {
+	var shapes map[string][]NodeShape
+	for _, m := range r.reports {
+		if m.nodeShapes == nil {
+			continue
+		}
+		if shapes == nil {
+			shapes = make(map[string][]NodeShape)
+		}
+		cluster := m.CostModel.Cluster.Name
+		for _, s := range []*NodeShape{m.nodeShapes.From, m.nodeShapes.To} {
+			if s != nil && !slices.Contains(shapes[cluster], *s) {
+				shapes[cluster] = append(shapes[cluster], *s)
+			}
+		}
+	}
+	for _, ss := range shapes {
+		slices.SortFunc(ss, func(a, b NodeShape) int { return cmp.Compare(a.Pool, b.Pool) })
+	}
+	return shapes
+}
+
+// binPackedTotals returns the total bin-packed cost over the main period
+// before and after the change.
+func (r *Reporter) binPackedTotals() (float64, float64) {
+	var from, to float64
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+		f, t, _ := binPackedCosts(m, r.mainPeriod())
+		from += f.Cost
+		to += t.Cost
+	}
+	return from, to
+}
+
+// binPackingWarnings returns a warning per workload whose pods don't fit
+// on the nodes of its cluster.
+func (r *Reporter) binPackingWarnings() []string {
+	var warnings []string
+	for _, m := range r.reports {
+		if m.nodeShapes == nil || m.nodeShapes.To == nil {
+			continue
+		}
+		if t := binPackedCost(m.CostModel, *m.nodeShapes.To, m.To, r.mainPeriod()); !t.Fits {
+			warnings = append(warnings, fmt.Sprintf("%s/%s/%s on %s doesn't fit on %s, its linear cost is used",
+				m.To.Namespace, m.To.Kind, m.To.Name, m.CostModel.Cluster.Name, m.nodeShapes.To))
+		}
+	}
+	return warnings
+}
+
+// binPackedTotalLines returns the lines of the total bin-packed cost over
+// the main period, the shapes of each cluster and the bin-packing warnings.
+func (r *Reporter) binPackedTotalLines() []string {
+	shapes := r.binPacking()
+	if shapes == nil {
+		return nil
+	}
+
+	from, to := r.binPackedTotals()
+	lines := []string{fmt.Sprintf("Total %s Cost bin-packed onto nodes went from %s to %s.",
+		r.mainPeriod().Title(), r.currency.Format(from), r.currency.Format(to))}
+	for _, c := range slices.Sorted(maps.Keys(shapes)) {
+		names := make([]string, 0, len(shapes[c]))
+		for _, s := range shapes[c] {
+			names = append(names, s.String())
+		}
+		lines = append(lines, fmt.Sprintf("Workloads on cluster %s were bin-packed onto %s.", c, strings.Join(names, ", ")))
+	}
+	for _, w := range r.binPackingWarnings() {
+		lines = append(lines, w+".")
+	}
+	return lines
+}
@@ -0,0 +1,209 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type fakeNodeShapeQuerier map[string][]NodeShape
+
+func (f fakeNodeShapeQuerier) GetNodeShapes(_ context.Context, cluster string) ([]NodeShape, error) {
+	s, ok := f[cluster]
+	if !ok {
+		return nil, errors.New("boom")
+	}
+	return s, nil
+}
+
+func TestNodeShape_PodsPerNode(t *testing.T) {
+	shape := NodeShape{CPU: 4, Memory: 16 * gib}
+
+	tests := []struct {
+		name string
+		req  Requirements
+		want int
+	}{
+		{"cpu bound", Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib}, 4},
+		{"memory bound", Requirements{CPUPerPod: 100, MemoryPerPod: 5 * gib}, 3},
+		{"nearly a node", Requirements{CPUPerPod: 100, MemoryPerPod: 15 * gib}, 1},
+		{"too big", Requirements{CPUPerPod: 100, MemoryPerPod: 32 * gib}, 0},
+		{"no requests", Requirements{}, math.MaxInt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shape.PodsPerNode(tt.req); got != tt.want {
+				t.Errorf("expecting %d pods per node, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBinPackedCost(t *testing.T) {
+	cm := &CostModel{CPU: Cost{NonSpot: 1}, RAM: Cost{NonSpot: 1}}
+	shape := NodeShape{CPU: 4, Memory: 16 * gib, HourlyCost: 20}
+
+	tests := []struct {
+		name  string
+		req   Requirements
+		cost  float64
+		nodes float64
+		fits  bool
+	}{
+		{"fills nodes", Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib, Replicas: 6}, 1.5 * 20 * 720, 1.5, true},
+		{"whole node", Requirements{CPUPerPod: 100, MemoryPerPod: 15 * gib, Replicas: 1}, 20 * 720, 1, true},
+		{"doesn't fit", Requirements{MemoryPerPod: 32 * gib, Replicas: 1}, 32 * 720, 0, false},
+		{"no replicas", Requirements{CPUPerPod: 1000}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := binPackedCost(cm, shape, tt.req, Monthly)
+			if !feq(got.Cost, tt.cost) || !feq(got.Nodes, tt.nodes) || got.Fits != tt.fits {
+				t.Errorf("expecting %v, %v nodes, fits %v, got %+v", tt.cost, tt.nodes, tt.fits, got)
+			}
+		})
+	}
+}
+
+func TestClient_GetNodeShapes(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		q := r.Form.Get("query")
+		switch {
+		case strings.Contains(q, `cluster="empty"`) || strings.Contains(q, `cluster_name="empty"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case strings.Contains(q, "kube_node_labels"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a","label_cloud_google_com_gke_nodepool":"general"},"value":[0,"1"]},
+				{"metric":{"node":"b","label_cloud_google_com_gke_nodepool":"general"},"value":[0,"1"]},
+				{"metric":{"node":"c","label_cloud_google_com_gke_nodepool":"general"},"value":[0,"1"]},
+				{"metric":{"node":"d","label_cloud_google_com_gke_nodepool":"highmem"},"value":[0,"1"]}]}}`)
+		case strings.Contains(q, `resource="cpu"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a"},"value":[0,"4"]},
+				{"metric":{"node":"b"},"value":[0,"4"]},
+				{"metric":{"node":"c"},"value":[0,"8"]},
+				{"metric":{"node":"d"},"value":[0,"8"]},
+				{"metric":{"node":"e"},"value":[0,"8"]}]}}`)
+		case strings.Contains(q, `resource="memory"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a"},"value":[0,"17179869184"]},
+				{"metric":{"node":"b"},"value":[0,"17179869184"]},
+				{"metric":{"node":"c"},"value":[0,"34359738368"]},
+				{"metric":{"node":"d"},"value":[0,"68719476736"]}]}}`)
+		case strings.Contains(q, "instance_total_usd_per_hour"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"node":"a"},"value":[0,"0.2"]},
+				{"metric":{"node":"b"},"value":[0,"0.4"]},
+				{"metric":{"node":"c"},"value":[0,"0.8"]}]}}`)
+		default:
+			t.Errorf("unexpected query %s", q)
+		}
+	})
+
+	shapes, err := c.GetNodeShapes(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	// The most common shape of each pool, priced at the average price of its
+	// nodes, the largest pool first.
+	want := []NodeShape{
+		{Pool: "general", CPU: 4, Memory: 16 * gib, Count: 2, HourlyCost: 0.3},
+		{Pool: "highmem", CPU: 8, Memory: 64 * gib, Count: 1},
+	}
+	if len(shapes) != len(want) {
+		t.Fatalf("expecting %+v, got %+v", want, shapes)
+	}
+	for i := range want {
+		if got := shapes[i]; got.Pool != want[i].Pool || got.CPU != want[i].CPU || got.Memory != want[i].Memory || got.Count != want[i].Count || !feq(got.HourlyCost, want[i].HourlyCost) {
+			t.Errorf("expecting %+v, got %+v", want[i], got)
+		}
+	}
+	if shapes[0].String() != "4 CPU, 16 GiB nodes of pool general" {
+		t.Errorf("expecting 4 CPU, 16 GiB nodes of pool general, got %s", shapes[0])
+	}
+
+	if _, err := c.GetNodeShapes(context.Background(), "empty"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without nodes, got %v", err)
+	}
+}
+
+func TestReporter_AddNodeShapes(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod"}, CPU: Cost{NonSpot: 1}, RAM: Cost{NonSpot: 1}}
+	dev := &CostModel{Cluster: &Cluster{Name: "dev"}, CPU: Cost{NonSpot: 1}, RAM: Cost{NonSpot: 1}}
+	from := Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib, Replicas: 4, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 6
+	big := Requirements{MemoryPerPod: 32 * gib, Replicas: 1, Kind: "StatefulSet", Namespace: "ns", Name: "big"}
+	// moved moves from the default pool to the large one.
+	moved := Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "moved"}
+	movedTo := moved
+	movedTo.Replicas = 4
+	movedTo.NodeSelector = map[string]string{"cloud.google.com/gke-nodepool": "large"}
+	unpriced := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "unpriced", NodeSelector: map[string]string{"agentpool": "highmem"}}
+	q := fakeNodeShapeQuerier{"prod": {
+		{Pool: "general", CPU: 4, Memory: 16 * gib, Count: 3, HourlyCost: 20},
+		{Pool: "large", CPU: 8, Memory: 64 * gib, Count: 2, HourlyCost: 40},
+		{Pool: "highmem", CPU: 8, Memory: 32 * gib, Count: 1},
+	}}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.AddReport(prod, big, big)
+		r.AddReport(prod, moved, movedTo)
+		r.AddReport(prod, unpriced, unpriced)
+		r.AddReport(dev, from, from)
+		r.AddNodeShapes(context.Background(), q)
+		return r
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		want := []string{
+			"no instance price for 8 CPU, 32 GiB nodes of pool highmem on prod, the linear cost of its workloads is used",
+			"querying node shapes of dev: boom",
+		}
+		if !slices.Equal(r.warnings, want) {
+			t.Errorf("expecting warnings %q, got %q", want, r.warnings)
+		}
+		if r.reports[2].nodeShapes == nil || r.reports[2].nodeShapes.From.Pool != "general" || r.reports[2].nodeShapes.To.Pool != "large" {
+			t.Errorf("expecting moved to be bin-packed onto general then large, got %+v", r.reports[2].nodeShapes)
+		}
+		for _, i := range []int{3, 4} {
+			if r.reports[i].nodeShapes != nil {
+				t.Errorf("expecting %s not to be bin-packed, got %+v", r.reports[i].To.Name, r.reports[i].nodeShapes)
+			}
+		}
+	})
+
+	// moved goes from a quarter of a general node to half a large one, while
+	// unpriced keeps its linear cost, 720, and dev too, 4 × 3 × 720.
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary: {
+			"Total Monthly Cost bin-packed onto nodes went from $50400.00 to $68400.00.\n",
+			"Workloads on cluster prod were bin-packed onto 4 CPU, 16 GiB nodes of pool general, 8 CPU, 64 GiB nodes of pool large.\n",
+			"ns/StatefulSet/big on prod doesn't fit on 4 CPU, 16 GiB nodes of pool general, its linear cost is used.\n",
+		},
+		Table:    {"Bin-Packed Monthly Cost", "$21600.00"},
+		Markdown: {"Bin-packed onto the nodes of each cluster, monthly cost will go from $50400.00 to $68400.00 ($18000.00)."},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		b := got.Workloads[0].BinPacked
+		if b == nil || !feq(b.From, 14400) || !feq(b.To, 21600) || !feq(b.NodesTo, 1.5) || b.NodeShape != "4 CPU, 16 GiB nodes of pool general" {
+			t.Errorf("unexpected bin-packed cost %+v", b)
+		}
+		if got.Workloads[4].BinPacked != nil {
+			t.Errorf("expecting dev not to be bin-packed, got %+v", got.Workloads[4].BinPacked)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package costmodel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrCacheMiss is returned by a Cache when it has no fresh cost model for
+// the given key.
+var ErrCacheMiss = errors.New("cost model not in cache")
+
+// Cache stores cost models between runs, so that clusters whose prices
+// were fetched recently don't need to be queried again.
+type Cache interface {
+	// Get returns the cost model stored for key, or ErrCacheMiss if
+	// there is none or it expired.
+	Get(key string) (*CostModel, error)
+	// Set stores the cost model for key.
+	Set(key string, cm *CostModel) error
+}
+
+// CacheKey returns the key a cluster's cost model is cached under. The
+// backend is part of the key since the same cluster name could exist in
+// different Prometheus tenants.
+func CacheKey(backend, cluster string) string {
+	return backend + "|" + cluster
+}
+
+// FileCache is a Cache storing each cost model as a JSON file in a
+// directory. The directory can be persisted between CI runs.
+type FileCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// cacheEntry is the content of a FileCache file.
+type cacheEntry struct {
+	Key       string
+	CostModel *CostModel
+}
+
+// NewFileCache creates a FileCache in dir, creating the directory if
+// needed. Cost models older than ttl are considered expired.
+func NewFileCache(dir string, ttl time.Duration) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &FileCache{dir: dir, ttl: ttl}, nil
+}
+
+func (c *FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get implements Cache.
+func (c *FileCache) Get(key string) (*CostModel, error) {
+	src, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrCacheMiss
+	} else if err != nil {
+		return nil, fmt.Errorf("reading cache: %w", err)
+	}
+
+	var e cacheEntry
+	if err := json.Unmarshal(src, &e); err != nil {
+		return nil, fmt.Errorf("decoding cache: %w", err)
+	}
+
+	if e.Key != key || e.CostModel == nil || time.Since(e.CostModel.FetchedAt) > c.ttl {
+		return nil, ErrCacheMiss
+	}
+
+	e.CostModel.Cached = true
+	return e.CostModel, nil
+}
+
+// Set implements Cache.
+func (c *FileCache) Set(key string, cm *CostModel) error {
+	src, err := json.Marshal(cacheEntry{Key: key, CostModel: cm})
+	if err != nil {
+		return fmt.Errorf("encoding cache: %w", err)
+	}
+
+	// Write to a temporary file first so concurrent readers never see
+	// a partially written entry.
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	if _, err := tmp.Write(src); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing cache: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// GetCachedCostModelForCluster returns the cost model of a cluster from the
+// cache if it is fresh, and otherwise fetches it with GetCostModelForCluster
+// and stores it in the cache unless it is partial. A nil cache always fetches.
+func GetCachedCostModelForCluster(ctx context.Context, client *Client, cache Cache, cluster string) (*CostModel, error) {
+	if cache == nil {
+		return GetCostModelForCluster(ctx, client, cluster)
+	}
+
+	key := client.cacheKey(cluster)
+	cm, err := cache.Get(key)
+	if err == nil {
+		return cm, nil
+	} else if !errors.Is(err, ErrCacheMiss) {
+		// A broken cache shouldn't prevent estimating costs.
+		slog.Warn("reading cost model from cache", "cluster", cluster, "error", err)
+	}
+
+	cm, err = GetCostModelForCluster(ctx, client, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	// Partial cost models are queried again next time.
+	if cm.Partial() {
+		return cm, nil
+	}
+
+	if err := cache.Set(key, cm); err != nil {
+		slog.Warn("writing cost model to cache", "cluster", cluster, "error", err)
+	}
+
+	return cm, nil
+}
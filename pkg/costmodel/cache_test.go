@@ -0,0 +1,137 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	c, err := NewFileCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error creating cache: %v", err)
+	}
+
+	key := CacheKey("http://prometheus", "prod-us-central-0")
+
+	if _, err := c.Get(key); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("expecting ErrCacheMiss on empty cache, got %v", err)
+	}
+
+	cm := &CostModel{
+		Cluster:   &Cluster{Name: "prod-us-central-0", NodeCount: 3},
+		CPU:       Cost{Spot: 1, NonSpot: 2},
+		FetchedAt: time.Now().Add(-10 * time.Minute),
+	}
+	if err := c.Set(key, cm); err != nil {
+		t.Fatalf("unexpected error writing cache: %v", err)
+	}
+
+	got, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("unexpected error reading cache: %v", err)
+	}
+	if !got.Cached {
+		t.Errorf("expecting cost model read from cache to be flagged as cached")
+	}
+	if got.Cluster.NodeCount != 3 || got.CPU != cm.CPU || !got.FetchedAt.Equal(cm.FetchedAt) {
+		t.Errorf("expecting cached cost model %+v, got %+v", cm, got)
+	}
+
+	t.Run("other backend misses", func(t *testing.T) {
+		if _, err := c.Get(CacheKey("http://other", "prod-us-central-0")); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("expecting ErrCacheMiss for another backend, got %v", err)
+		}
+	})
+
+	t.Run("expired entry misses", func(t *testing.T) {
+		cm.FetchedAt = time.Now().Add(-2 * time.Hour)
+		if err := c.Set(key, cm); err != nil {
+			t.Fatalf("unexpected error writing cache: %v", err)
+		}
+		if _, err := c.Get(key); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("expecting ErrCacheMiss for expired entry, got %v", err)
+		}
+	})
+
+	t.Run("corrupted entry errors", func(t *testing.T) {
+		if err := os.WriteFile(c.path(key), []byte("{"), 0o644); err != nil {
+			t.Fatalf("writing cache file: %v", err)
+		}
+		if _, err := c.Get(key); err == nil || errors.Is(err, ErrCacheMiss) {
+			t.Errorf("expecting decoding error, got %v", err)
+		}
+	})
+}
+
+func TestGetCachedCostModelForCluster(t *testing.T) {
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"1"]}]}}`)
+	}))
+	defer svr.Close()
+
+	client, err := NewClient(&ClientConfig{Address: svr.URL})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	cache, err := NewFileCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error creating cache: %v", err)
+	}
+
+	first, err := GetCachedCostModelForCluster(context.Background(), client, cache, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Cached {
+		t.Errorf("expecting first cost model to be queried")
+	}
+	queried := calls.Load()
+
+	second, err := GetCachedCostModelForCluster(context.Background(), client, cache, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !second.Cached {
+		t.Errorf("expecting second cost model to be cached")
+	}
+	if g := calls.Load(); g != queried {
+		t.Errorf("expecting no queries for a cached cost model, got %d", g-queried)
+	}
+}
+
+func TestReporter_CachedAges(t *testing.T) {
+	cm := &CostModel{
+		Cluster:   &Cluster{Name: "test"},
+		CPU:       Cost{NonSpot: 1},
+		FetchedAt: time.Now().Add(-90 * time.Minute),
+		Cached:    true,
+	}
+	req := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+
+	for _, rt := range []ReportType{Table, Summary, Markdown} {
+		t.Run(string(rt), func(t *testing.T) {
+			var s strings.Builder
+			r := New(&s, string(rt))
+			r.AddReport(cm, req, req)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			if !strings.Contains(s.String(), "were cached 1h30m0s ago") {
+				t.Errorf("expecting report to show the age of cached prices, got:\n%s", s.String())
+			}
+		})
+	}
+}
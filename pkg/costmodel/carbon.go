@@ -0,0 +1,274 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/grafana/kost/pkg/costmodel/utils"
+)
+
+var ErrInvalidCarbon = errors.New("invalid carbon configuration")
+
+// queryClusterRegion counts the instance prices of a cluster by region, as labeled by cloudcost-exporter.
+// Format args: cluster, cluster, cluster.
+const queryClusterRegion = `
+	count by (region) (
+		cloudcost_aws_ec2_instance_cpu_usd_per_core_hour{cluster_name="%s"}
+		or
+		cloudcost_azure_aks_instance_cpu_usd_per_core_hour{cluster_name="%s"}
+		or
+		cloudcost_gcp_gke_instance_cpu_usd_per_core_hour{cluster_name="%s"}
+)
+`
+
+// defaultPower are the power coefficients of instance families missing
+// from the carbon configuration, from the Cloud Carbon Footprint
+// methodology: the average of the minimum and maximum power of a vCPU,
+// and the power of memory and SSD storage.
+var defaultPower = PowerCoefficients{CPU: 2.49, Memory: 0.392, Storage: 0.0012}
+
+// defaultPUE is the power usage effectiveness used when the carbon
+// configuration doesn't set one.
+const defaultPUE = 1.135
+
+// PowerCoefficients are the power drawn by the resources of an instance
+// family, in watts per CPU core and per GiB of memory and storage.
+type PowerCoefficients struct {
+	CPU     float64 `json:"cpu"`
+	Memory  float64 `json:"memory"`
+	Storage float64 `json:"storage"`
+}
+
+// CarbonCluster configures the clusters matching a glob.
+type CarbonCluster struct {
+	// Cluster is a glob matching the names of the clusters, e.g. prod-eu-*.
+	Cluster string `json:"cluster"`
+	// Region is the region of the clusters, read from the labels of
+	// cloudcost-exporter if empty.
+	Region string `json:"region,omitempty"`
+	// Family is the instance family of the nodes of the clusters, e.g.
+	// n2. The default power coefficients are used if empty.
+	Family string `json:"family,omitempty"`
+}
+
+// Carbon holds the data to estimate the carbon footprint of workloads.
+type Carbon struct {
+	// Regions holds the carbon intensity of the grid of each region, in
+	// grams of CO2e per kWh.
+	Regions map[string]float64 `json:"regions"`
+	// Families holds the power coefficients of each instance family.
+	Families map[string]PowerCoefficients `json:"families,omitempty"`
+	// Clusters configures the clusters, the first matching one applying.
+	Clusters []CarbonCluster `json:"clusters,omitempty"`
+	// PUE is the power usage effectiveness of the data centers. Zero
+	// means 1.135.
+	PUE float64 `json:"pue,omitempty"`
+}
+
+// LoadCarbon reads the carbon configuration from a YAML file.
+func LoadCarbon(path string) (*Carbon, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading carbon configuration: %w", err)
+	}
+
+	var c Carbon
+	if err := yaml.UnmarshalStrict(src, &c); err != nil {
+		return nil, fmt.Errorf("parsing carbon configuration: %w", err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Carbon) validate() error {
+	for region, intensity := range c.Regions {
+		if intensity < 0 {
+			return fmt.Errorf("%w: region %s: intensity must be positive, got %v", ErrInvalidCarbon, region, intensity)
+		}
+	}
+	if c.PUE != 0 && c.PUE < 1 {
+		return fmt.Errorf("%w: pue must be at least 1, got %v", ErrInvalidCarbon, c.PUE)
+	}
+	for _, cl := range c.Clusters {
+		if _, err := path.Match(cl.Cluster, ""); err != nil {
+			return fmt.Errorf("%w: %s: cluster glob: %w", ErrInvalidCarbon, cl.Cluster, err)
+		}
+		if _, ok := c.Families[cl.Family]; cl.Family != "" && !ok {
+			return fmt.Errorf("%w: %s: unknown family %q", ErrInvalidCarbon, cl.Cluster, cl.Family)
+		}
+	}
+	return nil
+}
+
+// cluster returns the configuration of the first clusters matching the
+// name, or an empty one.
+func (c *Carbon) cluster(name string) CarbonCluster {
+	for _, cl := range c.Clusters {
+		if ok, _ := path.Match(cl.Cluster, name); ok {
+			return cl
+		}
+	}
+	return CarbonCluster{}
+}
+
+// CarbonFactors are the factors turning the resources of a cluster into
+// a carbon footprint.
+type CarbonFactors struct {
+	Region string
+	// Intensity is the carbon intensity of the grid, in grams of CO2e per
+	// kWh.
+	Intensity float64
+	Power     PowerCoefficients
+	PUE       float64
+}
+
+// Emissions returns the carbon footprint of the requirements over the
+// period, in kg of CO2e.
+func (f CarbonFactors) Emissions(r Requirements, p Period) float64 {
+	watts := float64(r.TotalCPU())/1000*f.Power.CPU +
+		utils.BytesToGiB(r.TotalMemory())*f.Power.Memory +
+		utils.BytesToGiB(r.TotalPersistentVolume())*f.Power.Storage
+	kWh := watts * float64(p) / 1000 * f.PUE
+	return kWh * f.Intensity / 1000
+}
+
+// RegionQuerier is the subset of *Client behavior Reporter.AddCarbon needs.
+type RegionQuerier interface {
+	GetClusterRegion(ctx context.Context, cluster string) (string, error)
+}
+
+var (
+	_ RegionQuerier = (*Client)(nil)
+	_ RegionQuerier = (*Clients)(nil)
+)
+
+// GetClusterRegion returns the region of a cluster from the labels of the instance
+// prices of cloudcost-exporter, the most common if its instances span several.
+// Returns ErrNoResults if the cluster has no price.
+func (c *Client) GetClusterRegion(ctx context.Context, cluster string) (string, error) {
+	vec, err := c.queryVectorNow(ctx, fmt.Sprintf(queryClusterRegion, cluster, cluster, cluster))
+	if err != nil {
+		return "", err
+	}
+	var region string
+	var count float64
+	for _, s := range vec {
+		r := string(s.Metric["region"])
+		if r == "" {
+			continue
+		}
+		if float64(s.Value) > count || (float64(s.Value) == count && r < region) {
+			region, count = r, float64(s.Value)
+		}
+	}
+	if region == "" {
+		return "", ErrNoResults
+	}
+	return region, nil
+}
+
+// AddCarbon sets the carbon factors of the clusters of the reports added so
+// far, to report their carbon footprint next to their cost. The region of a
+// cluster not configured is queried; clusters whose region can't be told or
+// has no carbon intensity are added as warnings, and left out.
+func (r *Reporter) AddCarbon(ctx context.Context, c *Carbon, q RegionQuerier) {
+	if c == nil {
+		return
+	}
+	factors := make(map[string]*CarbonFactors)
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		f, ok := factors[cluster]
+		if !ok {
+			f = r.carbonFactors(ctx, c, q, cluster)
+			factors[cluster] = f
+		}
+		r.reports[i].carbon = f
+	}
+}
+
+// carbonFactors returns the carbon factors of a cluster, or nil with a
+// warning if they can't be told.
+func (r *Reporter) carbonFactors(ctx context.Context, c *Carbon, q RegionQuerier, cluster string) *CarbonFactors {
+	cl := c.cluster(cluster)
+	region := cl.Region
+	if region == "" {
+		var err error
+		if region, err = q.GetClusterRegion(ctx, cluster); err != nil {
+			r.AddWarning(fmt.Sprintf("querying region of %s: %v", cluster, err))
+			return nil
+		}
+	}
+	intensity, ok := c.Regions[region]
+	if !ok {
+		r.AddWarning(fmt.Sprintf("no carbon intensity for region %s of %s", region, cluster))
+		return nil
+	}
+
+	f := &CarbonFactors{Region: region, Intensity: intensity, Power: defaultPower, PUE: c.PUE}
+	if p, ok := c.Families[cl.Family]; ok {
+		f.Power = p
+	}
+	if f.PUE == 0 {
+		f.PUE = defaultPUE
+	}
+	return f
+}
+
+// carbonEmissions returns the carbon footprint of the report over the
+// period before and after the change, zero if its carbon factors weren't
+// added.
+func carbonEmissions(m report, p Period) (float64, float64) {
+	if m.carbon == nil {
+		return 0, 0
+	}
+	return m.carbon.Emissions(m.From, p), m.carbon.Emissions(m.To, p)
+}
+
+// hasCarbon returns whether the carbon factors of a report were added.
+func (r *Reporter) hasCarbon() bool {
+	for _, m := range r.reports {
+		if m.carbon != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// carbonTotals returns the total carbon footprint over the main period
+// before and after the change.
+func (r *Reporter) carbonTotals() (float64, float64) {
+	var from, to float64
+	for _, m := range r.reports {
+		f, t := carbonEmissions(m, r.mainPeriod())
+		from += f
+		to += t
+	}
+	return from, to
+}
+
+// formatCarbon formats a carbon footprint in kg of CO2e.
+func formatCarbon(kg float64) string {
+	return fmt.Sprintf("%.2f kgCO2e", kg)
+}
+
+// carbonTotalLines returns the line of the total carbon footprint over the
+// main period, if added.
+func (r *Reporter) carbonTotalLines() []string {
+	if !r.hasCarbon() {
+		return nil
+	}
+	from, to := r.carbonTotals()
+	return []string{fmt.Sprintf("Total %s Carbon Footprint went from %s to %s.",
+		r.mainPeriod().Title(), formatCarbon(from), formatCarbon(to))}
+}
@@ -0,0 +1,164 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeRegionQuerier map[string]string
+
+func (f fakeRegionQuerier) GetClusterRegion(_ context.Context, cluster string) (string, error) {
+	region, ok := f[cluster]
+	if !ok {
+		return "", errors.New("boom")
+	}
+	return region, nil
+}
+
+func TestLoadCarbon(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr error
+	}{
+		{
+			name: "valid",
+			src: `regions:
+  europe-west1: 110
+  us-central1: 430
+families:
+  n2: {cpu: 2.5, memory: 0.4, storage: 0.001}
+clusters:
+  - cluster: prod-eu-*
+    region: europe-west1
+    family: n2
+pue: 1.1
+`,
+		},
+		{name: "negative intensity", src: "regions: {europe-west1: -1}", wantErr: ErrInvalidCarbon},
+		{name: "pue below 1", src: "regions: {}\npue: 0.9", wantErr: ErrInvalidCarbon},
+		{name: "bad glob", src: "regions: {}\nclusters: [{cluster: '['}]", wantErr: ErrInvalidCarbon},
+		{name: "unknown family", src: "regions: {}\nclusters: [{cluster: prod, family: n2}]", wantErr: ErrInvalidCarbon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "carbon.yaml")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("writing carbon configuration: %v", err)
+			}
+
+			got, err := LoadCarbon(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cl := got.cluster("prod-eu-1"); cl.Region != "europe-west1" || cl.Family != "n2" {
+				t.Errorf("expecting prod-eu-1 to match the configured clusters, got %+v", cl)
+			}
+			if cl := got.cluster("dev"); cl != (CarbonCluster{}) {
+				t.Errorf("expecting dev not to match, got %+v", cl)
+			}
+		})
+	}
+}
+
+func TestCarbonFactors_Emissions(t *testing.T) {
+	f := CarbonFactors{Intensity: 500, Power: PowerCoefficients{CPU: 2, Memory: 0.5, Storage: 0.01}, PUE: 1.5}
+	req := Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib, PersistentVolumePerPod: 100 * gib, Replicas: 2}
+
+	// (2 × 2 W + 4 GiB × 0.5 W + 200 GiB × 0.01 W) × 720h × 1.5 = 8.64 kWh, at 500 g/kWh.
+	if got := f.Emissions(req, Monthly); !feq(got, 4.32) {
+		t.Errorf("expecting 4.32 kgCO2e, got %v", got)
+	}
+}
+
+func TestClient_GetClusterRegion(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		q := r.Form.Get("query")
+		switch {
+		case strings.Contains(q, `cluster_name="empty"`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case strings.Contains(q, `cloudcost_gcp_gke_instance_cpu_usd_per_core_hour{cluster_name="prod"}`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"region":"us-east1"},"value":[0,"2"]},
+				{"metric":{"region":"europe-west1"},"value":[0,"40"]}]}}`)
+		default:
+			t.Errorf("unexpected query %s", q)
+		}
+	})
+
+	if got, err := c.GetClusterRegion(context.Background(), "prod"); err != nil || got != "europe-west1" {
+		t.Errorf("expecting the most common region europe-west1, got %q, %v", got, err)
+	}
+	if _, err := c.GetClusterRegion(context.Background(), "empty"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without prices, got %v", err)
+	}
+}
+
+func TestReporter_AddCarbon(t *testing.T) {
+	cm := func(cluster string) *CostModel {
+		return &CostModel{Cluster: &Cluster{Name: cluster}, CPU: Cost{NonSpot: 1}}
+	}
+	prod, dev, staging := cm("prod"), cm("dev"), cm("staging")
+	from := Requirements{CPUPerPod: 1000, MemoryPerPod: 2 * gib, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 4
+	carbon := &Carbon{
+		Regions:  map[string]float64{"europe-west1": 500},
+		Families: map[string]PowerCoefficients{"test": {CPU: 2, Memory: 0.5}},
+		Clusters: []CarbonCluster{{Cluster: "prod", Family: "test"}},
+		PUE:      1,
+	}
+	q := fakeRegionQuerier{"prod": "europe-west1", "dev": "us-central1"}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.AddReport(dev, from, to)
+		r.AddReport(staging, from, to)
+		r.AddCarbon(context.Background(), carbon, q)
+		return r
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		want := []string{"no carbon intensity for region us-central1 of dev", "querying region of staging: boom"}
+		if len(r.warnings) != len(want) || r.warnings[0] != want[0] || r.warnings[1] != want[1] {
+			t.Errorf("expecting %v, got %v", want, r.warnings)
+		}
+		if f := r.reports[0].carbon; f == nil || f.Region != "europe-west1" || f.Power.CPU != 2 {
+			t.Errorf("unexpected carbon factors of prod %+v", f)
+		}
+	})
+
+	// (2 × 2 W + 4 GiB × 0.5 W) × 720h at 500 g/kWh is 2.16 kg, twice that after the change.
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary:  {"Total Monthly Carbon Footprint went from 2.16 kgCO2e to 4.32 kgCO2e.\n"},
+		CSV:      {"carbon_monthly_kg,carbon_monthly_delta_kg\n", ",4.32,2.16\n"},
+		Markdown: {":seedling: Monthly carbon footprint will go from 2.16 kgCO2e to 4.32 kgCO2e (2.16 kgCO2e)."},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		if c := got.Workloads[0].Carbon; c == nil || !feq(c.From, 2.16) || !feq(c.To, 4.32) || !feq(c.Delta, 2.16) {
+			t.Errorf("unexpected carbon footprint %+v", c)
+		}
+		if got.Workloads[1].Carbon != nil {
+			t.Errorf("expecting no carbon footprint for dev, got %+v", got.Workloads[1].Carbon)
+		}
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"log/slog"
 	"strings"
 	"time"
@@ -16,22 +15,23 @@ import (
 )
 
 const (
+	// The price queries label results with the cloud of their metric, see CostModel.Cloud.
 	queryCostPerCpu = `
-	avg by (price_tier) (
-		cloudcost_aws_ec2_instance_cpu_usd_per_core_hour{cluster_name="%s"}
+	avg by (price_tier, cloud) (
+		label_replace(cloudcost_aws_ec2_instance_cpu_usd_per_core_hour{cluster_name="%s"}, "cloud", "aws", "", "")
 		or
-		cloudcost_azure_aks_instance_cpu_usd_per_core_hour{cluster_name="%s"}
+		label_replace(cloudcost_azure_aks_instance_cpu_usd_per_core_hour{cluster_name="%s"}, "cloud", "azure", "", "")
 		or
-		cloudcost_gcp_gke_instance_cpu_usd_per_core_hour{cluster_name="%s"}
+		label_replace(cloudcost_gcp_gke_instance_cpu_usd_per_core_hour{cluster_name="%s"}, "cloud", "gcp", "", "")
 )
 `
 	queryMemoryCost = `
-	avg by (price_tier) (
-		cloudcost_aws_ec2_instance_memory_usd_per_gib_hour{cluster_name="%s"}
+	avg by (price_tier, cloud) (
+		label_replace(cloudcost_aws_ec2_instance_memory_usd_per_gib_hour{cluster_name="%s"}, "cloud", "aws", "", "")
 		or
-		cloudcost_azure_aks_instance_memory_usd_per_gib_hour{cluster_name="%s"}
+		label_replace(cloudcost_azure_aks_instance_memory_usd_per_gib_hour{cluster_name="%s"}, "cloud", "azure", "", "")
 		or
-		cloudcost_gcp_gke_instance_memory_usd_per_gib_hour{cluster_name="%s"}
+		label_replace(cloudcost_gcp_gke_instance_memory_usd_per_gib_hour{cluster_name="%s"}, "cloud", "gcp", "", "")
 )
 `
 
@@ -69,6 +69,37 @@ const (
 	// queryObservedReplicas reports the average actual replica count over a 7d window.
 	// Format args: metric, cluster, namespace, kindLabel, name.
 	queryObservedReplicas = `avg(avg_over_time(%s{cluster="%s", namespace="%s", %s="%s"}[7d]))`
+
+	// queryPodsOwnedBy reports the pods owned by a workload, with a value of 1, to join other
+	// series of the pods with on (namespace, pod).
+	// Format args: cluster, namespace, owner kind, owner name.
+	queryPodsOwnedBy = `max by (namespace, pod) (kube_pod_owner{cluster="%s", namespace="%s", owner_kind="%s", owner_name="%s"})`
+
+	// queryPodsOwnedByDeployment reports the pods of the ReplicaSets owned by a Deployment, with a
+	// value of 1, to join other series of the pods with on (namespace, pod).
+	// Format args: cluster, namespace, cluster, namespace, name.
+	queryPodsOwnedByDeployment = `max by (namespace, pod) (kube_pod_owner{cluster="%s", namespace="%s", owner_kind="ReplicaSet"} * on (namespace, owner_name) group_left() max by (namespace, owner_name) (label_replace(kube_replicaset_owner{cluster="%s", namespace="%s", owner_kind="Deployment", owner_name="%s"}, "owner_name", "$1", "replicaset", "(.+)")))`
+
+	// queryPod reports a bare pod, with a value of 1, to join other series of the pod with on (namespace, pod).
+	// Format args: cluster, namespace, name.
+	queryPod = `max by (namespace, pod) (kube_pod_info{cluster="%s", namespace="%s", pod="%s"})`
+
+	// queryWorkloadRequests reports the average resources requested by the pods of a workload over a window.
+	// Format args: cluster, namespace, resource, owned pods, window.
+	queryWorkloadRequests = `avg_over_time(sum(kube_pod_container_resource_requests{cluster="%s", namespace="%s", resource="%s"} * on (namespace, pod) group_left() %s)[%s:5m])`
+
+	// queryWorkloadCPUUsage reports the average CPU cores used by the pods of a workload over a window.
+	// Format args: cluster, namespace, owned pods, window.
+	queryWorkloadCPUUsage = `avg_over_time(sum(rate(container_cpu_usage_seconds_total{cluster="%s", namespace="%s", container!=""}[5m]) * on (namespace, pod) group_left() %s)[%s:5m])`
+
+	// queryWorkloadMemoryUsage reports the average memory bytes used by the pods of a workload over a window.
+	// Format args: cluster, namespace, owned pods, window.
+	queryWorkloadMemoryUsage = `avg_over_time(sum(container_memory_working_set_bytes{cluster="%s", namespace="%s", container!=""} * on (namespace, pod) group_left() %s)[%s:5m])`
+
+	// queryWorkloadPersistentVolume reports the average storage bytes requested by the claims mounted by the pods
+	// of a workload over a window.
+	// Format args: cluster, namespace, cluster, namespace, owned pods, window.
+	queryWorkloadPersistentVolume = `avg_over_time(sum(kube_persistentvolumeclaim_resource_requests_storage_bytes{cluster="%s", namespace="%s"} * on (namespace, persistentvolumeclaim) group_left() max by (namespace, persistentvolumeclaim) (kube_pod_spec_volumes_persistentvolumeclaims_info{cluster="%s", namespace="%s"} * on (namespace, pod) group_left() %s))[%s:5m])`
 )
 
 // ErrNoResults is the error returned when querying for costs returns
@@ -85,13 +116,22 @@ var (
 
 // Client is a client for the cost model.
 type Client struct {
-	client api.Client
-}
-
-// Clients bundles the dev and prod client in one struct.
-type Clients struct {
-	Prod *Client
-	Dev  *Client
+	client  api.Client
+	address string
+	// datasource is the name of the datasource the client queries, if
+	// created for a Clients registry.
+	datasource string
+	// timeout bounds each query, including its retries. Zero means no timeout.
+	timeout time.Duration
+	// allowPartial lets cost models be returned with missing parts.
+	allowPartial bool
+	// priceTime and priceWindow set when prices are evaluated, see
+	// ClientConfig.
+	priceTime   time.Time
+	priceWindow time.Duration
+	// queryTime is when the queries that aren't prices are evaluated,
+	// now if zero, see At.
+	queryTime time.Time
 }
 
 // ClientConfig is the configuration for the cost model client.
@@ -100,6 +140,22 @@ type ClientConfig struct {
 	HTTPConfigFile string
 	Username       string
 	Password       string
+	// QueryTimeout bounds each query, including its retries. Zero means
+	// queries are only bound by the caller's context.
+	QueryTimeout time.Duration
+	// MaxRetries is how many times a query failing with a 5xx or 429
+	// status is retried, with exponential backoff starting at RetryBackoff.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// AllowPartial returns cost models with the parts that couldn't be
+	// queried flagged as missing, instead of failing the whole cluster.
+	AllowPartial bool
+	// PriceTime evaluates prices at the given time instead of now.
+	PriceTime time.Time
+	// PriceWindow averages prices over the window ending at PriceTime,
+	// or at the start of the current hour, to smooth out spikes. Zero
+	// uses instant prices.
+	PriceWindow time.Duration
 }
 
 // NewClient creates a new cost model client with the given configuration.
@@ -138,59 +194,155 @@ func NewClient(config *ClientConfig) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if config.MaxRetries > 0 {
+		backoff := config.RetryBackoff
+		if backoff <= 0 {
+			backoff = DefaultRetryBackoff
+		}
+		client = &retryClient{Client: client, maxRetries: config.MaxRetries, backoff: backoff}
+	}
 	return &Client{
-		client: client,
+		client:       client,
+		address:      config.Address,
+		timeout:      config.QueryTimeout,
+		allowPartial: config.AllowPartial,
+		priceTime:    config.PriceTime,
+		priceWindow:  config.PriceWindow,
 	}, nil
 }
 
-// NewClients creates a new cost model clients with the given configuration.
-func NewClients(prodConfig, devConfig *ClientConfig) (*Clients, error) {
-	var clients Clients
-	prometheusProdClient, err := NewClient(prodConfig)
-	if err != nil {
-		return nil, ErrProdConfigMissing
+// At returns a copy of c evaluating its queries at t instead of now, e.g.
+// to observe the replicas of a workload when a change was committed.
+// Prices are still evaluated as configured.
+func (c *Client) At(t time.Time) *Client {
+	at := *c
+	at.queryTime = t
+	return &at
+}
+
+// backend identifies the datasource the client queries, e.g. to key
+// cached cost models. Datasources can share an address and differ by
+// tenant, so the name is part of it.
+func (c *Client) backend() string {
+	if c.datasource == "" {
+		return c.address
+	}
+	return c.datasource + "@" + c.address
+}
+
+// cacheKey returns the key the cost model of cluster is cached under,
+// which depends on when prices are evaluated.
+func (c *Client) cacheKey(cluster string) string {
+	key := CacheKey(c.backend(), cluster)
+	if c.priceWindow > 0 {
+		key += "|" + model.Duration(c.priceWindow).String()
+	}
+	if !c.priceTime.IsZero() {
+		key += "|" + c.priceTime.UTC().Format(time.RFC3339)
+	}
+	return key
+}
+
+// pricedAt returns the time prices are evaluated at. Averaged prices end
+// at the start of the current step, so that they don't change on every run.
+func (c *Client) pricedAt() time.Time {
+	switch {
+	case !c.priceTime.IsZero():
+		return c.priceTime
+	case c.priceWindow > 0:
+		return time.Now().Truncate(c.priceStep())
+	default:
+		return time.Now()
+	}
+}
+
+// priceStep is the resolution prices are averaged at.
+func (c *Client) priceStep() time.Duration {
+	if c.priceWindow >= 24*time.Hour {
+		return time.Hour
+	}
+	return 5 * time.Minute
+}
+
+// priceQuery returns the query to evaluate for a price, averaged over the
+// price window if set.
+func (c *Client) priceQuery(query string) string {
+	if c.priceWindow <= 0 {
+		return query
 	}
-	clients.Prod = prometheusProdClient
-	// It isn't necessary to initiate the dev client therefore we ignore potential errors from this
-	prometheusDevClient, _ := NewClient(devConfig)
-	clients.Dev = prometheusDevClient
-	return &clients, nil
+	return fmt.Sprintf("avg_over_time((%s)[%s:%s])", strings.TrimSpace(query), model.Duration(c.priceWindow), model.Duration(c.priceStep()))
 }
 
 // GetCostPerCPU returns the average cost per CPU for a given cluster.
 func (c *Client) GetCostPerCPU(ctx context.Context, cluster string) (Cost, error) {
-	query := fmt.Sprintf(queryCostPerCpu, cluster, cluster, cluster)
-	results, err := c.query(ctx, query)
-	if err != nil {
-		return Cost{}, err
-	}
-	return c.parseResults(results)
+	cost, _, err := c.queryCost(ctx, c.priceQuery(costPerCPUQuery(cluster)), c.pricedAt())
+	return cost, err
 }
 
 // GetMemoryCost returns the cost per memory for a given cluster
 func (c *Client) GetMemoryCost(ctx context.Context, cluster string) (Cost, error) {
-	query := fmt.Sprintf(queryMemoryCost, cluster, cluster, cluster)
-	results, err := c.query(ctx, query)
-	if err != nil {
-		return Cost{}, err
-	}
-	return c.parseResults(results)
+	cost, _, err := c.queryCost(ctx, c.priceQuery(memoryCostQuery(cluster)), c.pricedAt())
+	return cost, err
 }
 
 // GetNodeCount returns the average number of nodes over 30 days for a given cluster
 func (c *Client) GetNodeCount(ctx context.Context, cluster string) (int, error) {
-	query := fmt.Sprintf(queryAverageNodeCount, cluster)
-	results, err := c.query(ctx, query)
+	count, _, err := c.queryNodeCount(ctx, nodeCountQuery(cluster), c.pricedAt())
+	return count, err
+}
+
+func costPerCPUQuery(cluster string) string {
+	return fmt.Sprintf(queryCostPerCpu, cluster, cluster, cluster)
+}
+
+func memoryCostQuery(cluster string) string {
+	return fmt.Sprintf(queryMemoryCost, cluster, cluster, cluster)
+}
+
+func persistentVolumeCostQuery(cluster string) string {
+	return fmt.Sprintf(queryPersistentVolumeCost, cluster, cluster, cluster, cluster)
+}
+
+func nodeCountQuery(cluster string) string {
+	return fmt.Sprintf(queryAverageNodeCount, cluster)
+}
+
+// queryCost queries a price, returning the warnings Prometheus sent along.
+func (c *Client) queryCost(ctx context.Context, query string, at time.Time) (Cost, v1.Warnings, error) {
+	vec, warnings, err := c.queryVector(ctx, query, at)
 	if err != nil {
-		return 0, ErrBadQuery
+		return Cost{}, warnings, err
 	}
+	cost, err := c.parseResults(vec)
+	return cost, warnings, err
+}
 
-	result := results.(model.Vector)
-	if len(result) == 0 {
-		return 0, ErrNoResults
+// queryVector queries an instant vector, returning the warnings
+// Prometheus sent along.
+func (c *Client) queryVector(ctx context.Context, query string, at time.Time) (model.Vector, v1.Warnings, error) {
+	results, warnings, err := c.queryAt(ctx, query, at)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("%w: %w", ErrBadQuery, err)
+	}
+	vec, ok := results.(model.Vector)
+	if !ok {
+		return nil, warnings, fmt.Errorf("%w: unexpected result type %T", ErrBadQuery, results)
+	}
+	return vec, warnings, nil
+}
+
+// queryNodeCount queries a node count, returning the warnings Prometheus
+// sent along.
+func (c *Client) queryNodeCount(ctx context.Context, query string, at time.Time) (int, v1.Warnings, error) {
+	vec, warnings, err := c.queryVector(ctx, query, at)
+	if err != nil {
+		return 0, warnings, err
+	}
+	if len(vec) == 0 {
+		return 0, warnings, ErrNoResults
 	}
 
-	return int(result[0].Value), nil
+	return int(vec[0].Value), warnings, nil
 }
 
 // GetObservedReplicas returns the 7-day average replica count for the given workload
@@ -207,11 +359,11 @@ func (c *Client) GetObservedReplicas(ctx context.Context, cluster, namespace, ki
 	query := fmt.Sprintf(queryObservedReplicas, metric, cluster, namespace, kindLabel, name)
 	results, err := c.query(ctx, query)
 	if err != nil {
-		return 0, ErrBadQuery
+		return 0, fmt.Errorf("%w: %w", ErrBadQuery, err)
 	}
 	vec, ok := results.(model.Vector)
 	if !ok {
-		return 0, ErrBadQuery
+		return 0, fmt.Errorf("%w: unexpected result type %T", ErrBadQuery, results)
 	}
 	if len(vec) == 0 {
 		return 0, ErrNoResults
@@ -232,6 +384,70 @@ func replicaMetricForKind(kind string) (metric, label string, err error) {
 	}
 }
 
+// WorkloadUsage holds the resources a workload requested and used on
+// average over a window, summed across its pods. CPU is in cores; memory
+// and persistent volumes are in bytes.
+type WorkloadUsage struct {
+	CPURequests      float64
+	CPUUsage         float64
+	MemoryRequests   float64
+	MemoryUsage      float64
+	PersistentVolume float64
+}
+
+// GetWorkloadUsage returns the resources requested and used by the pods of the given
+// workload, averaged over the window ending at the given time. Pods are matched by their
+// owner, see ownedPods. Series with no samples
+// count as zero, so a workload that didn't exist during the window has no usage.
+func (c *Client) GetWorkloadUsage(ctx context.Context, cluster, namespace, kind, name string, at time.Time, window time.Duration) (WorkloadUsage, error) {
+	var u WorkloadUsage
+
+	pods := ownedPods(cluster, namespace, kind, name)
+	w := model.Duration(window).String()
+
+	queries := []struct {
+		query string
+		value *float64
+	}{
+		{fmt.Sprintf(queryWorkloadRequests, cluster, namespace, "cpu", pods, w), &u.CPURequests},
+		{fmt.Sprintf(queryWorkloadRequests, cluster, namespace, "memory", pods, w), &u.MemoryRequests},
+		{fmt.Sprintf(queryWorkloadCPUUsage, cluster, namespace, pods, w), &u.CPUUsage},
+		{fmt.Sprintf(queryWorkloadMemoryUsage, cluster, namespace, pods, w), &u.MemoryUsage},
+		{fmt.Sprintf(queryWorkloadPersistentVolume, cluster, namespace, cluster, namespace, pods, w), &u.PersistentVolume},
+	}
+
+	for _, q := range queries {
+		results, _, err := c.queryAt(ctx, q.query, at)
+		if err != nil {
+			return u, fmt.Errorf("%w: %w", ErrBadQuery, err)
+		}
+		vec, ok := results.(model.Vector)
+		if !ok {
+			return u, fmt.Errorf("%w: unexpected result type %T", ErrBadQuery, results)
+		}
+		if len(vec) > 0 {
+			*q.value = float64(vec[0].Value)
+		}
+	}
+
+	return u, nil
+}
+
+// ownedPods returns a query of the pods of a workload of the given kind, from
+// their owner as reported by kube-state-metrics, to join other series of the
+// pods with on (namespace, pod). The pods of a Deployment are owned by its
+// ReplicaSets.
+func ownedPods(cluster, namespace, kind, name string) string {
+	switch kind {
+	case "Deployment":
+		return fmt.Sprintf(queryPodsOwnedByDeployment, cluster, namespace, cluster, namespace, name)
+	case "Pod":
+		return fmt.Sprintf(queryPod, cluster, namespace, name)
+	default:
+		return fmt.Sprintf(queryPodsOwnedBy, cluster, namespace, kind, name)
+	}
+}
+
 // HPATargeting returns the name of the HorizontalPodAutoscaler targeting the given
 // (cluster, namespace, kind, name) workload, or an empty string if no HPA targets it.
 // Works for vanilla HPAs and KEDA-managed HPAs (KEDA creates a regular HPA underneath).
@@ -259,16 +475,15 @@ func (c *Client) HPATargeting(ctx context.Context, cluster, namespace, kind, nam
 
 // GetCostForPersistentVolume returns the average cost per persistent volume for a given cluster
 func (c *Client) GetCostForPersistentVolume(ctx context.Context, cluster string) (Cost, error) {
-	query := fmt.Sprintf(queryPersistentVolumeCost, cluster, cluster, cluster, cluster)
-	results, err := c.query(ctx, query)
-	if err != nil {
-		return Cost{}, err
-	}
-	return c.parseResults(results)
+	cost, _, err := c.queryCost(ctx, c.priceQuery(persistentVolumeCostQuery(cluster)), c.pricedAt())
+	return cost, err
 }
 
 func (c *Client) parseResults(results model.Value) (Cost, error) {
-	result := results.(model.Vector)
+	result, ok := results.(model.Vector)
+	if !ok {
+		return Cost{}, fmt.Errorf("%w: unexpected result type %T", ErrBadQuery, results)
+	}
 
 	if len(result) == 0 {
 		return Cost{}, ErrNoResults
@@ -303,50 +518,38 @@ func (c *Client) parseResults(results model.Value) (Cost, error) {
 	return cost, nil
 }
 
-// query queries prometheus with the given query
+// query queries prometheus with the given query, evaluated now or at the
+// time of At.
 func (c *Client) query(ctx context.Context, query string) (model.Value, error) {
-	api := v1.NewAPI(c.client)
-	results, warnings, err := api.Query(ctx, query, time.Now())
-	if err != nil {
-		return nil, err
+	ts := c.queryTime
+	if ts.IsZero() {
+		ts = time.Now()
 	}
-
-	if len(warnings) > 0 {
-		// TODO this isn't probably something we want to. Let's
-		// revisit the feasibility of receiving warnings later.
-		log.Printf("Warnings: %v", warnings)
-	}
-	return results, nil
+	results, _, err := c.queryAt(ctx, query, ts)
+	return results, err
 }
 
-// GetClusterCosts returns the cost for a cluster and differentiate for dev and prod clusters
-func (c *Clients) GetClusterCosts(ctx context.Context, cluster string) (*CostModel, error) {
-	start := time.Now()
-	defer func() {
-		slog.Info("GetClusterCosts", "cluster", cluster, "duration", time.Since(start))
-	}()
-	cost, err := GetCostModelForCluster(ctx, c.clientFor(cluster), cluster)
-	if err != nil {
-		// TODO here we should probably return an error like below
-		return nil, fmt.Errorf("fetching cost model for cluster %s: %w", cluster, err)
+// queryAt queries prometheus with the given query evaluated at the given
+// time. Warnings are logged, and returned for callers to surface them.
+func (c *Client) queryAt(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
 	}
-	return cost, nil
-}
 
-// clientFor picks the prod or dev client based on cluster name prefix.
-func (c *Clients) clientFor(cluster string) *Client {
-	if c.Dev != nil && strings.HasPrefix(cluster, "dev-") {
-		return c.Dev
+	api := v1.NewAPI(c.client)
+	results, warnings, err := api.Query(ctx, query, ts)
+	if len(warnings) > 0 {
+		slog.Warn("prometheus query returned warnings", "query", compactQuery(query), "warnings", warnings)
 	}
-	return c.Prod
-}
-
-// HPATargeting routes to the appropriate prod/dev client based on cluster prefix.
-func (c *Clients) HPATargeting(ctx context.Context, cluster, namespace, kind, name string) (string, error) {
-	return c.clientFor(cluster).HPATargeting(ctx, cluster, namespace, kind, name)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("querying prometheus: %w", err)
+	}
+	return results, warnings, nil
 }
 
-// GetObservedReplicas routes to the appropriate prod/dev client based on cluster prefix.
-func (c *Clients) GetObservedReplicas(ctx context.Context, cluster, namespace, kind, name string) (float64, error) {
-	return c.clientFor(cluster).GetObservedReplicas(ctx, cluster, namespace, kind, name)
+// compactQuery returns query on a single line.
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
 }
@@ -9,7 +9,9 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/common/model"
 )
@@ -124,12 +126,12 @@ func TestNewClients(t *testing.T) {
 				t.Errorf("Unexpected error type error = %v, wantErr %v", err, tt.error)
 				return
 			}
-			if tt.wantDev && got.Dev == nil {
-				t.Errorf("NewClient() got = %v, want %v", got.Dev, tt.wantDev)
+			if tt.wantDev && got.Datasource("dev") == nil {
+				t.Errorf("NewClient() got = %v, want %v", got.Datasource("dev"), tt.wantDev)
 				return
 			}
-			if tt.wantProd && got.Prod == nil {
-				t.Errorf("NewClient() got = %v, want %v", got.Prod, tt.wantProd)
+			if tt.wantProd && got.Datasource("prod") == nil {
+				t.Errorf("NewClient() got = %v, want %v", got.Datasource("prod"), tt.wantProd)
 			}
 		})
 	}
@@ -595,3 +597,115 @@ func TestClient_GetObservedReplicas(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_At(t *testing.T) {
+	var times []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		times = append(times, r.Form.Get("time"))
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1709294400,"3"]}]}}`)
+	})
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := c.At(at).GetObservedReplicas(context.Background(), "c", "ns", "Deployment", "foo"); err != nil {
+		t.Fatalf("GetObservedReplicas() unexpected error: %v", err)
+	}
+	if _, err := c.GetObservedReplicas(context.Background(), "c", "ns", "Deployment", "foo"); err != nil {
+		t.Fatalf("GetObservedReplicas() unexpected error: %v", err)
+	}
+
+	if len(times) != 2 {
+		t.Fatalf("expecting 2 queries, got %d", len(times))
+	}
+	if e, g := "1709294400", times[0]; !strings.HasPrefix(g, e) {
+		t.Errorf("expecting query at %s, got %s", e, g)
+	}
+	if strings.HasPrefix(times[1], "1709294400") {
+		t.Errorf("expecting the client to still query now, got %s", times[1])
+	}
+}
+
+func TestClient_GetWorkloadUsage(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	values := map[string]string{
+		`resource="cpu"`:                 "2",
+		`resource="memory"`:              "1073741824",
+		"container_cpu_usage_seconds":    "0.5",
+		"container_memory_working_set":   "2147483648",
+		"persistentvolumeclaim_resource": "",
+	}
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		if e, g := "1709294400", r.Form.Get("time"); !strings.HasPrefix(g, e) {
+			t.Errorf("expecting query at %s, got %s", e, g)
+		}
+		q := r.Form.Get("query")
+		if !strings.Contains(q, `kube_replicaset_owner{cluster="c", namespace="ns", owner_kind="Deployment", owner_name="foo"}`) {
+			t.Errorf("unexpected workload selector in query %s", q)
+		}
+		if !strings.Contains(q, "[1w:5m]") {
+			t.Errorf("expecting a 1w window in query %s", q)
+		}
+
+		result := "[]"
+		for k, v := range values {
+			if strings.Contains(q, k) && v != "" {
+				result = `[{"metric":{},"value":[1709294400,"` + v + `"]}]`
+			}
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+	}))
+	defer svr.Close()
+
+	c, err := NewClient(&ClientConfig{Address: svr.URL})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	got, err := c.GetWorkloadUsage(context.Background(), "c", "ns", "Deployment", "foo", at, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetWorkloadUsage() unexpected error: %v", err)
+	}
+
+	exp := WorkloadUsage{CPURequests: 2, CPUUsage: 0.5, MemoryRequests: 1 << 30, MemoryUsage: 2 << 30}
+	if exp != got {
+		t.Errorf("GetWorkloadUsage() = %+v, want %+v", got, exp)
+	}
+
+	t.Run("HTTP 500 returns ErrBadQuery", func(t *testing.T) {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer svr.Close()
+
+		c, err := NewClient(&ClientConfig{Address: svr.URL})
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+
+		if _, err := c.GetWorkloadUsage(context.Background(), "c", "ns", "Deployment", "foo", at, time.Hour); !errors.Is(err, ErrBadQuery) {
+			t.Errorf("GetWorkloadUsage() error = %v, want errors.Is %v", err, ErrBadQuery)
+		}
+	})
+}
+
+func TestOwnedPods(t *testing.T) {
+	tests := map[string]string{
+		"Deployment":  `max by (namespace, pod) (kube_pod_owner{cluster="c", namespace="ns", owner_kind="ReplicaSet"} * on (namespace, owner_name) group_left() max by (namespace, owner_name) (label_replace(kube_replicaset_owner{cluster="c", namespace="ns", owner_kind="Deployment", owner_name="foo"}, "owner_name", "$1", "replicaset", "(.+)")))`,
+		"StatefulSet": `max by (namespace, pod) (kube_pod_owner{cluster="c", namespace="ns", owner_kind="StatefulSet", owner_name="foo"})`,
+		"DaemonSet":   `max by (namespace, pod) (kube_pod_owner{cluster="c", namespace="ns", owner_kind="DaemonSet", owner_name="foo"})`,
+		"Pod":         `max by (namespace, pod) (kube_pod_info{cluster="c", namespace="ns", pod="foo"})`,
+	}
+
+	for kind, exp := range tests {
+		if got := ownedPods("c", "ns", kind, "foo"); exp != got {
+			t.Errorf("expecting query %s for %s, got %s", exp, kind, got)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package costmodel
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+// Column is a column of the table and csv reports.
+type Column string
+
+const (
+	ColumnCluster   Column = "cluster"
+	ColumnNamespace Column = "namespace"
+	ColumnKind      Column = "kind"
+	ColumnName      Column = "name"
+	ColumnTeam      Column = "team"
+	ColumnReplicas  Column = "replicas"
+	// ColumnCPU, ColumnMemory and ColumnStorage are the cost of each
+	// resource after the change, over the last period.
+	ColumnCPU     Column = "cpu"
+	ColumnMemory  Column = "memory"
+	ColumnStorage Column = "storage"
+	// ColumnFrom, ColumnTo and ColumnDelta are the total cost before and
+	// after the change, and its change, repeated for each period.
+	ColumnFrom  Column = "from"
+	ColumnTo    Column = "to"
+	ColumnDelta Column = "delta"
+	// ColumnListFrom, ColumnListTo and ColumnListDelta are the same at
+	// list prices, over the last period.
+	ColumnListFrom  Column = "list_from"
+	ColumnListTo    Column = "list_to"
+	ColumnListDelta Column = "list_delta"
+	// ColumnBinPacked and ColumnBinPackedDelta are the cost after the
+	// change bin-packed onto nodes, and its change, over the last period.
+	// They are the linear cost if node shapes weren't added.
+	ColumnBinPacked      Column = "bin_packed"
+	ColumnBinPackedDelta Column = "bin_packed_delta"
+	// ColumnCarbon and ColumnCarbonDelta are the carbon footprint after
+	// the change, and its change, in kg of CO2e over the last period.
+	// They are zero if carbon factors weren't added.
+	ColumnCarbon      Column = "carbon"
+	ColumnCarbonDelta Column = "carbon_delta"
+	// ColumnObservability and ColumnObservabilityDelta are the cost of
+	// the signals of the workload after the change, and its change, over
+	// the last period. They are zero if signals weren't added.
+	ColumnObservability      Column = "observability"
+	ColumnObservabilityDelta Column = "observability_delta"
+	// ColumnReplicaSource is where the replicas of the workload come
+	// from, see ReplicaSource.
+	ColumnReplicaSource Column = "replica_source"
+	// ColumnCPUPrice, ColumnMemoryPrice and ColumnStoragePrice are the
+	// hourly prices of a CPU core and of a GiB of memory and of persistent
+	// volume in the cluster of the workload, see Assumptions.
+	ColumnCPUPrice     Column = "cpu_price"
+	ColumnMemoryPrice  Column = "memory_price"
+	ColumnStoragePrice Column = "storage_price"
+)
+
+var allColumns = []Column{
+	ColumnCluster, ColumnNamespace, ColumnKind, ColumnName, ColumnTeam, ColumnReplicas,
+	ColumnCPU, ColumnMemory, ColumnStorage,
+	ColumnFrom, ColumnTo, ColumnDelta,
+	ColumnListFrom, ColumnListTo, ColumnListDelta,
+	ColumnBinPacked, ColumnBinPackedDelta,
+	ColumnCarbon, ColumnCarbonDelta,
+	ColumnObservability, ColumnObservabilityDelta,
+	ColumnReplicaSource, ColumnCPUPrice, ColumnMemoryPrice, ColumnStoragePrice,
+}
+
+// defaultColumns returns the columns of the report type when none are
+// configured, with those of the enabled estimators.
+func (r *Reporter) defaultColumns() []Column {
+	if r.inventory {
+		return r.inventoryColumns()
+	}
+	binPacked, carbon, observability := r.binPacking() != nil, r.hasCarbon(), r.hasObservability()
+	if r.reportType == CSV {
+		cols := []Column{ColumnCluster, ColumnNamespace, ColumnKind, ColumnName, ColumnReplicas, ColumnCPU, ColumnMemory, ColumnStorage, ColumnFrom, ColumnTo, ColumnDelta}
+		if r.listPrices {
+			cols = append(cols, ColumnListFrom, ColumnListTo, ColumnListDelta)
+		}
+		if binPacked {
+			cols = append(cols, ColumnBinPacked, ColumnBinPackedDelta)
+		}
+		if carbon {
+			cols = append(cols, ColumnCarbon, ColumnCarbonDelta)
+		}
+		if observability {
+			cols = append(cols, ColumnObservability, ColumnObservabilityDelta)
+		}
+		if r.assumptions {
+			cols = append(cols, ColumnReplicaSource, ColumnCPUPrice, ColumnMemoryPrice, ColumnStoragePrice)
+		}
+		return cols
+	}
+
+	cols := []Column{ColumnCluster, ColumnTo, ColumnDelta}
+	if r.listPrices {
+		cols = append(cols, ColumnListTo, ColumnListDelta)
+	}
+	if binPacked {
+		cols = append(cols, ColumnBinPacked, ColumnBinPackedDelta)
+	}
+	if carbon {
+		cols = append(cols, ColumnCarbon, ColumnCarbonDelta)
+	}
+	if observability {
+		cols = append(cols, ColumnObservability, ColumnObservabilityDelta)
+	}
+	return cols
+}
+
+// inventoryColumns returns the default columns of the report type for an
+// inventory, which lists the workloads and their current cost only.
+func (r *Reporter) inventoryColumns() []Column {
+	cols := []Column{ColumnCluster, ColumnNamespace, ColumnKind, ColumnName, ColumnReplicas}
+	if r.reportType == CSV {
+		cols = append(cols, ColumnCPU, ColumnMemory, ColumnStorage)
+	}
+	cols = append(cols, ColumnTo)
+	if r.listPrices {
+		cols = append(cols, ColumnListTo)
+	}
+	if r.binPacking() != nil {
+		cols = append(cols, ColumnBinPacked)
+	}
+	if r.hasCarbon() {
+		cols = append(cols, ColumnCarbon)
+	}
+	if r.hasObservability() {
+		cols = append(cols, ColumnObservability)
+	}
+	if r.reportType == CSV && r.assumptions {
+		cols = append(cols, ColumnReplicaSource, ColumnCPUPrice, ColumnMemoryPrice, ColumnStoragePrice)
+	}
+	return cols
+}
+
+// ParseColumns parses a comma separated list of columns.
+func ParseColumns(s string) ([]Column, error) {
+	var cols []Column
+	for _, f := range strings.Split(s, ",") {
+		c := Column(strings.ToLower(strings.TrimSpace(f)))
+		if !slices.Contains(allColumns, c) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownColumn, f)
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// perPeriod returns whether the column is repeated for each period.
+func (c Column) perPeriod() bool {
+	return c == ColumnFrom || c == ColumnTo || c == ColumnDelta
+}
+
+// cell is a column of a report, over a period.
+type cell struct {
+	column Column
+	period Period
+}
+
+// layout returns the cells of each row. The columns repeated for each
+// period are grouped by period, where the first of them is listed.
+func (r *Reporter) layout() []cell {
+	cols := r.columns
+	if len(cols) == 0 {
+		cols = r.defaultColumns()
+	}
+
+	var perPeriod []Column
+	for _, c := range cols {
+		if c.perPeriod() {
+			perPeriod = append(perPeriod, c)
+		}
+	}
+
+	var cells []cell
+	grouped := false
+	for _, c := range cols {
+		if !c.perPeriod() {
+			cells = append(cells, cell{column: c, period: r.mainPeriod()})
+			continue
+		}
+		if grouped {
+			continue
+		}
+		for _, p := range r.periods {
+			for _, pc := range perPeriod {
+				cells = append(cells, cell{column: pc, period: p})
+			}
+		}
+		grouped = true
+	}
+	return cells
+}
+
+// tableHeader returns the header of the cell in the table report.
+func (c cell) tableHeader() string {
+	p := c.period.Title()
+	switch c.column {
+	case ColumnCPU:
+		return fmt.Sprintf("%s CPU Cost", p)
+	case ColumnMemory:
+		return fmt.Sprintf("%s Memory Cost", p)
+	case ColumnStorage:
+		return fmt.Sprintf("%s Storage Cost", p)
+	case ColumnFrom:
+		return fmt.Sprintf("Previous %s Cost", p)
+	case ColumnTo:
+		return fmt.Sprintf("Total %s Cost", p)
+	case ColumnDelta:
+		return fmt.Sprintf("Δ %s Cost", p)
+	case ColumnListFrom:
+		return fmt.Sprintf("Previous List %s Cost", p)
+	case ColumnListTo:
+		return fmt.Sprintf("List %s Cost", p)
+	case ColumnListDelta:
+		return fmt.Sprintf("Δ List %s Cost", p)
+	case ColumnBinPacked:
+		return fmt.Sprintf("Bin-Packed %s Cost", p)
+	case ColumnBinPackedDelta:
+		return fmt.Sprintf("Δ Bin-Packed %s Cost", p)
+	case ColumnCarbon:
+		return fmt.Sprintf("%s Carbon", p)
+	case ColumnCarbonDelta:
+		return fmt.Sprintf("Δ %s Carbon", p)
+	case ColumnObservability:
+		return fmt.Sprintf("%s Observability Cost", p)
+	case ColumnObservabilityDelta:
+		return fmt.Sprintf("Δ %s Observability Cost", p)
+	case ColumnCPUPrice:
+		return "CPU Price per Core-Hour"
+	case ColumnMemoryPrice:
+		return "Memory Price per GiB-Hour"
+	case ColumnStoragePrice:
+		return "Storage Price per GiB-Hour"
+	default:
+		return title(string(c.column))
+	}
+}
+
+// csvHeader returns the header of the cell in the csv report.
+func (c cell) csvHeader() string {
+	keys := c.period.Keys()
+	switch c.column {
+	case ColumnCPU, ColumnMemory, ColumnStorage:
+		return fmt.Sprintf("%s_%s", c.period, c.column)
+	case ColumnFrom:
+		return keys.From
+	case ColumnTo:
+		return keys.To
+	case ColumnDelta:
+		return keys.Delta
+	case ColumnListFrom, ColumnListTo, ColumnListDelta:
+		return fmt.Sprintf("list_%s_%s", c.period, strings.TrimPrefix(string(c.column), "list_"))
+	case ColumnBinPacked:
+		return fmt.Sprintf("bin_packed_%s_to", c.period)
+	case ColumnBinPackedDelta:
+		return fmt.Sprintf("bin_packed_%s_delta", c.period)
+	case ColumnCarbon:
+		return fmt.Sprintf("carbon_%s_kg", c.period)
+	case ColumnCarbonDelta:
+		return fmt.Sprintf("carbon_%s_delta_kg", c.period)
+	case ColumnObservability:
+		return fmt.Sprintf("observability_%s_to", c.period)
+	case ColumnObservabilityDelta:
+		return fmt.Sprintf("observability_%s_delta", c.period)
+	case ColumnCPUPrice:
+		return "cpu_per_core_hour"
+	case ColumnMemoryPrice:
+		return "memory_per_gib_hour"
+	case ColumnStoragePrice:
+		return "storage_per_gib_hour"
+	default:
+		return string(c.column)
+	}
+}
+
+// isCost returns whether the cell holds a cost.
+func (c cell) isCost() bool {
+	switch c.column {
+	case ColumnCluster, ColumnNamespace, ColumnKind, ColumnName, ColumnTeam, ColumnReplicas, ColumnReplicaSource,
+		ColumnCPUPrice, ColumnMemoryPrice, ColumnStoragePrice:
+		return false
+	default:
+		return true
+	}
+}
+
+// isPrice returns whether the cell holds an hourly unit price.
+func (c cell) isPrice() bool {
+	return c.column == ColumnCPUPrice || c.column == ColumnMemoryPrice || c.column == ColumnStoragePrice
+}
+
+// price returns the unit price of a price cell, in US dollars.
+func (c cell) price(m report) float64 {
+	switch c.column {
+	case ColumnCPUPrice:
+		return m.CostModel.CPU.NonSpot
+	case ColumnMemoryPrice:
+		return m.CostModel.RAM.NonSpot
+	default:
+		return m.CostModel.PersistentVolume.Dollars
+	}
+}
+
+// text returns the value of a cell not holding a cost.
+func (c cell) text(m report) string {
+	id := workload(m.From, m.To)
+	switch c.column {
+	case ColumnCluster:
+		return m.CostModel.Cluster.Name
+	case ColumnNamespace:
+		return id.Namespace
+	case ColumnKind:
+		return id.Kind
+	case ColumnName:
+		return id.Name
+	case ColumnTeam:
+		return m.team()
+	case ColumnReplicas:
+		return strconv.Itoa(m.To.Replicas)
+	case ColumnReplicaSource:
+		return m.replicaSource.String()
+	default:
+		return ""
+	}
+}
+
+// costs returns the cost of the cell before and after the change, in US
+// dollars, or kg of CO2e for carbon cells.
+func (c cell) costs(m report) (float64, float64) {
+	switch c.column {
+	case ColumnCPU, ColumnMemory, ColumnStorage:
+		from, to := resourcesCosts(m.CostModel, m.From, c.period), resourcesCosts(m.CostModel, m.To, c.period)
+		switch c.column {
+		case ColumnCPU:
+			return from.CPU, to.CPU
+		case ColumnMemory:
+			return from.Memory, to.Memory
+		default:
+			return from.Storage, to.Storage
+		}
+	case ColumnListFrom, ColumnListTo, ColumnListDelta:
+		return calculateTotalCostForPeriod(c.period, m.From, m.To, m.CostModel.ListPrices())
+	case ColumnBinPacked, ColumnBinPackedDelta:
+		from, to, _ := binPackedCosts(m, c.period)
+		return from.Cost, to.Cost
+	case ColumnCarbon, ColumnCarbonDelta:
+		return carbonEmissions(m, c.period)
+	case ColumnObservability, ColumnObservabilityDelta:
+		return observabilityCosts(m, c.period)
+	default:
+		return calculateTotalCostForPeriod(c.period, m.From, m.To, m.CostModel)
+	}
+}
+
+// cost returns the value of a cost cell given the cost before and after
+// the change.
+func (c cell) cost(from, to float64) float64 {
+	switch c.column {
+	case ColumnFrom, ColumnListFrom:
+		return from
+	case ColumnDelta, ColumnListDelta, ColumnBinPackedDelta, ColumnCarbonDelta, ColumnObservabilityDelta:
+		return to - from
+	default:
+		return to
+	}
+}
+
+// isDelta returns whether the cell holds a change in cost.
+func (c cell) isDelta() bool {
+	switch c.column {
+	case ColumnDelta, ColumnListDelta, ColumnBinPackedDelta, ColumnCarbonDelta, ColumnObservabilityDelta:
+		return true
+	default:
+		return false
+	}
+}
+
+// isCarbon returns whether the cell holds a carbon footprint, in kg of
+// CO2e rather than in the report currency.
+func (c cell) isCarbon() bool {
+	return c.column == ColumnCarbon || c.column == ColumnCarbonDelta
+}
@@ -0,0 +1,91 @@
+package costmodel
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	got, err := ParseColumns("cluster, Name,delta")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []Column{ColumnCluster, ColumnName, ColumnDelta}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expecting %v, got %v", want, got)
+	}
+	if _, err := ParseColumns("cluster,cost"); !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("expecting ErrUnknownColumn, got %v", err)
+	}
+}
+
+func TestReporter_PeriodsAndColumns(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	from := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 2
+	quarter := Period(90 * 24)
+
+	tests := []struct {
+		name       string
+		reportType ReportType
+		opts       []Option
+		want       string
+	}{
+		{
+			name:       "table",
+			reportType: Table,
+			opts:       []Option{WithPeriods(Daily, quarter), WithColumns(ColumnNamespace, ColumnName, ColumnDelta, ColumnCPU)},
+			want: "Namespace  Name    Δ Daily Cost    Δ 90d Cost        90d CPU Cost\n" +
+				"ns         wk      $24.00(100.0%)  $2160.00(100.0%)  $4320.00\n",
+		},
+		{
+			name:       "csv",
+			reportType: CSV,
+			opts:       []Option{WithPeriods(Hourly), WithColumns(ColumnName, ColumnFrom, ColumnTo, ColumnMemory, ColumnListTo)},
+			want:       "name,hourly-from,hourly-to,hourly_memory,list_hourly_to\nwk,1.00,2.00,0.00,2.00\n",
+		},
+		{
+			name:       "default csv columns",
+			reportType: CSV,
+			opts:       []Option{WithPeriods(Yearly)},
+			want: "cluster,namespace,kind,name,replicas,yearly_cpu,yearly_memory,yearly_storage,yearly-from,yearly-to,yearly-delta\n" +
+				"prod,ns,Deployment,wk,2,17520.00,0.00,0.00,8760.00,17520.00,8760.00\n",
+		},
+		{
+			name:       "summary",
+			reportType: Summary,
+			opts:       []Option{WithPeriods(Monthly, quarter)},
+			want:       "PR changed the overall cost by $2160.00(100.0%).\nTotal 90d Cost went from $2160.00 to $4320.00.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s strings.Builder
+			r := New(&s, string(tt.reportType), tt.opts...)
+			r.AddReport(cm, from, to)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			if s.String() != tt.want {
+				t.Errorf("expecting:\n%s\ngot:\n%s", tt.want, s.String())
+			}
+		})
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Markdown), WithPeriods(quarter))
+		r.AddReport(cm, from, to)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if !strings.Contains(s.String(), "90d cost for the affected resources will increase by $2160.00") {
+			t.Errorf("expecting the markdown report to use the 90d period, got:\n%s", s.String())
+		}
+	})
+}
@@ -2,13 +2,24 @@ package costmodel
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
 
 	"github.com/grafana/kost/pkg/costmodel/utils"
 )
 
+// Period is a number of hours costs are reported for.
 type Period float64
 
+var ErrInvalidPeriod = errors.New("invalid period")
+
 const (
 	Hourly  Period = 1
 	Daily          = 24
@@ -17,21 +28,61 @@ const (
 	Yearly         = 24 * 365
 )
 
+var periodNames = map[Period]string{
+	Hourly:  "hourly",
+	Daily:   "daily",
+	Weekly:  "weekly",
+	Monthly: "monthly",
+	Yearly:  "yearly",
+}
+
+// String returns the name of the period, or its duration for custom
+// periods, e.g. 90d.
 func (p Period) String() string {
-	switch p {
-	case Hourly:
-		return "hourly"
-	case Daily:
-		return "daily"
-	case Weekly:
-		return "weekly"
-	case Monthly:
-		return "monthly"
-	case Yearly:
-		return "yearly"
-	default:
-		panic("unrecognized value for Period")
+	if name, ok := periodNames[p]; ok {
+		return name
+	}
+	return model.Duration(time.Duration(float64(p) * float64(time.Hour))).String()
+}
+
+// Title returns the name of the period, capitalized for headers.
+func (p Period) Title() string {
+	return title(p.String())
+}
+
+// ParsePeriod parses the name of a period, e.g. monthly, a duration, e.g.
+// 90d, or a number of hours.
+func ParsePeriod(s string) (Period, error) {
+	s = strings.TrimSpace(s)
+	for p, name := range periodNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+
+	var hours float64
+	if d, err := model.ParseDuration(s); err == nil {
+		hours = time.Duration(d).Hours()
+	} else if hours, err = strconv.ParseFloat(s, 64); err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPeriod, s)
+	}
+	if hours <= 0 || math.IsInf(hours, 0) || math.IsNaN(hours) {
+		return 0, fmt.Errorf("%w: %q must be positive", ErrInvalidPeriod, s)
+	}
+	return Period(hours), nil
+}
+
+// ParsePeriods parses a comma separated list of periods, see ParsePeriod.
+func ParsePeriods(s string) ([]Period, error) {
+	var periods []Period
+	for _, f := range strings.Split(s, ",") {
+		p, err := ParsePeriod(f)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, p)
 	}
+	return periods, nil
 }
 
 type PeriodKeys struct {
@@ -85,10 +136,79 @@ func (c Cost) DollarsYearly(memReq int64) float64 { return c.DollarsForPeriod(Ye
 
 // CostModel represents the cost of each resource for a specific cluster
 type CostModel struct {
-	Cluster          *Cluster
+	Cluster *Cluster
+	// Cloud is the provider of the cluster, e.g. aws, azure or gcp, if known.
+	Cloud            string
 	CPU              Cost
 	RAM              Cost
 	PersistentVolume Cost
+	// List is the cost model at list prices when discounts were applied
+	// to the prices of this one, see Discounts.Apply.
+	List *CostModel `json:"-"`
+	// Discounts are the names of the discounts applied to the prices.
+	Discounts []string `json:"-"`
+	// FetchedAt is when the prices were queried.
+	FetchedAt time.Time
+	// PricedAt is the time the prices were evaluated at, when set to a
+	// time other than FetchedAt.
+	PricedAt time.Time
+	// PriceWindow is the window the prices were averaged over, ending at
+	// PricedAt. Zero means instant prices.
+	PriceWindow time.Duration
+	// Cached is set when the cost model was read from a Cache.
+	Cached bool `json:"-"`
+	// Missing lists the parts that couldn't be queried, see the Part
+	// constants. Missing prices are zero.
+	Missing []string
+	// Diagnostics describe the missing parts and the queries Prometheus
+	// returned warnings for.
+	Diagnostics []Diagnostic
+}
+
+// Parts of a cost model that can be missing from a partial cost model.
+const (
+	PartCPU              = "CPU cost"
+	PartMemory           = "memory cost"
+	PartPersistentVolume = "persistent volume cost"
+	PartNodeCount        = "node count"
+)
+
+// PriceMode describes when the prices were evaluated, or returns an
+// empty string for the current instant prices.
+func (c *CostModel) PriceMode() string {
+	at := c.PricedAt.UTC().Format(time.RFC3339)
+	switch {
+	case c.PriceWindow > 0:
+		return fmt.Sprintf("averaged over the %s until %s", model.Duration(c.PriceWindow), at)
+	case !c.PricedAt.IsZero():
+		return "taken at " + at
+	default:
+		return ""
+	}
+}
+
+// ListPrices returns the cost model at list prices, which is the cost
+// model itself if no discount was applied.
+func (c *CostModel) ListPrices() *CostModel {
+	if c.List != nil {
+		return c.List
+	}
+	return c
+}
+
+// Age returns how long ago the prices were queried.
+func (c *CostModel) Age() time.Duration {
+	return time.Since(c.FetchedAt)
+}
+
+// cloudOf returns the cloud price results are labelled with, if any.
+func cloudOf(vec model.Vector) string {
+	for _, s := range vec {
+		if c := s.Metric["cloud"]; c != "" {
+			return string(c)
+		}
+	}
+	return ""
 }
 
 type Cluster struct {
@@ -96,33 +216,91 @@ type Cluster struct {
 	NodeCount int
 }
 
+// GetCostModelForCluster queries the prices and node count of a cluster.
+// Problems with the queries are recorded in the Diagnostics of the cost
+// model. If a part can't be queried, a *CostModelError is returned unless
+// the client allows partial cost models: then the parts that can't be
+// queried are listed in Missing and cost nothing, and an error is only
+// returned if none of the prices could be queried.
 func GetCostModelForCluster(ctx context.Context, client *Client, cluster string) (*CostModel, error) {
-	cpu, err := client.GetCostPerCPU(ctx, cluster)
-	if err != nil {
-		return nil, fmt.Errorf("could not find CPU cost: %s", err)
+	at := client.pricedAt()
+	cm := &CostModel{
+		Cluster:     &Cluster{Name: cluster},
+		FetchedAt:   time.Now(),
+		PriceWindow: client.priceWindow,
+	}
+	if client.priceWindow > 0 || !client.priceTime.IsZero() {
+		cm.PricedAt = at
 	}
 
-	memory, err := client.GetMemoryCost(ctx, cluster)
-	if err != nil {
-		return nil, fmt.Errorf("could not find memory cost: %s", err)
+	diagnose := func(part, query string, warnings []string, err error) {
+		if err == nil && len(warnings) == 0 {
+			return
+		}
+		cm.Diagnostics = append(cm.Diagnostics, Diagnostic{
+			Cluster:  cluster,
+			Part:     part,
+			Query:    query,
+			Err:      err,
+			Warnings: warnings,
+		})
+		if err != nil {
+			cm.Missing = append(cm.Missing, part)
+		}
 	}
 
-	pvc, err := client.GetCostForPersistentVolume(ctx, cluster)
-	if err != nil {
-		return nil, fmt.Errorf("could not find persistent volume cost: %s", err)
+	prices := []struct {
+		part  string
+		query string
+		cost  *Cost
+	}{
+		{PartCPU, client.priceQuery(costPerCPUQuery(cluster)), &cm.CPU},
+		{PartMemory, client.priceQuery(memoryCostQuery(cluster)), &cm.RAM},
+		{PartPersistentVolume, client.priceQuery(persistentVolumeCostQuery(cluster)), &cm.PersistentVolume},
+	}
+	for _, p := range prices {
+		vec, warnings, err := client.queryVector(ctx, p.query, at)
+		if err == nil {
+			*p.cost, err = client.parseResults(vec)
+		}
+		if cm.Cloud == "" {
+			cm.Cloud = cloudOf(vec)
+		}
+		diagnose(p.part, p.query, warnings, err)
 	}
 
-	nodeCount, err := client.GetNodeCount(ctx, cluster)
-	if err != nil {
-		return nil, fmt.Errorf("could not find node count: %s", err)
+	query := nodeCountQuery(cluster)
+	nodeCount, warnings, err := client.queryNodeCount(ctx, query, at)
+	cm.Cluster.NodeCount = nodeCount
+	diagnose(PartNodeCount, query, warnings, err)
+
+	// Without any price, there is nothing to estimate.
+	allMissing := cm.isMissing(PartCPU) && cm.isMissing(PartMemory) && cm.isMissing(PartPersistentVolume)
+	if cm.Partial() && (!client.allowPartial || allMissing) {
+		return nil, &CostModelError{Diagnostics: cm.missingDiagnostics()}
 	}
 
-	return &CostModel{
-		Cluster:          &Cluster{Name: cluster, NodeCount: nodeCount},
-		CPU:              cpu,
-		RAM:              memory,
-		PersistentVolume: pvc,
-	}, nil
+	return cm, nil
+}
+
+// Partial reports whether parts of the cost model couldn't be queried.
+func (c *CostModel) Partial() bool {
+	return len(c.Missing) > 0
+}
+
+func (c *CostModel) isMissing(part string) bool {
+	return slices.Contains(c.Missing, part)
+}
+
+// missingDiagnostics returns the diagnostics of the missing parts.
+func (c *CostModel) missingDiagnostics() []Diagnostic {
+	var ds []Diagnostic
+	for _, d := range c.Diagnostics {
+		if d.Missing() {
+			ds = append(ds, d)
+		}
+	}
+	return ds
 }
 
 // TotalCostForPeriod calculates the costs of each resource on the CostModel and returns the sum of the costs
@@ -132,3 +310,13 @@ func (c *CostModel) TotalCostForPeriod(p Period, r Requirements) float64 {
 	pvCost := c.PersistentVolume.DollarsForPeriod(p, r.TotalPersistentVolume())
 	return cpuCost + ramCost + pvCost
 }
+
+// UsageCostForPeriod calculates the cost of the resources a workload
+// effectively reserved: for CPU and memory, the greater of what its pods
+// requested and used.
+func (c *CostModel) UsageCostForPeriod(p Period, u WorkloadUsage) float64 {
+	cpu := math.Max(u.CPURequests, u.CPUUsage) * c.CPU.NonSpot * float64(p)
+	ram := utils.BytesToGiB(int64(math.Max(u.MemoryRequests, u.MemoryUsage))) * c.RAM.NonSpot * float64(p)
+	pv := utils.BytesToGiB(int64(u.PersistentVolume)) * c.PersistentVolume.Dollars * float64(p)
+	return cpu + ram + pv
+}
@@ -1,8 +1,16 @@
 package costmodel
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -171,3 +179,220 @@ func TestCostModelYearly(t *testing.T) {
 		}
 	})
 }
+
+func TestCostModel_UsageCostForPeriod(t *testing.T) {
+	cm := &CostModel{
+		CPU:              Cost{NonSpot: 1},
+		RAM:              Cost{NonSpot: 2},
+		PersistentVolume: Cost{Dollars: 3},
+	}
+
+	u := WorkloadUsage{
+		CPURequests:      1,
+		CPUUsage:         1.5,     // usage above requests is billed
+		MemoryRequests:   1 << 30, // requests above usage are billed
+		MemoryUsage:      1 << 29,
+		PersistentVolume: 1 << 30,
+	}
+
+	if e, g := (1.5*1+1*2+1*3)*24.0, cm.UsageCostForPeriod(Daily, u); !feq(e, g) {
+		t.Errorf("expecting usage cost %.3f, got %.3f", e, g)
+	}
+}
+
+func TestGetCostModelForCluster_Partial(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		// The cluster has no persistent volume prices.
+		if strings.Contains(r.Form.Get("query"), "persistent_volume") {
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		}
+		fmt.Fprint(w, oneSampleVector)
+	}))
+	defer svr.Close()
+
+	t.Run("strict", func(t *testing.T) {
+		c, err := NewClient(&ClientConfig{Address: svr.URL})
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+		if _, err := GetCostModelForCluster(context.Background(), c, "test"); !errors.Is(err, ErrNoResults) {
+			t.Errorf("expecting ErrNoResults, got %v", err)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		c, err := NewClient(&ClientConfig{Address: svr.URL, AllowPartial: true})
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+		cm, err := GetCostModelForCluster(context.Background(), c, "test")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !cm.Partial() || !reflect.DeepEqual(cm.Missing, []string{PartPersistentVolume}) {
+			t.Errorf("expecting persistent volume cost to be missing, got %v", cm.Missing)
+		}
+		if cm.CPU.Dollars != 4 || cm.Cluster.NodeCount != 4 {
+			t.Errorf("expecting the other parts to be queried, got %+v", cm)
+		}
+	})
+
+	t.Run("nothing priced", func(t *testing.T) {
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer down.Close()
+
+		c, err := NewClient(&ClientConfig{Address: down.URL, AllowPartial: true})
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+		if _, err := GetCostModelForCluster(context.Background(), c, "test"); !errors.Is(err, ErrBadQuery) {
+			t.Errorf("expecting ErrBadQuery, got %v", err)
+		}
+	})
+}
+
+func TestReporter_PartialCostModel(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "test"},
+		CPU:     Cost{NonSpot: 1},
+		Missing: []string{PartPersistentVolume},
+		Diagnostics: []Diagnostic{
+			{Cluster: "test", Part: PartPersistentVolume, Query: "pv_hourly_cost", Err: ErrNoResults},
+		},
+	}
+	req := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+
+	for _, rt := range []ReportType{Table, Summary, Markdown} {
+		t.Run(string(rt), func(t *testing.T) {
+			var s strings.Builder
+			r := New(&s, string(rt))
+			r.AddReport(cm, req, req)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			if !strings.Contains(s.String(), "could not find persistent volume cost for cluster test: no cost results. It counts as $0") {
+				t.Errorf("expecting report to flag the missing cost, got:\n%s", s.String())
+			}
+		})
+	}
+}
+
+func TestGetCostModelForCluster_PriceWindow(t *testing.T) {
+	var queries, times []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		queries = append(queries, r.Form.Get("query"))
+		times = append(times, r.Form.Get("time"))
+		fmt.Fprint(w, oneSampleVector)
+	}))
+	defer svr.Close()
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	c, err := NewClient(&ClientConfig{Address: svr.URL, PriceTime: at, PriceWindow: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	cm, err := GetCostModelForCluster(context.Background(), c, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The three prices are averaged, the node count already is.
+	for i, q := range queries {
+		averaged := strings.HasPrefix(q, "avg_over_time((") && strings.HasSuffix(q, ")[30d:1h])")
+		if averaged != (i < 3) {
+			t.Errorf("expecting query %d to be averaged: %t, got %s", i, i < 3, q)
+		}
+		if times[i] != "1709294400" {
+			t.Errorf("expecting query %d to be evaluated at %d, got %s", i, at.Unix(), times[i])
+		}
+	}
+
+	if e, g := "averaged over the 30d until 2024-03-01T12:00:00Z", cm.PriceMode(); e != g {
+		t.Errorf("expecting price mode %q, got %q", e, g)
+	}
+
+	req := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	for _, rt := range []ReportType{Table, Markdown} {
+		var s strings.Builder
+		r := New(&s, string(rt))
+		r.AddReport(cm, req, req)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if !strings.Contains(s.String(), "were averaged over the 30d until 2024-03-01T12:00:00Z.") {
+			t.Errorf("expecting %s report to state the price window, got:\n%s", rt, s.String())
+		}
+	}
+}
+
+func TestClient_PricedAt(t *testing.T) {
+	instant := &Client{}
+	if instant.cacheKey("c") != CacheKey("", "c") {
+		t.Errorf("expecting instant prices to use the plain cache key, got %s", instant.cacheKey("c"))
+	}
+	if cm := (&CostModel{}); cm.PriceMode() != "" {
+		t.Errorf("expecting no price mode for instant prices, got %q", cm.PriceMode())
+	}
+
+	windowed := &Client{priceWindow: 7 * 24 * time.Hour}
+	if at := windowed.pricedAt(); !at.Equal(at.Truncate(time.Hour)) {
+		t.Errorf("expecting averaged prices to end at the start of an hour, got %s", at)
+	}
+	if windowed.cacheKey("c") == instant.cacheKey("c") {
+		t.Errorf("expecting averaged prices to be cached separately")
+	}
+
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	fixed := &Client{priceTime: at}
+	if !fixed.pricedAt().Equal(at) {
+		t.Errorf("expecting prices at %s, got %s", at, fixed.pricedAt())
+	}
+	if e, g := "taken at 2024-03-01T00:00:00Z", (&CostModel{PricedAt: at}).PriceMode(); e != g {
+		t.Errorf("expecting price mode %q, got %q", e, g)
+	}
+}
+
+func TestPeriod_String(t *testing.T) {
+	tests := map[Period]string{
+		Hourly:          "hourly",
+		Monthly:         "monthly",
+		Yearly:          "yearly",
+		Period(90 * 24): "90d",
+		Period(36):      "1d12h",
+		Period(1.5):     "1h30m",
+	}
+	for p, want := range tests {
+		if got := p.String(); got != want {
+			t.Errorf("expecting %v to be %q, got %q", float64(p), want, got)
+		}
+	}
+	if got := Period(90 * 24).Keys().Delta; got != "90d-delta" {
+		t.Errorf("expecting 90d-delta, got %s", got)
+	}
+}
+
+func TestParsePeriods(t *testing.T) {
+	got, err := ParsePeriods("Weekly, monthly,90d,12")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []Period{Weekly, Monthly, 90 * 24, 12}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expecting %v, got %v", want, got)
+	}
+
+	for _, s := range []string{"quarterly", "0", "-1", "0s", ""} {
+		if _, err := ParsePeriods(s); !errors.Is(err, ErrInvalidPeriod) {
+			t.Errorf("expecting ErrInvalidPeriod for %q, got %v", s, err)
+		}
+	}
+}
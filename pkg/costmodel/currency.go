@@ -0,0 +1,181 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrInvalidRate     = errors.New("invalid exchange rate")
+)
+
+// Currency is the currency costs are reported in. Costs are computed in
+// US dollars and converted when reported.
+type Currency struct {
+	// Code is the ISO 4217 code of the currency, e.g. EUR.
+	Code string
+	// Rate is the amount of the currency a US dollar buys.
+	Rate float64
+}
+
+// USD is the currency prices are queried in.
+var USD = Currency{Code: "USD", Rate: 1}
+
+// currencySymbols holds the symbols of the common currencies. Other
+// currencies are written with their code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"INR": "₹",
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// NewCurrency returns the currency with the given code, buying rate units
+// of it per US dollar.
+func NewCurrency(code string, rate float64) (Currency, error) {
+	code = strings.ToUpper(code)
+	if !currencyCode.MatchString(code) {
+		return Currency{}, fmt.Errorf("%w: %q is not an ISO 4217 code", ErrUnknownCurrency, code)
+	}
+	if rate <= 0 {
+		return Currency{}, fmt.Errorf("%w: %v for %s", ErrInvalidRate, rate, code)
+	}
+	return Currency{Code: code, Rate: rate}, nil
+}
+
+// Convert converts an amount of US dollars to the currency.
+func (c Currency) Convert(usd float64) float64 {
+	return usd * c.Rate
+}
+
+// Format converts an amount of US dollars to the currency and formats it
+// with the sign before the currency symbol, e.g. -€12.00.
+func (c Currency) Format(usd float64) string {
+	return c.format(usd, 2)
+}
+
+// FormatPrice formats a unit price like Format, with enough decimals for
+// hourly prices, e.g. $0.000055.
+func (c Currency) FormatPrice(usd float64) string {
+	return c.format(usd, 6)
+}
+
+// FormatSigned formats a change in cost like Format, with a plus sign
+// when it's positive, e.g. +€12.00.
+func (c Currency) FormatSigned(usd float64) string {
+	if c.Convert(usd) > 0 {
+		return "+" + c.Format(usd)
+	}
+	return c.Format(usd)
+}
+
+func (c Currency) format(usd float64, decimals int) string {
+	v := c.Convert(usd)
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	if s, ok := currencySymbols[c.Code]; ok {
+		return fmt.Sprintf("%s%s%.*f", sign, s, decimals, v)
+	}
+	return fmt.Sprintf("%s%s %.*f", sign, c.Code, decimals, v)
+}
+
+// LoadExchangeRates reads a YAML file mapping currency codes to the
+// amount of the currency a US dollar buys, e.g. EUR: 0.92.
+func LoadExchangeRates(path string) (map[string]float64, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading exchange rates: %w", err)
+	}
+
+	var rates map[string]float64
+	if err := yaml.Unmarshal(src, &rates); err != nil {
+		return nil, fmt.Errorf("parsing exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// ExchangeRateQuerier queries the exchange rate of a currency from a
+// metric.
+type ExchangeRateQuerier interface {
+	ExchangeRate(ctx context.Context, metric, code string) (float64, error)
+}
+
+// CurrencyConfig configures the currency costs are reported in.
+type CurrencyConfig struct {
+	// Code is the ISO 4217 code of the currency. Defaults to USD.
+	Code string
+	// RatesFile is a YAML file of exchange rates, see LoadExchangeRates.
+	RatesFile string
+	// RateMetric is a Prometheus metric holding the amount of each
+	// currency a US dollar buys, with a currency label holding its code.
+	// It is only queried if the rates file doesn't have the currency.
+	RateMetric string
+}
+
+// Currency returns the configured currency, with its exchange rate read
+// from the rates file or queried from the rate metric.
+func (c CurrencyConfig) Currency(ctx context.Context, q ExchangeRateQuerier) (Currency, error) {
+	code := strings.ToUpper(c.Code)
+	if code == "" || code == USD.Code {
+		return USD, nil
+	}
+
+	if c.RatesFile != "" {
+		rates, err := LoadExchangeRates(c.RatesFile)
+		if err != nil {
+			return Currency{}, err
+		}
+		if rate, ok := rates[code]; ok {
+			return NewCurrency(code, rate)
+		}
+	}
+
+	if c.RateMetric != "" && q != nil {
+		rate, err := q.ExchangeRate(ctx, c.RateMetric, code)
+		if err != nil {
+			return Currency{}, fmt.Errorf("querying exchange rate of %s: %w", code, err)
+		}
+		return NewCurrency(code, rate)
+	}
+
+	return Currency{}, fmt.Errorf("%w: no exchange rate for %s", ErrUnknownCurrency, code)
+}
+
+// ExchangeRate queries the amount of the currency a US dollar buys from
+// the metric, at the time prices are evaluated at.
+func (c *Client) ExchangeRate(ctx context.Context, metric, code string) (float64, error) {
+	query := fmt.Sprintf(`max(%s{currency=%q})`, metric, code)
+	vec, _, err := c.queryVector(ctx, query, c.pricedAt())
+	if err != nil {
+		return 0, err
+	}
+	if len(vec) == 0 {
+		return 0, ErrNoResults
+	}
+	return float64(vec[0].Value), nil
+}
+
+// ExchangeRate queries the default datasource, or the first one if there
+// is no default.
+func (c *Clients) ExchangeRate(ctx context.Context, metric, code string) (float64, error) {
+	ds := c.fallback
+	if ds == nil && len(c.datasources) > 0 {
+		ds = c.datasources[0]
+	}
+	if ds == nil {
+		return 0, ErrNoDatasource
+	}
+	return ds.Client.ExchangeRate(ctx, metric, code)
+}
@@ -0,0 +1,211 @@
+package costmodel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCurrency_Format(t *testing.T) {
+	tests := []struct {
+		currency Currency
+		usd      float64
+		want     string
+	}{
+		{USD, 12, "$12.00"},
+		{USD, -12, "-$12.00"},
+		{Currency{Code: "EUR", Rate: 0.5}, 12, "€6.00"},
+		{Currency{Code: "GBP", Rate: 0.5}, -12, "-£6.00"},
+		{Currency{Code: "CHF", Rate: 2}, 1.5, "CHF 3.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.currency.Format(tt.usd); got != tt.want {
+			t.Errorf("expecting %v in %s to be %q, got %q", tt.usd, tt.currency.Code, tt.want, got)
+		}
+	}
+	if got := (Currency{Code: "EUR", Rate: 0.5}).FormatPrice(0.00011); got != "€0.000055" {
+		t.Errorf("expecting the price with 6 decimals, got %q", got)
+	}
+	if got := USD.FormatSigned(12); got != "+$12.00" {
+		t.Errorf("expecting a plus sign, got %q", got)
+	}
+}
+
+func TestNewCurrency(t *testing.T) {
+	if c, err := NewCurrency("eur", 0.9); err != nil || c.Code != "EUR" {
+		t.Errorf("expecting EUR, got %v (%v)", c, err)
+	}
+	if _, err := NewCurrency("euro", 0.9); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("expecting ErrUnknownCurrency, got %v", err)
+	}
+	if _, err := NewCurrency("EUR", 0); !errors.Is(err, ErrInvalidRate) {
+		t.Errorf("expecting ErrInvalidRate, got %v", err)
+	}
+}
+
+type fakeRateQuerier map[string]float64
+
+func (f fakeRateQuerier) ExchangeRate(_ context.Context, metric, code string) (float64, error) {
+	if metric != "usd_exchange_rate" {
+		return 0, fmt.Errorf("unexpected metric %s", metric)
+	}
+	rate, ok := f[code]
+	if !ok {
+		return 0, ErrNoResults
+	}
+	return rate, nil
+}
+
+func TestCurrencyConfig_Currency(t *testing.T) {
+	rates := filepath.Join(t.TempDir(), "rates.yaml")
+	if err := os.WriteFile(rates, []byte("EUR: 0.9\nGBP: 0.8\n"), 0o644); err != nil {
+		t.Fatalf("writing rates: %v", err)
+	}
+	q := fakeRateQuerier{"EUR": 0.95, "JPY": 150}
+
+	tests := []struct {
+		name    string
+		cfg     CurrencyConfig
+		want    Currency
+		wantErr error
+	}{
+		{name: "default", cfg: CurrencyConfig{}, want: USD},
+		{name: "usd", cfg: CurrencyConfig{Code: "usd", RatesFile: rates}, want: USD},
+		{name: "rates file", cfg: CurrencyConfig{Code: "gbp", RatesFile: rates}, want: Currency{Code: "GBP", Rate: 0.8}},
+		{name: "rates file first", cfg: CurrencyConfig{Code: "EUR", RatesFile: rates, RateMetric: "usd_exchange_rate"}, want: Currency{Code: "EUR", Rate: 0.9}},
+		{name: "metric", cfg: CurrencyConfig{Code: "JPY", RatesFile: rates, RateMetric: "usd_exchange_rate"}, want: Currency{Code: "JPY", Rate: 150}},
+		{name: "metric without currency", cfg: CurrencyConfig{Code: "CHF", RateMetric: "usd_exchange_rate"}, wantErr: ErrNoResults},
+		{name: "no rate", cfg: CurrencyConfig{Code: "CHF", RatesFile: rates}, wantErr: ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.Currency(context.Background(), q)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expecting %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClient_ExchangeRate(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		if q := r.Form.Get("query"); q != `max(usd_exchange_rate{currency="EUR"})` {
+			t.Errorf("unexpected query %s", q)
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"0.92"]}]}}`)
+	}))
+	defer svr.Close()
+
+	clients, err := NewDatasourceClients("", DatasourceConfig{Name: "prod", Client: &ClientConfig{Address: svr.URL}})
+	if err != nil {
+		t.Fatalf("creating clients: %v", err)
+	}
+	rate, err := clients.ExchangeRate(context.Background(), "usd_exchange_rate", "EUR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !feq(rate, 0.92) {
+		t.Errorf("expecting rate 0.92, got %v", rate)
+	}
+}
+
+func TestReporter_Currency(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	from := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 1
+	eur := Currency{Code: "EUR", Rate: 0.5}
+
+	tests := []struct {
+		reportType ReportType
+		want       []string
+	}{
+		{Table, []string{"€360.00", "-€360.00(-50.0%)", "Costs are in EUR, converted from USD at 0.5 EUR per USD."}},
+		{Summary, []string{"PR changed the overall cost by -€360.00(-50.0%).", "Total Monthly Cost went from €720.00 to €360.00."}},
+		{CSV, []string{",720.00,360.00,-360.00"}},
+		{Markdown, []string{"decrease by €360.00", "€720.00→<br/>€360.00", "Costs are in EUR"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reportType), func(t *testing.T) {
+			var s strings.Builder
+			r := New(&s, string(tt.reportType), WithCurrency(eur))
+			r.AddReport(cm, from, to)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(s.String(), want) {
+					t.Errorf("expecting report to contain %q, got:\n%s", want, s.String())
+				}
+			}
+			if strings.Contains(s.String(), "$") {
+				t.Errorf("expecting no dollars, got:\n%s", s.String())
+			}
+		})
+	}
+}
+
+func TestReporter_writeJSON(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	from := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk", Team: "mimir"}
+	to := from
+	to.Replicas = 1
+
+	var s strings.Builder
+	r := New(&s, string(JSON), WithCurrency(Currency{Code: "GBP", Rate: 0.5}))
+	r.AddReport(cm, from, to)
+	r.AddWarning("something happened")
+	r.AddDiagnostic(Diagnostic{Cluster: "broken", Part: PartCPU, Err: ErrNoResults})
+	if err := r.Write(); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	var got jsonReport
+	if err := json.Unmarshal([]byte(s.String()), &got); err != nil {
+		t.Fatalf("unexpected error decoding %s: %v", s.String(), err)
+	}
+	if got.Currency != "GBP" {
+		t.Errorf("expecting currency GBP, got %s", got.Currency)
+	}
+	if len(got.Workloads) != 1 {
+		t.Fatalf("expecting 1 workload, got %v", got.Workloads)
+	}
+	w := got.Workloads[0]
+	if w.Cluster != "prod" || w.Name != "wk" || w.Team != "mimir" || w.Replicas != 1 || !feq(w.CPU, 360) {
+		t.Errorf("unexpected workload %+v", w)
+	}
+	if !feq(w.Costs["monthly-from"], 720) || !feq(w.Costs["monthly-delta"], -360) || !feq(got.Totals["monthly-to"], 360) {
+		t.Errorf("unexpected costs %v, totals %v", w.Costs, got.Totals)
+	}
+	if len(got.Errors) != 1 || !strings.Contains(got.Errors[0], "could not find CPU cost for cluster broken") {
+		t.Errorf("expecting the diagnostic under errors, got %v", got.Errors)
+	}
+	if len(got.Warnings) != 1 || got.Warnings[0] != "something happened" {
+		t.Errorf("expecting the warning, got %v", got.Warnings)
+	}
+}
@@ -0,0 +1,266 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrNoDatasource        = errors.New("no datasource for cluster")
+	ErrUnknownDatasource   = errors.New("unknown datasource")
+	ErrDuplicateDatasource = errors.New("duplicate datasource")
+)
+
+// Datasource is a named Prometheus datasource, e.g. a Mimir tenant,
+// along with the rules routing clusters to it.
+type Datasource struct {
+	Name   string
+	Client *Client
+	// Clusters are the names of the clusters whose metrics are in the
+	// datasource.
+	Clusters []string
+	// Match, if set, routes the clusters whose name matches it.
+	Match *regexp.Regexp
+}
+
+// DatasourceConfig is the configuration of a Datasource.
+type DatasourceConfig struct {
+	Name   string
+	Client *ClientConfig
+	// Clusters are the names of the clusters routed to the datasource.
+	Clusters []string
+	// Match is a regular expression routing the clusters whose name
+	// matches it to the datasource.
+	Match string
+}
+
+// Clients is a registry of named datasources, routing each cluster to the
+// datasource holding its metrics. Clusters are routed, in order, by their
+// exact name, then by the first datasource whose Match they match, and
+// otherwise to the default datasource.
+type Clients struct {
+	datasources []*Datasource
+	// routes maps cluster names to datasources.
+	routes map[string]*Datasource
+	// fallback is the default datasource. It can be nil.
+	fallback *Datasource
+	// Cache, if set, stores cost models between runs.
+	Cache Cache
+	// Discounts, if set, are applied to the list prices of the cost models.
+	Discounts *Discounts
+}
+
+// NewDatasourceClients creates the registry of the given datasources.
+// Clusters that aren't routed to any datasource use the one named
+// defaultName, if any.
+func NewDatasourceClients(defaultName string, configs ...DatasourceConfig) (*Clients, error) {
+	c := &Clients{routes: make(map[string]*Datasource)}
+
+	for _, cfg := range configs {
+		if err := c.add(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if defaultName != "" {
+		if c.fallback = c.Datasource(defaultName); c.fallback == nil {
+			return nil, fmt.Errorf("%w: default %s", ErrUnknownDatasource, defaultName)
+		}
+	}
+
+	return c, nil
+}
+
+// add creates the client of a datasource and adds it to the registry.
+func (c *Clients) add(cfg DatasourceConfig) error {
+	if c.Datasource(cfg.Name) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateDatasource, cfg.Name)
+	}
+
+	client, err := NewClient(cfg.Client)
+	if err != nil {
+		return fmt.Errorf("creating client for datasource %s: %w", cfg.Name, err)
+	}
+	client.datasource = cfg.Name
+
+	ds := &Datasource{Name: cfg.Name, Client: client, Clusters: cfg.Clusters}
+	if cfg.Match != "" {
+		if ds.Match, err = regexp.Compile(cfg.Match); err != nil {
+			return fmt.Errorf("parsing cluster regex of datasource %s: %w", cfg.Name, err)
+		}
+	}
+	c.datasources = append(c.datasources, ds)
+
+	for _, cluster := range cfg.Clusters {
+		c.routes[cluster] = ds
+	}
+	return nil
+}
+
+// NewClients creates a new cost model clients with the given configuration.
+// Clusters prefixed with dev- are routed to the dev datasource, and every
+// other cluster to the prod datasource.
+func NewClients(prodConfig, devConfig *ClientConfig) (*Clients, error) {
+	clients, err := NewDatasourceClients("prod", DatasourceConfig{Name: "prod", Client: prodConfig})
+	if err != nil {
+		return nil, ErrProdConfigMissing
+	}
+	// It isn't necessary to initiate the dev client therefore we ignore potential errors from this
+	_ = clients.add(DatasourceConfig{Name: "dev", Client: devConfig, Match: "^dev-"})
+	return clients, nil
+}
+
+// MapClusters routes each cluster of the mapping to the datasource it is
+// mapped to, overriding the routes of the datasource configurations.
+func (c *Clients) MapClusters(mapping map[string]string) error {
+	for cluster, name := range mapping {
+		ds := c.Datasource(name)
+		if ds == nil {
+			return fmt.Errorf("%w: %s, mapped to cluster %s", ErrUnknownDatasource, name, cluster)
+		}
+		c.routes[cluster] = ds
+	}
+	return nil
+}
+
+// LoadClusterMapping reads a YAML file mapping cluster names to the name
+// of the datasource holding their metrics.
+func LoadClusterMapping(path string) (map[string]string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cluster mapping: %w", err)
+	}
+
+	var m map[string]string
+	if err := yaml.Unmarshal(src, &m); err != nil {
+		return nil, fmt.Errorf("parsing cluster mapping: %w", err)
+	}
+	return m, nil
+}
+
+// Datasource returns the datasource with the given name, or nil.
+func (c *Clients) Datasource(name string) *Datasource {
+	i := slices.IndexFunc(c.datasources, func(ds *Datasource) bool { return ds.Name == name })
+	if i < 0 {
+		return nil
+	}
+	return c.datasources[i]
+}
+
+// Route returns the datasource holding the metrics of cluster.
+func (c *Clients) Route(cluster string) (*Datasource, error) {
+	if ds, ok := c.routes[cluster]; ok {
+		return ds, nil
+	}
+	for _, ds := range c.datasources {
+		if ds.Match != nil && ds.Match.MatchString(cluster) {
+			return ds, nil
+		}
+	}
+	if c.fallback != nil {
+		return c.fallback, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoDatasource, cluster)
+}
+
+// GetClusterCosts returns the cost for a cluster, querying the datasource it is routed to.
+func (c *Clients) GetClusterCosts(ctx context.Context, cluster string) (*CostModel, error) {
+	start := time.Now()
+	defer func() {
+		slog.Info("GetClusterCosts", "cluster", cluster, "duration", time.Since(start))
+	}()
+	ds, err := c.Route(cluster)
+	if err != nil {
+		return nil, err
+	}
+	cost, err := GetCachedCostModelForCluster(ctx, ds.Client, c.Cache, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("fetching cost model for cluster %s from datasource %s: %w", cluster, ds.Name, err)
+	}
+	if cost.Partial() {
+		slog.Warn("partial cost model", "cluster", cluster, "datasource", ds.Name, "missing", cost.Missing)
+	}
+	// The cache holds list prices, so that changing discounts applies
+	// to cached cost models too.
+	return c.Discounts.Apply(cost), nil
+}
+
+// HPATargeting returns the HPA targeting a workload, see Client.HPATargeting.
+func (c *Clients) HPATargeting(ctx context.Context, cluster, namespace, kind, name string) (string, error) {
+	ds, err := c.Route(cluster)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrHPADetectionFailed, err)
+	}
+	return ds.Client.HPATargeting(ctx, cluster, namespace, kind, name)
+}
+
+// route runs query on the client of the datasource holding the metrics of
+// cluster, for Clients to implement the queriers of the reporter like a
+// single Client.
+func route[T any](c *Clients, cluster string, query func(*Client) (T, error)) (T, error) {
+	ds, err := c.Route(cluster)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return query(ds.Client)
+}
+
+// GetNodePools returns the node pools of a cluster, see Client.GetNodePools.
+func (c *Clients) GetNodePools(ctx context.Context, cluster string) ([]NodePool, error) {
+	return route(c, cluster, func(client *Client) ([]NodePool, error) { return client.GetNodePools(ctx, cluster) })
+}
+
+// GetNodeShapes returns the node shape of each node pool of a cluster, see Client.GetNodeShapes.
+func (c *Clients) GetNodeShapes(ctx context.Context, cluster string) ([]NodeShape, error) {
+	return route(c, cluster, func(client *Client) ([]NodeShape, error) { return client.GetNodeShapes(ctx, cluster) })
+}
+
+// GetClusterRegion returns the region of a cluster, see Client.GetClusterRegion.
+func (c *Clients) GetClusterRegion(ctx context.Context, cluster string) (string, error) {
+	return route(c, cluster, func(client *Client) (string, error) { return client.GetClusterRegion(ctx, cluster) })
+}
+
+// GetPodUsage returns the usage of the pods of a workload, see Client.GetPodUsage.
+func (c *Clients) GetPodUsage(ctx context.Context, cluster, namespace, kind, name string) (PodUsage, error) {
+	return route(c, cluster, func(client *Client) (PodUsage, error) { return client.GetPodUsage(ctx, cluster, namespace, kind, name) })
+}
+
+// GetPodTransmitRate returns the transmit rate of the pods of a workload, see Client.GetPodTransmitRate.
+func (c *Clients) GetPodTransmitRate(ctx context.Context, cluster, namespace, kind, name string) (float64, error) {
+	return route(c, cluster, func(client *Client) (float64, error) {
+		return client.GetPodTransmitRate(ctx, cluster, namespace, kind, name)
+	})
+}
+
+// GetPodSignal returns the rate of a signal of the pods of a workload, see Client.GetPodSignal.
+func (c *Clients) GetPodSignal(ctx context.Context, cluster, query string) (float64, error) {
+	return route(c, cluster, func(client *Client) (float64, error) { return client.GetPodSignal(ctx, cluster, query) })
+}
+
+// GetPriceRange returns the spread of the prices of a cluster, see Client.GetPriceRange.
+func (c *Clients) GetPriceRange(ctx context.Context, cluster string) (PriceRange, error) {
+	return route(c, cluster, func(client *Client) (PriceRange, error) { return client.GetPriceRange(ctx, cluster) })
+}
+
+// GetReplicaRange returns the spread of the replicas of a workload, see Client.GetReplicaRange.
+func (c *Clients) GetReplicaRange(ctx context.Context, cluster, namespace, kind, name string) (Range, error) {
+	return route(c, cluster, func(client *Client) (Range, error) {
+		return client.GetReplicaRange(ctx, cluster, namespace, kind, name)
+	})
+}
+
+// GetObservedReplicas returns the replicas of a workload, see Client.GetObservedReplicas.
+func (c *Clients) GetObservedReplicas(ctx context.Context, cluster, namespace, kind, name string) (float64, error) {
+	return route(c, cluster, func(client *Client) (float64, error) {
+		return client.GetObservedReplicas(ctx, cluster, namespace, kind, name)
+	})
+}
@@ -0,0 +1,153 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClients_Route(t *testing.T) {
+	local := &ClientConfig{Address: "http://localhost:9090"}
+
+	clients, err := NewDatasourceClients("ops",
+		DatasourceConfig{Name: "ops", Client: local},
+		DatasourceConfig{Name: "eu", Client: local, Match: `-eu-`},
+		DatasourceConfig{Name: "us", Client: local, Match: `-us-`, Clusters: []string{"prod-eu-special-0"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := clients.MapClusters(map[string]string{"dev-us-central-0": "eu"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]string{
+		"prod-eu-west-0":    "eu",
+		"prod-us-east-0":    "us",
+		"prod-eu-special-0": "us",  // exact name before regex
+		"dev-us-central-0":  "eu",  // mapping file
+		"ops-0":             "ops", // default
+	}
+	for cluster, want := range tests {
+		ds, err := clients.Route(cluster)
+		if err != nil {
+			t.Errorf("unexpected error routing %s: %v", cluster, err)
+			continue
+		}
+		if ds.Name != want {
+			t.Errorf("expecting %s to be routed to %s, got %s", cluster, want, ds.Name)
+		}
+	}
+
+	t.Run("no default", func(t *testing.T) {
+		clients, err := NewDatasourceClients("", DatasourceConfig{Name: "eu", Client: local, Match: `-eu-`})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := clients.Route("prod-us-east-0"); !errors.Is(err, ErrNoDatasource) {
+			t.Errorf("expecting ErrNoDatasource, got %v", err)
+		}
+	})
+}
+
+func TestClients_route(t *testing.T) {
+	signal := func(value string) *ClientConfig {
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"%s"]}]}}`, value)
+		}))
+		t.Cleanup(svr.Close)
+		return &ClientConfig{Address: svr.URL}
+	}
+	clients, err := NewDatasourceClients("",
+		DatasourceConfig{Name: "eu", Client: signal("1"), Match: `-eu-`},
+		DatasourceConfig{Name: "us", Client: signal("2"), Match: `-us-`},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for cluster, want := range map[string]float64{"prod-eu-west-0": 1, "prod-us-east-0": 2} {
+		if got, err := clients.GetPodSignal(context.Background(), cluster, "up"); err != nil || got != want {
+			t.Errorf("expecting %s to be queried on its datasource, got %v, %v", cluster, got, err)
+		}
+	}
+	if _, err := clients.GetNodeShapes(context.Background(), "dev"); !errors.Is(err, ErrNoDatasource) {
+		t.Errorf("expecting ErrNoDatasource, got %v", err)
+	}
+}
+
+func TestNewDatasourceClients_Errors(t *testing.T) {
+	local := &ClientConfig{Address: "http://localhost:9090"}
+
+	tests := []struct {
+		name        string
+		defaultName string
+		configs     []DatasourceConfig
+		wantErr     error
+	}{
+		{"duplicate", "", []DatasourceConfig{{Name: "a", Client: local}, {Name: "a", Client: local}}, ErrDuplicateDatasource},
+		{"unknown default", "b", []DatasourceConfig{{Name: "a", Client: local}}, ErrUnknownDatasource},
+		{"missing address", "", []DatasourceConfig{{Name: "a", Client: &ClientConfig{}}}, ErrEmptyAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDatasourceClients(tt.defaultName, tt.configs...); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expecting %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("invalid regex", func(t *testing.T) {
+		if _, err := NewDatasourceClients("", DatasourceConfig{Name: "a", Client: local, Match: "("}); err == nil {
+			t.Errorf("expecting error for invalid regex")
+		}
+	})
+
+	t.Run("unknown mapped datasource", func(t *testing.T) {
+		clients, err := NewDatasourceClients("", DatasourceConfig{Name: "a", Client: local})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := clients.MapClusters(map[string]string{"c": "b"}); !errors.Is(err, ErrUnknownDatasource) {
+			t.Errorf("expecting ErrUnknownDatasource, got %v", err)
+		}
+	})
+}
+
+func TestNewClients_Routing(t *testing.T) {
+	clients, err := NewClients(&ClientConfig{Address: "http://prod"}, &ClientConfig{Address: "http://dev"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for cluster, want := range map[string]string{"dev-us-central-0": "dev", "prod-us-central-0": "prod"} {
+		if ds, err := clients.Route(cluster); err != nil || ds.Name != want {
+			t.Errorf("expecting %s to be routed to %s, got %v (%v)", cluster, want, ds, err)
+		}
+	}
+
+	// Tenants can share an address, cached cost models must not.
+	if a, b := clients.Datasource("prod").Client.backend(), clients.Datasource("dev").Client.backend(); a == b {
+		t.Errorf("expecting datasources to have distinct backends, got %s", a)
+	}
+}
+
+func TestLoadClusterMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.yaml")
+	if err := os.WriteFile(path, []byte("prod-us-central-0: us\nops-eu-west-0: ops\n"), 0o644); err != nil {
+		t.Fatalf("writing mapping: %v", err)
+	}
+
+	got, err := LoadClusterMapping(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]string{"prod-us-central-0": "us", "ops-eu-west-0": "ops"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expecting %v, got %v", want, got)
+	}
+}
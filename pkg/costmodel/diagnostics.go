@@ -0,0 +1,130 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Diagnostic describes a problem with a query for the cost model of a
+// cluster: either the part it was for is missing, or Prometheus returned
+// warnings along with the result.
+type Diagnostic struct {
+	Cluster string
+	// Part is what the query was for, see the Part constants.
+	Part  string
+	Query string
+	// Err is why the part is missing. It is nil if the part was found.
+	Err      error `json:"-"`
+	Warnings []string
+}
+
+// Missing reports whether the part the query was for is missing.
+func (d Diagnostic) Missing() bool {
+	return d.Err != nil
+}
+
+// String describes the diagnostic in one line, without the query.
+func (d Diagnostic) String() string {
+	if d.Missing() {
+		return fmt.Sprintf("could not find %s for cluster %s: %s", d.Part, d.Cluster, d.Err)
+	}
+	return fmt.Sprintf("querying %s for cluster %s returned warnings: %s", d.Part, d.Cluster, strings.Join(d.Warnings, "; "))
+}
+
+// Hint suggests how to fix the cause of the diagnostic, if known.
+func (d Diagnostic) Hint() string {
+	switch {
+	case errors.Is(d.Err, ErrNoResults):
+		return "No series matched the query; check that the pricing metrics are exported and scraped for this cluster."
+	case errors.Is(d.Err, context.DeadlineExceeded):
+		return "The query timed out; try raising the query timeout."
+	case d.Err != nil:
+		return "The query failed; check the Prometheus address, credentials and logs."
+	default:
+		return ""
+	}
+}
+
+// reportedDiagnostic is a diagnostic along with its consequence on a
+// report.
+type reportedDiagnostic struct {
+	Diagnostic
+	// partial is set when the cost model missing the part is still
+	// used in the report.
+	partial bool
+}
+
+// consequence explains how a missing part affects the report.
+func (d reportedDiagnostic) consequence() string {
+	switch {
+	case !d.Missing():
+		return ""
+	case d.partial:
+		return "It counts as $0 in this report."
+	default:
+		return "The cluster was left out of this report."
+	}
+}
+
+// text renders the diagnostic for plain text reports.
+func (d reportedDiagnostic) text() string {
+	level := "Warning"
+	if d.Missing() {
+		level = "Error"
+	}
+
+	msg := []string{d.String() + "."}
+	for _, s := range []string{d.consequence(), d.Hint()} {
+		if s != "" {
+			msg = append(msg, s)
+		}
+	}
+
+	out := fmt.Sprintf("%s: %s\n", level, strings.Join(msg, " "))
+	if d.Query != "" {
+		out += fmt.Sprintf("  Query: %s\n", compactQuery(d.Query))
+	}
+	return out
+}
+
+// markdown renders the diagnostic for the markdown report, with the
+// query in a collapsed block.
+func (d reportedDiagnostic) markdown() string {
+	var b strings.Builder
+	b.WriteString(html.EscapeString(d.String()) + ".")
+	for _, s := range []string{d.consequence(), d.Hint()} {
+		if s != "" {
+			b.WriteString(" " + s)
+		}
+	}
+	if d.Query != "" {
+		fmt.Fprintf(&b, "<details><summary>Query</summary><pre><code class=\"notranslate\">%s</code></pre></details>", html.EscapeString(strings.TrimSpace(d.Query)))
+	}
+	return b.String()
+}
+
+// CostModelError is returned when the cost model of a cluster can't be
+// queried. It holds a diagnostic for each missing part.
+type CostModelError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *CostModelError) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		msgs = append(msgs, d.String())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the missing parts.
+func (e *CostModelError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		errs = append(errs, d.Err)
+	}
+	return errs
+}
@@ -0,0 +1,136 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetCostModelForCluster_Diagnostics(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		switch q := r.Form.Get("query"); {
+		case strings.Contains(q, "persistent_volume"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case strings.Contains(q, "nodepool"):
+			fmt.Fprint(w, `{"status":"success","warnings":["results may be incomplete"],"data":{"resultType":"vector","result":[{"metric":{},"value":[0,"4"]}]}}`)
+		default:
+			fmt.Fprint(w, oneSampleVector)
+		}
+	}))
+	defer svr.Close()
+
+	t.Run("strict", func(t *testing.T) {
+		c, err := NewClient(&ClientConfig{Address: svr.URL})
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+
+		_, err = GetCostModelForCluster(context.Background(), c, "test")
+		var cmErr *CostModelError
+		if !errors.As(err, &cmErr) {
+			t.Fatalf("expecting a *CostModelError, got %v", err)
+		}
+		if !errors.Is(err, ErrNoResults) {
+			t.Errorf("expecting error to wrap ErrNoResults, got %v", err)
+		}
+		if len(cmErr.Diagnostics) != 1 {
+			t.Fatalf("expecting a diagnostic for the missing part only, got %v", cmErr.Diagnostics)
+		}
+		d := cmErr.Diagnostics[0]
+		if d.Cluster != "test" || d.Part != PartPersistentVolume || !strings.Contains(d.Query, `pv_hourly_cost{cluster="test"}`) {
+			t.Errorf("expecting diagnostic with the cluster, part and query, got %+v", d)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		c, err := NewClient(&ClientConfig{Address: svr.URL, AllowPartial: true})
+		if err != nil {
+			t.Fatalf("creating client: %v", err)
+		}
+
+		cm, err := GetCostModelForCluster(context.Background(), c, "test")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(cm.Diagnostics) != 2 {
+			t.Fatalf("expecting 2 diagnostics, got %v", cm.Diagnostics)
+		}
+		if w := cm.Diagnostics[1]; w.Missing() || w.Part != PartNodeCount || len(w.Warnings) != 1 || w.Warnings[0] != "results may be incomplete" {
+			t.Errorf("expecting node count query warnings, got %+v", w)
+		}
+	})
+}
+
+func TestDiagnostic_Hint(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{fmt.Errorf("wrapped: %w", ErrNoResults), "No series matched"},
+		{fmt.Errorf("%w: %w", ErrBadQuery, context.DeadlineExceeded), "timed out"},
+		{ErrBadQuery, "query failed"},
+	}
+	for _, tt := range tests {
+		if got := (Diagnostic{Err: tt.err}).Hint(); !strings.Contains(got, tt.want) || (tt.want == "" && got != "") {
+			t.Errorf("expecting hint for %v to contain %q, got %q", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestReporter_AddCostModelError(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "ok"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	req := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	err := &CostModelError{Diagnostics: []Diagnostic{
+		{Cluster: "broken", Part: PartCPU, Query: `cpu{cluster="broken"} > 0`, Err: ErrNoResults},
+	}}
+
+	t.Run("markdown", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Markdown))
+		r.AddCostModelError("broken", err)
+		r.AddReport(cm, req, req)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		for _, want := range []string{
+			"could not find CPU cost for cluster broken: no cost results. The cluster was left out of this report. No series matched",
+			`<pre><code class="notranslate">cpu{cluster=&#34;broken&#34;} &gt; 0</code></pre>`,
+		} {
+			if !strings.Contains(s.String(), want) {
+				t.Errorf("expecting markdown to contain %q, got:\n%s", want, s.String())
+			}
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Table))
+		r.AddCostModelError("broken", err)
+		r.AddReport(cm, req, req)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if !strings.Contains(s.String(), "Error: could not find CPU cost for cluster broken") || !strings.Contains(s.String(), `  Query: cpu{cluster="broken"} > 0`) {
+			t.Errorf("expecting table to list the diagnostic, got:\n%s", s.String())
+		}
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		r := New(nil, string(Markdown))
+		r.AddCostModelError("broken", errors.New("boom"))
+		if len(r.errors) != 1 || r.errors[0] != "could not get cost model for cluster broken: boom" {
+			t.Errorf("expecting the error to be added as is, got %v", r.errors)
+		}
+	})
+}
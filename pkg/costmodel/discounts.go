@@ -0,0 +1,159 @@
+package costmodel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+)
+
+var ErrInvalidDiscount = errors.New("invalid discount")
+
+// Resources and price tiers a DiscountRule can be restricted to.
+const (
+	ResourceCPU     = "cpu"
+	ResourceMemory  = "memory"
+	ResourceStorage = "storage"
+
+	TierOnDemand = "ondemand"
+	TierSpot     = "spot"
+)
+
+// DiscountRule lowers list prices by a percentage, e.g. an enterprise
+// discount, or a committed-use discount or savings plan covering part of
+// the usage. Empty fields match everything.
+type DiscountRule struct {
+	// Name identifies the discount in reports.
+	Name string `json:"name"`
+	// Cloud is the provider the discount applies to, e.g. aws, azure or gcp.
+	Cloud string `json:"cloud,omitempty"`
+	// Cluster is a glob matching the names of the clusters the discount
+	// applies to, e.g. prod-*.
+	Cluster string `json:"cluster,omitempty"`
+	// Resource is one of cpu, memory or storage.
+	Resource string `json:"resource,omitempty"`
+	// Tier is one of ondemand or spot.
+	Tier string `json:"tier,omitempty"`
+	// Percent is the discount off the list price.
+	Percent float64 `json:"percent"`
+	// Coverage is the fraction of the usage the discount applies to, e.g.
+	// 0.7 for a commitment covering 70% of the usage. Zero means 1.
+	Coverage float64 `json:"coverage,omitempty"`
+}
+
+// factor returns what the effective price is a fraction of the list price.
+func (d DiscountRule) factor() float64 {
+	coverage := d.Coverage
+	if coverage == 0 {
+		coverage = 1
+	}
+	return 1 - d.Percent/100*coverage
+}
+
+func (d DiscountRule) validate() error {
+	switch {
+	case d.Name == "":
+		return fmt.Errorf("%w: missing name", ErrInvalidDiscount)
+	case d.Percent <= 0 || d.Percent > 100:
+		return fmt.Errorf("%w: %s: percent must be in (0, 100], got %v", ErrInvalidDiscount, d.Name, d.Percent)
+	case d.Coverage < 0 || d.Coverage > 1:
+		return fmt.Errorf("%w: %s: coverage must be in [0, 1], got %v", ErrInvalidDiscount, d.Name, d.Coverage)
+	case !slices.Contains([]string{"", ResourceCPU, ResourceMemory, ResourceStorage}, d.Resource):
+		return fmt.Errorf("%w: %s: unknown resource %q", ErrInvalidDiscount, d.Name, d.Resource)
+	case !slices.Contains([]string{"", TierOnDemand, TierSpot}, d.Tier):
+		return fmt.Errorf("%w: %s: unknown tier %q", ErrInvalidDiscount, d.Name, d.Tier)
+	}
+	if _, err := path.Match(d.Cluster, ""); err != nil {
+		return fmt.Errorf("%w: %s: cluster glob: %w", ErrInvalidDiscount, d.Name, err)
+	}
+	return nil
+}
+
+// matches returns whether the rule applies to the cost model.
+func (d DiscountRule) matches(cm *CostModel) bool {
+	if d.Cloud != "" && d.Cloud != cm.Cloud {
+		return false
+	}
+	if d.Cluster != "" {
+		if cm.Cluster == nil {
+			return false
+		}
+		if ok, _ := path.Match(d.Cluster, cm.Cluster.Name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// apply discounts the prices of a resource. On-demand discounts apply
+// to prices without a price tier as well.
+func (d DiscountRule) apply(resource string, c Cost) Cost {
+	if d.Resource != "" && d.Resource != resource {
+		return c
+	}
+	f := d.factor()
+	if d.Tier != TierSpot {
+		c.NonSpot *= f
+		c.Dollars *= f
+	}
+	if d.Tier != TierOnDemand {
+		c.Spot *= f
+	}
+	return c
+}
+
+// Discounts are the discounts negotiated with cloud providers. Every
+// rule matching a cost model applies, so that e.g. a committed-use
+// discount compounds with an enterprise discount.
+type Discounts struct {
+	Rules []DiscountRule `json:"discounts"`
+}
+
+// LoadDiscounts reads the discounts from a YAML file with a top-level
+// discounts list.
+func LoadDiscounts(path string) (*Discounts, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading discounts: %w", err)
+	}
+
+	var d Discounts
+	if err := yaml.UnmarshalStrict(src, &d); err != nil {
+		return nil, fmt.Errorf("parsing discounts: %w", err)
+	}
+	for _, r := range d.Rules {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// Apply returns a copy of the cost model with the effective prices,
+// keeping the list prices in its List field. The cost model is returned
+// as is if no discount applies to it.
+func (d *Discounts) Apply(cm *CostModel) *CostModel {
+	if d == nil || cm == nil {
+		return cm
+	}
+
+	effective := *cm
+	effective.Discounts = nil
+	for _, r := range d.Rules {
+		if !r.matches(cm) {
+			continue
+		}
+		effective.CPU = r.apply(ResourceCPU, effective.CPU)
+		effective.RAM = r.apply(ResourceMemory, effective.RAM)
+		effective.PersistentVolume = r.apply(ResourceStorage, effective.PersistentVolume)
+		effective.Discounts = append(effective.Discounts, r.Name)
+	}
+	if len(effective.Discounts) == 0 {
+		return cm
+	}
+	effective.List = cm
+	return &effective
+}
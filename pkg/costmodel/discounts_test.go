@@ -0,0 +1,237 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadDiscounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []DiscountRule
+		wantErr error
+	}{
+		{
+			name: "valid",
+			src: `discounts:
+  - name: edp
+    cloud: aws
+    percent: 10
+  - name: cud
+    cluster: prod-*
+    resource: cpu
+    tier: ondemand
+    percent: 37
+    coverage: 0.8
+`,
+			want: []DiscountRule{
+				{Name: "edp", Cloud: "aws", Percent: 10},
+				{Name: "cud", Cluster: "prod-*", Resource: ResourceCPU, Tier: TierOnDemand, Percent: 37, Coverage: 0.8},
+			},
+		},
+		{name: "missing name", src: "discounts: [{percent: 10}]", wantErr: ErrInvalidDiscount},
+		{name: "percent out of range", src: "discounts: [{name: a, percent: 110}]", wantErr: ErrInvalidDiscount},
+		{name: "unknown resource", src: "discounts: [{name: a, percent: 10, resource: gpu}]", wantErr: ErrInvalidDiscount},
+		{name: "unknown tier", src: "discounts: [{name: a, percent: 10, tier: reserved}]", wantErr: ErrInvalidDiscount},
+		{name: "bad glob", src: "discounts: [{name: a, percent: 10, cluster: '['}]", wantErr: ErrInvalidDiscount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "discounts.yaml")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("writing discounts: %v", err)
+			}
+
+			got, err := LoadDiscounts(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Rules, tt.want) {
+				t.Errorf("expecting %+v, got %+v", tt.want, got.Rules)
+			}
+		})
+	}
+
+	t.Run("unknown field", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "discounts.yaml")
+		if err := os.WriteFile(path, []byte("discounts: [{name: a, percnt: 10}]"), 0o644); err != nil {
+			t.Fatalf("writing discounts: %v", err)
+		}
+		if _, err := LoadDiscounts(path); err == nil {
+			t.Errorf("expecting error for misspelled field")
+		}
+	})
+}
+
+func TestDiscounts_Apply(t *testing.T) {
+	list := &CostModel{
+		Cluster:          &Cluster{Name: "prod-us-east-0"},
+		Cloud:            "aws",
+		CPU:              Cost{NonSpot: 10, Spot: 4},
+		RAM:              Cost{NonSpot: 2, Spot: 1},
+		PersistentVolume: Cost{Dollars: 1},
+	}
+
+	tests := []struct {
+		name      string
+		rules     []DiscountRule
+		wantCPU   Cost
+		wantRAM   Cost
+		wantPV    Cost
+		discounts []string
+	}{
+		{
+			name:  "no match",
+			rules: []DiscountRule{{Name: "gcp", Cloud: "gcp", Percent: 10}, {Name: "dev", Cluster: "dev-*", Percent: 10}},
+		},
+		{
+			name:      "enterprise discount",
+			rules:     []DiscountRule{{Name: "edp", Cloud: "aws", Percent: 10}},
+			wantCPU:   Cost{NonSpot: 9, Spot: 3.6},
+			wantRAM:   Cost{NonSpot: 1.8, Spot: 0.9},
+			wantPV:    Cost{Dollars: 0.9},
+			discounts: []string{"edp"},
+		},
+		{
+			name:      "partially covered on-demand CPU",
+			rules:     []DiscountRule{{Name: "cud", Cluster: "prod-*", Resource: ResourceCPU, Tier: TierOnDemand, Percent: 50, Coverage: 0.5}},
+			wantCPU:   Cost{NonSpot: 7.5, Spot: 4},
+			wantRAM:   list.RAM,
+			wantPV:    list.PersistentVolume,
+			discounts: []string{"cud"},
+		},
+		{
+			name: "compounding",
+			rules: []DiscountRule{
+				{Name: "edp", Percent: 10},
+				{Name: "spot", Resource: ResourceMemory, Tier: TierSpot, Percent: 50},
+			},
+			wantCPU:   Cost{NonSpot: 9, Spot: 3.6},
+			wantRAM:   Cost{NonSpot: 1.8, Spot: 0.45},
+			wantPV:    Cost{Dollars: 0.9},
+			discounts: []string{"edp", "spot"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (&Discounts{Rules: tt.rules}).Apply(list)
+			if tt.discounts == nil {
+				if got != list {
+					t.Errorf("expecting cost model to be returned as is, got %+v", got)
+				}
+				return
+			}
+
+			if got.List != list || got.ListPrices() != list {
+				t.Errorf("expecting list prices to be kept")
+			}
+			if !reflect.DeepEqual(got.Discounts, tt.discounts) {
+				t.Errorf("expecting discounts %v, got %v", tt.discounts, got.Discounts)
+			}
+			for _, c := range []struct {
+				name      string
+				got, want Cost
+			}{{"CPU", got.CPU, tt.wantCPU}, {"RAM", got.RAM, tt.wantRAM}, {"PV", got.PersistentVolume, tt.wantPV}} {
+				if !feq(c.got.NonSpot, c.want.NonSpot) || !feq(c.got.Spot, c.want.Spot) || !feq(c.got.Dollars, c.want.Dollars) {
+					t.Errorf("expecting %s cost %+v, got %+v", c.name, c.want, c.got)
+				}
+			}
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		var d *Discounts
+		if got := d.Apply(list); got != list {
+			t.Errorf("expecting cost model to be returned as is, got %+v", got)
+		}
+	})
+}
+
+func TestGetCostModelForCluster_Cloud(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		if q := r.Form.Get("query"); strings.Contains(q, "cloudcost_") && !strings.Contains(q, "nodepool") {
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"cloud":"gcp","price_tier":"ondemand"},"value":[0,"4"]}]}}`)
+			return
+		}
+		fmt.Fprint(w, oneSampleVector)
+	}))
+	defer svr.Close()
+
+	c, err := NewClient(&ClientConfig{Address: svr.URL})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	cm, err := GetCostModelForCluster(context.Background(), c, "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cm.Cloud != "gcp" {
+		t.Errorf("expecting cloud to be gcp, got %q", cm.Cloud)
+	}
+}
+
+func TestReporter_ListPrices(t *testing.T) {
+	list := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	cm := (&Discounts{Rules: []DiscountRule{{Name: "edp", Percent: 20}}}).Apply(list)
+	from := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 2
+
+	tests := []struct {
+		reportType ReportType
+		want       []string
+	}{
+		{Table, []string{"List Monthly Cost", "$1440.00", "$720.00(100.0%)", "Prices for cluster prod include discounts: edp."}},
+		{Summary, []string{"Total Monthly Cost went from $576.00 to $1152.00.", "Total Monthly Cost at list prices went from $720.00 to $1440.00."}},
+		{CSV, []string{"list_monthly_from,list_monthly_to,list_monthly_delta", ",720.00,1440.00,720.00"}},
+		{Markdown, []string{"At list prices, before discounts, monthly cost will go from $720.00 to $1440.00 ($720.00).", "include discounts: edp."}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reportType), func(t *testing.T) {
+			var s strings.Builder
+			r := New(&s, string(tt.reportType), WithListPrices())
+			r.AddReport(cm, from, to)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(s.String(), want) {
+					t.Errorf("expecting report to contain %q, got:\n%s", want, s.String())
+				}
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Table))
+		r.AddReport(cm, from, to)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if strings.Contains(s.String(), "List Monthly Cost") {
+			t.Errorf("expecting no list prices, got:\n%s", s.String())
+		}
+	})
+}
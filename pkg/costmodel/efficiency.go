@@ -0,0 +1,216 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/grafana/kost/pkg/costmodel/utils"
+)
+
+const (
+	// queryPodCPUUsageP95 reports the highest p95 of the CPU cores used by a pod of a workload over a window.
+	// Format args: cluster, namespace, owned pods, window.
+	queryPodCPUUsageP95 = `max(quantile_over_time(0.95, sum by (pod) (rate(container_cpu_usage_seconds_total{cluster="%s", namespace="%s", container!=""}[5m]) * on (namespace, pod) group_left() %s)[%s:5m]))`
+
+	// queryPodMemoryUsageP95 reports the highest p95 of the memory bytes used by a pod of a workload over a window.
+	// Format args: cluster, namespace, owned pods, window.
+	queryPodMemoryUsageP95 = `max(quantile_over_time(0.95, sum by (pod) (container_memory_working_set_bytes{cluster="%s", namespace="%s", container!=""} * on (namespace, pod) group_left() %s)[%s:5m]))`
+)
+
+// usageWindow is the window the usage of a workload is observed over.
+const usageWindow = 7 * 24 * time.Hour
+
+// overProvisionedRatio is the share of its request a resource must use not
+// to be flagged as over-provisioned.
+const overProvisionedRatio = 0.5
+
+// PodUsage holds the p95 of the resources used by the pods of a workload
+// over the usage window, for the pod using the most. CPU is in cores and
+// memory in bytes.
+type PodUsage struct {
+	CPU    float64
+	Memory float64
+}
+
+// UsageQuerier is the subset of *Client behavior Reporter.AddUsage needs.
+type UsageQuerier interface {
+	GetPodUsage(ctx context.Context, cluster, namespace, kind, name string) (PodUsage, error)
+}
+
+var (
+	_ UsageQuerier = (*Client)(nil)
+	_ UsageQuerier = (*Clients)(nil)
+)
+
+// GetPodUsage returns the p95 of the CPU and memory used by the pods of the given
+// workload over the last 7 days, see PodUsage. Pods are matched by their owner,
+// see ownedPods. Returns ErrNoResults if
+// the workload has no usage, e.g. because it isn't deployed yet.
+func (c *Client) GetPodUsage(ctx context.Context, cluster, namespace, kind, name string) (PodUsage, error) {
+	var u PodUsage
+
+	pods := ownedPods(cluster, namespace, kind, name)
+	w := model.Duration(usageWindow).String()
+
+	queries := []struct {
+		query string
+		value *float64
+	}{
+		{fmt.Sprintf(queryPodCPUUsageP95, cluster, namespace, pods, w), &u.CPU},
+		{fmt.Sprintf(queryPodMemoryUsageP95, cluster, namespace, pods, w), &u.Memory},
+	}
+
+	for _, q := range queries {
+		results, err := c.query(ctx, q.query)
+		if err != nil {
+			return u, fmt.Errorf("%w: %w", ErrBadQuery, err)
+		}
+		vec, ok := results.(model.Vector)
+		if !ok {
+			return u, fmt.Errorf("%w: unexpected result type %T", ErrBadQuery, results)
+		}
+		if len(vec) == 0 {
+			return u, ErrNoResults
+		}
+		*q.value = float64(vec[0].Value)
+	}
+
+	return u, nil
+}
+
+// AddUsage queries the usage of the workloads modified by the reports
+// added so far, to compare it with their new requests. Workloads without
+// usage, e.g. not deployed yet, are left out; failed queries are added as
+// warnings, since usage doesn't change the reported costs.
+func (r *Reporter) AddUsage(ctx context.Context, q UsageQuerier) {
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil || m.From.Kind == "" || m.To.Kind == "" {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		u, err := q.GetPodUsage(ctx, cluster, m.To.Namespace, m.To.Kind, m.To.Name)
+		if errors.Is(err, ErrNoResults) {
+			continue
+		} else if err != nil {
+			r.AddWarning(fmt.Sprintf("querying usage of %s/%s/%s on %s: %v",
+				m.To.Namespace, m.To.Kind, m.To.Name, cluster, err))
+			continue
+		}
+		r.reports[i].usage = &u
+	}
+}
+
+// Efficiency compares the resources requested by the pods of a workload
+// with their usage.
+type Efficiency struct {
+	Cluster   string
+	Namespace string
+	Kind      string
+	Name      string
+	Replicas  int
+	// CPURequest is the CPU cores requested by a pod, MemoryRequest the
+	// memory bytes.
+	CPURequest    float64
+	MemoryRequest float64
+	Usage         PodUsage
+	// Savings is the cost over the report period of the over-provisioned
+	// requests above usage, in US dollars.
+	Savings float64
+}
+
+// OverProvisionedCPU returns whether the pods use less than half the CPU
+// they request.
+func (e Efficiency) OverProvisionedCPU() bool {
+	return e.Usage.CPU < e.CPURequest*overProvisionedRatio
+}
+
+// OverProvisionedMemory returns whether the pods use less than half the
+// memory they request.
+func (e Efficiency) OverProvisionedMemory() bool {
+	return e.Usage.Memory < e.MemoryRequest*overProvisionedRatio
+}
+
+// OverProvisioned returns whether the CPU or memory is over-provisioned.
+func (e Efficiency) OverProvisioned() bool {
+	return e.OverProvisionedCPU() || e.OverProvisionedMemory()
+}
+
+// CPU describes the CPU requested and used by a pod, e.g. requests 4 CPU,
+// uses 0.3.
+func (e Efficiency) CPU() string {
+	return fmt.Sprintf("requests %s CPU, uses %s", formatAmount(e.CPURequest), formatAmount(e.Usage.CPU))
+}
+
+// Memory describes the memory requested and used by a pod, e.g. requests
+// 8 GiB memory, uses 1.2 GiB.
+func (e Efficiency) Memory() string {
+	return fmt.Sprintf("requests %s GiB memory, uses %s GiB",
+		formatAmount(utils.BytesToGiB(int64(e.MemoryRequest))), formatAmount(utils.BytesToGiB(int64(e.Usage.Memory))))
+}
+
+// formatAmount formats an amount rounded to two decimals, without
+// trailing zeros.
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// efficiencies returns the efficiency of the workloads whose usage was
+// added, see efficiency.
+func (r *Reporter) efficiencies() []Efficiency {
+	var es []Efficiency
+	for _, m := range r.reports {
+		if e, ok := r.efficiency(m); ok {
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+// efficiency returns the efficiency of the workload of the report, with
+// the savings over the main period, if its usage was added.
+func (r *Reporter) efficiency(m report) (Efficiency, bool) {
+	if m.usage == nil {
+		return Efficiency{}, false
+	}
+	e := Efficiency{
+		Cluster:       m.CostModel.Cluster.Name,
+		Namespace:     m.To.Namespace,
+		Kind:          m.To.Kind,
+		Name:          m.To.Name,
+		Replicas:      m.To.Replicas,
+		CPURequest:    float64(m.To.CPUPerPod) / 1000,
+		MemoryRequest: float64(m.To.MemoryPerPod),
+		Usage:         *m.usage,
+	}
+	hours := float64(r.mainPeriod()) * float64(e.Replicas)
+	if e.OverProvisionedCPU() {
+		e.Savings += (e.CPURequest - e.Usage.CPU) * m.CostModel.CPU.NonSpot * hours
+	}
+	if e.OverProvisionedMemory() {
+		e.Savings += utils.BytesToGiB(int64(e.MemoryRequest-e.Usage.Memory)) * m.CostModel.RAM.NonSpot * hours
+	}
+	return e, true
+}
+
+// text describes the over-provisioned resources of the workload and the
+// savings of right-sizing them.
+func (e Efficiency) text(c Currency, p Period) string {
+	var s string
+	if e.OverProvisionedCPU() {
+		s = e.CPU()
+	}
+	if e.OverProvisionedMemory() {
+		if s != "" {
+			s += "; "
+		}
+		s += e.Memory()
+	}
+	return fmt.Sprintf("%s/%s/%s on %s %s at p95 over the last 7 days: right-sizing could save %s %s.\n",
+		e.Namespace, e.Kind, e.Name, e.Cluster, s, c.Format(e.Savings), p)
+}
@@ -0,0 +1,111 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const gib = 1 << 30
+
+type fakeUsageQuerier map[string]PodUsage
+
+func (f fakeUsageQuerier) GetPodUsage(_ context.Context, cluster, namespace, kind, name string) (PodUsage, error) {
+	if name == "broken" {
+		return PodUsage{}, errors.New("boom")
+	}
+	u, ok := f[name]
+	if !ok {
+		return PodUsage{}, ErrNoResults
+	}
+	return u, nil
+}
+
+func TestClient_GetPodUsage(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		q := r.Form.Get("query")
+		switch {
+		case strings.Contains(q, `rate(container_cpu_usage_seconds_total{cluster="prod", namespace="ns", container!=""}[5m]) * on (namespace, pod) group_left() max by (namespace, pod) (kube_pod_owner{cluster="prod", namespace="ns", owner_kind="StatefulSet", owner_name="wk"}))[1w:5m]`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"0.3"]}]}}`)
+		case strings.Contains(q, `container_memory_working_set_bytes{cluster="prod", namespace="ns", container!=""} * on (namespace, pod) group_left() max by (namespace, pod) (kube_pod_owner{cluster="prod", namespace="ns", owner_kind="StatefulSet", owner_name="wk"}))[1w:5m]`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			t.Errorf("unexpected query %s", q)
+		}
+	})
+
+	if _, err := c.GetPodUsage(context.Background(), "prod", "ns", "StatefulSet", "wk"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without memory usage, got %v", err)
+	}
+}
+
+func TestReporter_AddUsage(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+		RAM:     Cost{NonSpot: 1},
+	}
+	from := Requirements{CPUPerPod: 4000, MemoryPerPod: 8 * gib, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 3
+	fit := Requirements{CPUPerPod: 1000, MemoryPerPod: gib, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "fit"}
+	added := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "added"}
+	broken := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "broken"}
+	q := fakeUsageQuerier{
+		"wk":    {CPU: 0.3, Memory: 6 * gib},
+		"fit":   {CPU: 0.8, Memory: 0.9 * gib},
+		"added": {CPU: 0.1},
+	}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(cm, from, to)
+		r.AddReport(cm, fit, fit)
+		r.AddReport(cm, Requirements{}, added)
+		r.AddReport(cm, broken, broken)
+		r.AddUsage(context.Background(), q)
+		return r
+	})
+
+	t.Run("efficiencies", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		es := r.efficiencies()
+		if len(es) != 2 {
+			t.Fatalf("expecting the usage of the modified workloads only, got %+v", es)
+		}
+		if e := es[0]; !e.OverProvisionedCPU() || e.OverProvisionedMemory() || !feq(e.Savings, 3.7*720*3) {
+			t.Errorf("expecting over-provisioned CPU saving $7992, got %+v", e)
+		}
+		if e := es[1]; e.OverProvisioned() || e.Savings != 0 {
+			t.Errorf("expecting fit workload not to be over-provisioned, got %+v", e)
+		}
+		if len(r.warnings) != 1 || !strings.Contains(r.warnings[0], "querying usage of ns/Deployment/broken on prod: boom") {
+			t.Errorf("expecting a warning for the failed query, got %v", r.warnings)
+		}
+	})
+
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary: {"ns/Deployment/wk on prod requests 4 CPU, uses 0.3 at p95 over the last 7 days: right-sizing could save $7992.00 monthly.\n"},
+		Markdown: {
+			"| `prod` | `ns`<br/>`Deployment`<br/>`wk` | :warning: requests 4 CPU, uses 0.3 | requests 8 GiB memory, uses 6 GiB | $7992.00 monthly |",
+			"| `prod` | `ns`<br/>`Deployment`<br/>`fit` | requests 1 CPU, uses 0.8 | requests 1 GiB memory, uses 0.9 GiB | N/A |",
+		},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		e := got.Workloads[0].Efficiency
+		if e == nil || !e.OverProvisioned || !feq(e.CPUUsage, 0.3) || !feq(e.Savings, 7992) {
+			t.Errorf("unexpected efficiency %+v", e)
+		}
+		if got.Workloads[2].Efficiency != nil {
+			t.Errorf("expecting no efficiency for the added workload, got %+v", got.Workloads[2].Efficiency)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/yaml"
+
+	"github.com/grafana/kost/pkg/costmodel/utils"
+)
+
+var ErrInvalidEgressPrice = errors.New("invalid egress price")
+
+// queryPodTransmitRate reports the average bytes per second transmitted by a pod of a workload over a window.
+// Format args: cluster, namespace, window, owned pods.
+const queryPodTransmitRate = `avg(sum by (pod) (rate(container_network_transmit_bytes_total{cluster="%s", namespace="%s"}[%s]) * on (namespace, pod) group_left() %s))`
+
+// egressWindow is the window the traffic of a workload is observed over.
+const egressWindow = usageWindow
+
+// EgressPrice is the price of the traffic leaving the pods of the clusters
+// matching a glob, blending cross-zone and internet egress.
+type EgressPrice struct {
+	// Cluster is a glob matching the names of the clusters, e.g. prod-*.
+	Cluster string `json:"cluster"`
+	// USDPerGiB is the price of a GiB transmitted.
+	USDPerGiB float64 `json:"usd_per_gib"`
+}
+
+// EgressPrices are the egress prices of the clusters, the first matching
+// one applying.
+type EgressPrices struct {
+	Prices []EgressPrice `json:"egress"`
+}
+
+// LoadEgressPrices reads the egress prices from a YAML file with a
+// top-level egress list.
+func LoadEgressPrices(path string) (*EgressPrices, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading egress prices: %w", err)
+	}
+
+	var e EgressPrices
+	if err := yaml.UnmarshalStrict(src, &e); err != nil {
+		return nil, fmt.Errorf("parsing egress prices: %w", err)
+	}
+	for _, p := range e.Prices {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &e, nil
+}
+
+func (p EgressPrice) validate() error {
+	if p.USDPerGiB < 0 {
+		return fmt.Errorf("%w: %s: usd_per_gib must be positive, got %v", ErrInvalidEgressPrice, p.Cluster, p.USDPerGiB)
+	}
+	if _, err := path.Match(p.Cluster, ""); err != nil {
+		return fmt.Errorf("%w: %s: cluster glob: %w", ErrInvalidEgressPrice, p.Cluster, err)
+	}
+	return nil
+}
+
+// price returns the price of a GiB transmitted by the pods of a cluster,
+// and whether one is configured.
+func (e *EgressPrices) price(cluster string) (float64, bool) {
+	for _, p := range e.Prices {
+		if ok, _ := path.Match(p.Cluster, cluster); ok {
+			return p.USDPerGiB, true
+		}
+	}
+	return 0, false
+}
+
+// EgressQuerier is the subset of *Client behavior Reporter.AddEgress needs.
+type EgressQuerier interface {
+	GetPodTransmitRate(ctx context.Context, cluster, namespace, kind, name string) (float64, error)
+}
+
+var (
+	_ EgressQuerier = (*Client)(nil)
+	_ EgressQuerier = (*Clients)(nil)
+)
+
+// GetPodTransmitRate returns the average bytes per second transmitted by a pod of
+// the given workload over the last 7 days. Pods are matched by their owner, see
+// ownedPods. Returns ErrNoResults if the workload has
+// no traffic, e.g. because it isn't deployed yet.
+func (c *Client) GetPodTransmitRate(ctx context.Context, cluster, namespace, kind, name string) (float64, error) {
+	query := fmt.Sprintf(queryPodTransmitRate, cluster, namespace, model.Duration(egressWindow), ownedPods(cluster, namespace, kind, name))
+	vec, err := c.queryVectorNow(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if len(vec) == 0 {
+		return 0, ErrNoResults
+	}
+	return float64(vec[0].Value), nil
+}
+
+// PodEgress is the traffic transmitted by a pod of a workload and its
+// price.
+type PodEgress struct {
+	// BytesPerSecond is the average traffic of a pod.
+	BytesPerSecond float64
+	// USDPerGiB is the egress price of the cluster.
+	USDPerGiB float64
+}
+
+// CostForPeriod returns the egress cost of the replicas over the period,
+// in US dollars.
+func (e PodEgress) CostForPeriod(p Period, replicas int) float64 {
+	gib := utils.BytesToGiB(int64(e.BytesPerSecond * 3600 * float64(p)))
+	return gib * e.USDPerGiB * float64(replicas)
+}
+
+// AddEgress queries the traffic of the workloads whose replicas change in the
+// reports added so far, to estimate the change in their egress cost from their
+// current traffic. Workloads of clusters without an egress price or without
+// traffic are left out; failed queries are added as warnings.
+func (r *Reporter) AddEgress(ctx context.Context, prices *EgressPrices, q EgressQuerier) {
+	if prices == nil {
+		return
+	}
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil || m.From.Kind == "" || m.To.Kind == "" || m.From.Replicas == m.To.Replicas {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		price, ok := prices.price(cluster)
+		if !ok {
+			continue
+		}
+		rate, err := q.GetPodTransmitRate(ctx, cluster, m.To.Namespace, m.To.Kind, m.To.Name)
+		if errors.Is(err, ErrNoResults) {
+			continue
+		} else if err != nil {
+			r.AddWarning(fmt.Sprintf("querying traffic of %s/%s/%s on %s: %v",
+				m.To.Namespace, m.To.Kind, m.To.Name, cluster, err))
+			continue
+		}
+		r.reports[i].egress = &PodEgress{BytesPerSecond: rate, USDPerGiB: price}
+	}
+}
+
+// egressCosts returns the egress cost of the report over the period
+// before and after the change, zero if its traffic wasn't added.
+func egressCosts(m report, p Period) (float64, float64) {
+	if m.egress == nil {
+		return 0, 0
+	}
+	return m.egress.CostForPeriod(p, m.From.Replicas), m.egress.CostForPeriod(p, m.To.Replicas)
+}
+
+// egressTotals returns the total egress cost over the main period before
+// and after the change, and whether the traffic of any workload was added.
+func (r *Reporter) egressTotals() (float64, float64, bool) {
+	var from, to float64
+	var ok bool
+	for _, m := range r.reports {
+		if m.egress == nil {
+			continue
+		}
+		f, t := egressCosts(m, r.mainPeriod())
+		from += f
+		to += t
+		ok = true
+	}
+	return from, to, ok
+}
+
+// egressTotalLines returns the line of the total egress cost over the main
+// period, if the traffic of any workload was added.
+func (r *Reporter) egressTotalLines() []string {
+	from, to, ok := r.egressTotals()
+	if !ok {
+		return nil
+	}
+	return []string{fmt.Sprintf("Network egress %s cost went from %s to %s (%s), an estimate based on current traffic.",
+		r.mainPeriod(), r.currency.Format(from), r.currency.Format(to), r.currency.Format(to-from))}
+}
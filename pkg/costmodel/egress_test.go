@@ -0,0 +1,137 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeEgressQuerier map[string]float64
+
+func (f fakeEgressQuerier) GetPodTransmitRate(_ context.Context, cluster, namespace, kind, name string) (float64, error) {
+	if name == "broken" {
+		return 0, errors.New("boom")
+	}
+	rate, ok := f[name]
+	if !ok {
+		return 0, ErrNoResults
+	}
+	return rate, nil
+}
+
+func TestLoadEgressPrices(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr error
+	}{
+		{name: "valid", src: "egress:\n  - cluster: prod-*\n    usd_per_gib: 0.01\n  - cluster: '*'\n    usd_per_gib: 0.05\n"},
+		{name: "negative price", src: "egress: [{cluster: prod, usd_per_gib: -1}]", wantErr: ErrInvalidEgressPrice},
+		{name: "bad glob", src: "egress: [{cluster: '[', usd_per_gib: 1}]", wantErr: ErrInvalidEgressPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "egress.yaml")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("writing egress prices: %v", err)
+			}
+
+			got, err := LoadEgressPrices(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p, ok := got.price("prod-eu"); !ok || p != 0.01 {
+				t.Errorf("expecting the first matching price 0.01, got %v, %v", p, ok)
+			}
+			if p, ok := got.price("dev"); !ok || p != 0.05 {
+				t.Errorf("expecting the catch-all price 0.05, got %v, %v", p, ok)
+			}
+		})
+	}
+}
+
+func TestClient_GetPodTransmitRate(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		q := r.Form.Get("query")
+		switch {
+		case strings.Contains(q, `container_network_transmit_bytes_total{cluster="prod", namespace="ns"}[1w]) * on (namespace, pod) group_left() max by (namespace, pod) (kube_pod_owner{cluster="prod", namespace="ns", owner_kind="StatefulSet", owner_name="wk"})`):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"1000"]}]}}`)
+		case strings.Contains(q, "container_network_transmit_bytes_total"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			t.Errorf("unexpected query %s", q)
+		}
+	})
+
+	if got, err := c.GetPodTransmitRate(context.Background(), "prod", "ns", "StatefulSet", "wk"); err != nil || got != 1000 {
+		t.Errorf("expecting 1000 bytes per second, got %v, %v", got, err)
+	}
+	if _, err := c.GetPodTransmitRate(context.Background(), "prod", "ns", "StatefulSet", "new"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without traffic, got %v", err)
+	}
+}
+
+func TestReporter_AddEgress(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod"}, CPU: Cost{NonSpot: 1}}
+	dev := &CostModel{Cluster: &Cluster{Name: "dev"}, CPU: Cost{NonSpot: 1}}
+	from := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 4
+	unscaled := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "unscaled"}
+	broken := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "broken"}
+	brokenTo := broken
+	brokenTo.Replicas = 1
+	prices := &EgressPrices{Prices: []EgressPrice{{Cluster: "prod", USDPerGiB: 0.01}}}
+	// 1 MB/s is 2414 GiB a month, $24.14 per replica.
+	q := fakeEgressQuerier{"wk": 1e6, "unscaled": 1e6}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.AddReport(prod, unscaled, unscaled)
+		r.AddReport(prod, broken, brokenTo)
+		r.AddReport(dev, from, to)
+		r.AddEgress(context.Background(), prices, q)
+		return r
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		if r.reports[0].egress == nil || r.reports[1].egress != nil || r.reports[3].egress != nil {
+			t.Errorf("expecting the egress of the scaled workload on prod only, got %+v", r.reports)
+		}
+		if len(r.warnings) != 1 || r.warnings[0] != "querying traffic of ns/Deployment/broken on prod: boom" {
+			t.Errorf("expecting a warning for the failed query, got %v", r.warnings)
+		}
+	})
+
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary:  {"Network egress monthly cost went from $48.28 to $96.56 ($48.28), an estimate based on current traffic.\n"},
+		Markdown: {":globe_with_meridians: Network egress monthly cost will go from $48.28 to $96.56 ($48.28), an estimate based on current traffic."},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		if e := got.Workloads[0].Egress; e == nil || e.BytesPerSecond != 1e6 || !feq(e.From, 48.28) || !feq(e.To, 96.56) {
+			t.Errorf("unexpected egress %+v", e)
+		}
+		// 2 replicas more of wk and on dev, 1 less of broken, at $1 per CPU hour.
+		if !feq(got.Totals["monthly-delta"], 3*720) {
+			t.Errorf("expecting the egress not to be part of the totals, got %v", got.Totals)
+		}
+	})
+}
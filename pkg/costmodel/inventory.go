@@ -0,0 +1,172 @@
+package costmodel
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// inventoryGroups are the columns the inventory is subtotaled by, from the
+// outermost group.
+var inventoryGroups = []Column{ColumnCluster, ColumnNamespace, ColumnKind}
+
+// WithInventory reports the current cost of the workloads, added with
+// AddInventory, rather than a change: costs aren't compared, and the
+// table report is subtotaled by cluster, namespace and kind.
+func WithInventory() Option {
+	return func(r *Reporter) {
+		r.inventory = true
+	}
+}
+
+// AddInventory adds the current cost of a workload, with the replicas of
+// HPA-managed workloads resolved like AddReportWithResolvedReplicas. The
+// workload is reported as unchanged, so that the enrichers comparing costs
+// report its current cost on both sides.
+func (r *Reporter) AddInventory(ctx context.Context, resolver HPAResolver, cm *CostModel, req Requirements) {
+	r.AddReportWithResolvedReplicas(ctx, resolver, cm, req, req)
+}
+
+// inventoryKey returns the values of the first n inventory groups of a
+// report, see inventoryGroups.
+func inventoryKey(m report, n int) string {
+	keys := make([]string, 0, n)
+	for _, g := range inventoryGroups[:n] {
+		keys = append(keys, cell{column: g}.text(m))
+	}
+	return strings.Join(keys, "/")
+}
+
+// inventoryReports returns the reports with a cost model sorted by
+// cluster, namespace, kind and name, for the groups to be contiguous.
+func (r *Reporter) inventoryReports() []report {
+	var reports []report
+	for _, m := range r.reports {
+		if m.CostModel != nil {
+			reports = append(reports, m)
+		}
+	}
+	slices.SortStableFunc(reports, func(a, b report) int {
+		return strings.Compare(inventoryKey(a, len(inventoryGroups))+"/"+workload(a.From, a.To).Name, inventoryKey(b, len(inventoryGroups))+"/"+workload(b.From, b.To).Name)
+	})
+	return reports
+}
+
+// subtotals accumulates the costs of the table cells for each inventory
+// group, and tells where a group ends.
+type subtotals struct {
+	cells   []cell
+	reports []report
+	// sizes counts the reports of each group, by level and key.
+	sizes []map[string]int
+	// from and to are the costs of the current group of each level before
+	// and after the change, by cell.
+	from, to [][]float64
+}
+
+func newSubtotals(cells []cell, reports []report) *subtotals {
+	s := &subtotals{cells: cells, reports: reports}
+	for level := range inventoryGroups {
+		sizes := make(map[string]int)
+		for _, m := range reports {
+			sizes[inventoryKey(m, level+1)]++
+		}
+		s.sizes = append(s.sizes, sizes)
+		s.from = append(s.from, make([]float64, len(cells)))
+		s.to = append(s.to, make([]float64, len(cells)))
+	}
+	return s
+}
+
+// add adds the costs of a report, by cell, to the subtotals of its groups.
+func (s *subtotals) add(from, to []float64) {
+	for level := range inventoryGroups {
+		for c := range s.cells {
+			s.from[level][c] += from[c]
+			s.to[level][c] += to[c]
+		}
+	}
+}
+
+// rows returns the subtotal rows of the groups ending with the report at
+// index i, from the innermost one, and resets their costs. A group is worth
+// a row if it holds several workloads and differs from its enclosing group,
+// and its column is in the table along with a free column to label it.
+func (s *subtotals) rows(r *Reporter, i int) [][]string {
+	var rows [][]string
+	for level := len(inventoryGroups) - 1; level >= 0; level-- {
+		key := inventoryKey(s.reports[i], level+1)
+		if i+1 < len(s.reports) && inventoryKey(s.reports[i+1], level+1) == key {
+			continue
+		}
+		parent := len(s.reports)
+		if level > 0 {
+			parent = s.sizes[level-1][inventoryKey(s.reports[i], level)]
+		}
+		if size := s.sizes[level][key]; size > 1 && size != parent && s.label(level) >= 0 {
+			rows = append(rows, s.row(r, i, level))
+		}
+		clear(s.from[level])
+		clear(s.to[level])
+	}
+	return rows
+}
+
+// label returns the index of the cell labeling the subtotal rows of a
+// level, the first one that isn't a cost nor a group at or above the
+// level, or -1 if the level's column isn't in the table or none is free.
+func (s *subtotals) label(level int) int {
+	if !slices.ContainsFunc(s.cells, func(c cell) bool { return c.column == inventoryGroups[level] }) {
+		return -1
+	}
+	return slices.IndexFunc(s.cells, func(c cell) bool {
+		return !c.isCost() && !c.isPrice() && !slices.Contains(inventoryGroups[:level+1], c.column)
+	})
+}
+
+// row returns the subtotal row of a level for the group of the report at
+// index i, with the values of the groups at or above the level.
+func (s *subtotals) row(r *Reporter, i, level int) []string {
+	label := s.label(level)
+	row := make([]string, 0, len(s.cells))
+	for c, cl := range s.cells {
+		switch {
+		case c == label:
+			row = append(row, "Subtotal:")
+		case slices.Contains(inventoryGroups[:level+1], cl.column):
+			row = append(row, cl.text(s.reports[i]))
+		case cl.isCost():
+			row = append(row, r.tableCost(cl, s.from[level][c], s.to[level][c]))
+		default:
+			row = append(row, "")
+		}
+	}
+	return row
+}
+
+// inventoryTotals returns the total cost over the main period, and at list
+// prices.
+func (r *Reporter) inventoryTotals() (float64, float64) {
+	var total, list float64
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+		total += m.CostModel.TotalCostForPeriod(r.mainPeriod(), m.To)
+		list += m.CostModel.ListPrices().TotalCostForPeriod(r.mainPeriod(), m.To)
+	}
+	return total, list
+}
+
+// inventorySummary returns the lines of the summary report of an
+// inventory, in place of the change in cost.
+func (r *Reporter) inventorySummary() []string {
+	p := r.mainPeriod()
+	total, list := r.inventoryTotals()
+	rows := []string{fmt.Sprintf("Total %s Cost of the inventory is %s.", p.Title(), r.currency.Format(total))}
+	if r.listPrices {
+		rows = append(rows, fmt.Sprintf("Total %s Cost of the inventory at list prices is %s.", p.Title(), r.currency.Format(list)))
+	}
+	return rows
+}
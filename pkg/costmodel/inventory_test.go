@@ -0,0 +1,83 @@
+package costmodel
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReporter_Inventory(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod"}, CPU: Cost{NonSpot: 1}}
+	dev := &CostModel{Cluster: &Cluster{Name: "dev"}, CPU: Cost{NonSpot: 1}}
+	wk := func(namespace, kind, name string, replicas int) Requirements {
+		return Requirements{CPUPerPod: 1000, Replicas: replicas, Kind: kind, Namespace: namespace, Name: name}
+	}
+
+	newReporter := func(s *strings.Builder, reportType ReportType) *Reporter {
+		fr := &fakeResolver{}
+		r := New(s, string(reportType), WithInventory(), WithPeriods(Hourly))
+		r.AddInventory(context.Background(), fr, prod, wk("b", "Deployment", "w", 1))
+		r.AddInventory(context.Background(), fr, prod, wk("a", "StatefulSet", "z", 1))
+		r.AddInventory(context.Background(), fr, prod, wk("a", "Deployment", "y", 2))
+		r.AddInventory(context.Background(), fr, prod, wk("a", "Deployment", "x", 1))
+		r.AddInventory(context.Background(), fr, dev, wk("a", "Deployment", "v", 1))
+		return r
+	}
+
+	t.Run("table", func(t *testing.T) {
+		var s strings.Builder
+		if err := newReporter(&s, Table).Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+
+		// Groups of a single workload, or the same as their enclosing
+		// group, aren't subtotaled.
+		want := [][]string{
+			{"Cluster", "Namespace", "Kind", "Name", "Replicas", "Total", "Hourly", "Cost"},
+			{"dev", "a", "Deployment", "v", "1", "$1.00"},
+			{"prod", "a", "Deployment", "x", "1", "$1.00"},
+			{"prod", "a", "Deployment", "y", "2", "$2.00"},
+			{"prod", "a", "Deployment", "Subtotal:", "$3.00"},
+			{"prod", "a", "StatefulSet", "z", "1", "$1.00"},
+			{"prod", "a", "Subtotal:", "$4.00"},
+			{"prod", "b", "Deployment", "w", "1", "$1.00"},
+			{"prod", "Subtotal:", "$5.00"},
+			{"Total", "Cost:", "$6.00"},
+		}
+		lines := strings.Split(strings.TrimSpace(s.String()), "\n")
+		if len(lines) != len(want) {
+			t.Fatalf("expecting %d lines, got:\n%s", len(want), s.String())
+		}
+		for i, line := range lines {
+			if got := strings.Fields(line); !reflect.DeepEqual(want[i], got) {
+				t.Errorf("expecting line %d to be %q, got %q", i, want[i], got)
+			}
+		}
+	})
+
+	tests := []struct {
+		reportType ReportType
+		want       []string
+		notWant    string
+	}{
+		{Summary, []string{"Total Hourly Cost of the inventory is $6.00.\n"}, "PR changed"},
+		{Markdown, []string{"## :dollar: Cost Inventory Report\nHourly cost of the inventory is $6.00.", "| `dev` | $1.00 |\n| `prod` | $5.00 |"}, "affected resources"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reportType), func(t *testing.T) {
+			var s strings.Builder
+			if err := newReporter(&s, tt.reportType).Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(s.String(), want) {
+					t.Errorf("expecting report to contain %q, got:\n%s", want, s.String())
+				}
+			}
+			if strings.Contains(s.String(), tt.notWant) {
+				t.Errorf("expecting report not to contain %q, got:\n%s", tt.notWant, s.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package costmodel
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// jsonReport is the document written by the json report type. Costs are
+// in the report currency.
+type jsonReport struct {
+	Currency string `json:"currency"`
+	// Period is the period the cost of each resource is reported for.
+	Period    string         `json:"period"`
+	Workloads []jsonWorkload `json:"workloads"`
+	// Totals holds the total costs keyed by period, see Period.Keys.
+	Totals   map[string]float64 `json:"totals"`
+	Errors   []string           `json:"errors,omitempty"`
+	Warnings []string           `json:"warnings,omitempty"`
+	// NodeChanges holds the predicted change in the node count of each
+	// node pool, when node pools were added.
+	NodeChanges []jsonNodeChange `json:"node_changes,omitempty"`
+	// Carbon is the total carbon footprint over the report period, when
+	// carbon factors were added.
+	Carbon *jsonCarbon `json:"carbon,omitempty"`
+	// Egress is the total network egress cost over the report period,
+	// estimated from current traffic, when added. It isn't part of Totals.
+	Egress *jsonEgress `json:"egress,omitempty"`
+	// Observability is the total observability cost over the report
+	// period, when signals were added. It isn't part of Totals.
+	Observability *jsonObservability `json:"observability,omitempty"`
+	// Backups is the total cost over the report period of the snapshots
+	// of the persistent volumes, when backed up. It isn't part of Totals.
+	Backups *jsonBackups `json:"backups,omitempty"`
+	// Assumptions are the inputs of the costs, when reported.
+	Assumptions *jsonAssumptions `json:"assumptions,omitempty"`
+	// Range is the range of the total costs over the report period, when
+	// ranges were added.
+	Range *jsonCostRange `json:"range,omitempty"`
+}
+
+// jsonCostRange holds the range of the cost before and after the change,
+// and of its change, given the spread of prices and replicas.
+type jsonCostRange struct {
+	From  jsonRange `json:"from"`
+	To    jsonRange `json:"to"`
+	Delta jsonRange `json:"delta"`
+}
+
+type jsonRange struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// newJSONCostRange converts the ranges to the report currency.
+func (r *Reporter) newJSONCostRange(from, to, delta Range) *jsonCostRange {
+	convert := func(v Range) jsonRange { return jsonRange{Low: r.jsonCost(v.Low), High: r.jsonCost(v.High)} }
+	return &jsonCostRange{From: convert(from), To: convert(to), Delta: convert(delta)}
+}
+
+// jsonAssumptions holds the hours of the report period and the inputs of
+// the costs of each cluster, see Assumptions. Prices are hourly, in the
+// report currency.
+type jsonAssumptions struct {
+	Hours    float64                  `json:"hours"`
+	Clusters []jsonClusterAssumptions `json:"clusters"`
+}
+
+type jsonClusterAssumptions struct {
+	Cluster           string         `json:"cluster"`
+	CPUPerCoreHour    float64        `json:"cpu_per_core_hour"`
+	MemoryPerGiBHour  float64        `json:"memory_per_gib_hour"`
+	StoragePerGiBHour float64        `json:"storage_per_gib_hour"`
+	Tier              string         `json:"tier"`
+	Nodes             int            `json:"nodes"`
+	ReplicaSources    map[string]int `json:"replica_sources"`
+}
+
+// jsonBackups holds a snapshot cost, and the policies of a workload
+// before and after the change for the backups of a workload.
+type jsonBackups struct {
+	FromPolicy string  `json:"from_policy,omitempty"`
+	ToPolicy   string  `json:"to_policy,omitempty"`
+	From       float64 `json:"from"`
+	To         float64 `json:"to"`
+	Delta      float64 `json:"delta"`
+}
+
+// jsonCarbon holds a carbon footprint before and after the change, in kg
+// of CO2e.
+type jsonCarbon struct {
+	From  float64 `json:"from_kg"`
+	To    float64 `json:"to_kg"`
+	Delta float64 `json:"delta_kg"`
+}
+
+// newJSONCarbon rounds a carbon footprint to grams.
+func newJSONCarbon(from, to float64) *jsonCarbon {
+	round := func(v float64) float64 { return math.Round(v*1000) / 1000 }
+	return &jsonCarbon{From: round(from), To: round(to), Delta: round(to - from)}
+}
+
+// jsonNodeChange is the predicted change in the node count of a node
+// pool, see NodeChange.
+type jsonNodeChange struct {
+	Cluster      string `json:"cluster"`
+	Pool         string `json:"pool,omitempty"`
+	InstanceType string `json:"instance_type,omitempty"`
+	Nodes        int    `json:"nodes"`
+}
+
+// jsonWorkload holds the costs of a workload.
+type jsonWorkload struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Team      string `json:"team,omitempty"`
+	Replicas  int    `json:"replicas"`
+	// ReplicaSource is where the replicas come from, when assumptions
+	// are reported, see ReplicaSource.
+	ReplicaSource string `json:"replica_source,omitempty"`
+	// CPU, Memory and Storage are the cost of each resource over the
+	// report period.
+	CPU     float64 `json:"cpu"`
+	Memory  float64 `json:"memory"`
+	Storage float64 `json:"storage"`
+	// Costs holds the costs keyed by period, see Period.Keys, and over
+	// the report period at list prices when enabled.
+	Costs     map[string]float64 `json:"costs"`
+	Discounts []string           `json:"discounts,omitempty"`
+	// Scenarios holds the cost over the report period in each scenario,
+	// when reported, keyed by scenario.
+	Scenarios map[Scenario]jsonScenario `json:"scenarios,omitempty"`
+	// Containers breaks the workload down by container.
+	Containers []jsonContainer `json:"containers,omitempty"`
+	// Efficiency compares the requests of a modified workload with its
+	// usage, when added.
+	Efficiency *jsonEfficiency `json:"efficiency,omitempty"`
+	// BinPacked holds the cost over the report period bin-packed onto the
+	// nodes of the cluster, when node shapes were added.
+	BinPacked *jsonBinPacked `json:"bin_packed,omitempty"`
+	// Carbon is the carbon footprint over the report period, when the
+	// carbon factors of the cluster were added.
+	Carbon *jsonCarbon `json:"carbon,omitempty"`
+	// Egress is the network egress cost over the report period, estimated
+	// from the current traffic of a pod, when added.
+	Egress *jsonEgress `json:"egress,omitempty"`
+	// Observability is the cost over the report period of the signals of
+	// the workload, when added. It isn't part of Costs.
+	Observability *jsonObservability `json:"observability,omitempty"`
+	// Backups is the cost over the report period of the snapshots of the
+	// persistent volumes, when backed up. It isn't part of Costs.
+	Backups *jsonBackups `json:"backups,omitempty"`
+	// Range is the range of the cost over the report period, when ranges
+	// were added. Costs holds the point estimates.
+	Range *jsonCostRange `json:"range,omitempty"`
+}
+
+// jsonObservability holds an observability cost, and the amount of each
+// signal of a pod for the signals of a workload, see PodObservability.
+type jsonObservability struct {
+	Signals map[string]float64 `json:"signals,omitempty"`
+	From    float64            `json:"from"`
+	To      float64            `json:"to"`
+	Delta   float64            `json:"delta"`
+}
+
+// jsonEgress holds a network egress cost, and the traffic of a pod for
+// the egress of a workload, see PodEgress.
+type jsonEgress struct {
+	BytesPerSecond float64 `json:"bytes_per_second,omitempty"`
+	From           float64 `json:"from"`
+	To             float64 `json:"to"`
+	Delta          float64 `json:"delta"`
+}
+
+// jsonContainer holds the requests of a container before and after the
+// change, zero on the side it doesn't exist, and their costs across the
+// replicas of the workload. CPU is in millicores and memory in bytes.
+type jsonContainer struct {
+	Name       string `json:"name"`
+	CPUFrom    int64  `json:"cpu_from"`
+	CPUTo      int64  `json:"cpu_to"`
+	MemoryFrom int64  `json:"memory_from"`
+	MemoryTo   int64  `json:"memory_to"`
+	// Costs holds the costs keyed by period, see Period.Keys.
+	Costs map[string]float64 `json:"costs"`
+}
+
+// jsonScenario holds the cost of a workload in a scenario, see
+// ScenarioCost. Unbounded costs are null.
+type jsonScenario struct {
+	From      *float64 `json:"from"`
+	To        *float64 `json:"to"`
+	Delta     *float64 `json:"delta"`
+	Unbounded bool     `json:"unbounded,omitempty"`
+}
+
+// jsonEfficiency holds the requests and p95 usage of a pod, see
+// Efficiency. CPU is in cores and memory in bytes.
+type jsonEfficiency struct {
+	CPURequest      float64 `json:"cpu_request"`
+	CPUUsage        float64 `json:"cpu_usage"`
+	MemoryRequest   float64 `json:"memory_request"`
+	MemoryUsage     float64 `json:"memory_usage"`
+	OverProvisioned bool    `json:"over_provisioned"`
+	// Savings is the cost of right-sizing over the report period.
+	Savings float64 `json:"savings"`
+}
+
+// jsonBinPacked holds the cost of a workload bin-packed onto nodes, see
+// BinPacked, and the node-equivalents its pods fill.
+type jsonBinPacked struct {
+	From      float64 `json:"from"`
+	To        float64 `json:"to"`
+	Delta     float64 `json:"delta"`
+	NodesFrom float64 `json:"nodes_from"`
+	NodesTo   float64 `json:"nodes_to"`
+	NodeShape string  `json:"node_shape"`
+}
+
+// writeJSON writes the reports as a single JSON document.
+func (r *Reporter) writeJSON() error {
+	doc := jsonReport{
+		Currency:  r.currency.Code,
+		Period:    r.mainPeriod().String(),
+		Workloads: []jsonWorkload{},
+		Totals:    make(map[string]float64),
+		Errors:    append([]string(nil), r.errors...),
+		Warnings:  append([]string(nil), r.warnings...),
+	}
+	doc.Warnings = append(doc.Warnings, r.limitWarnings()...)
+	doc.Warnings = append(doc.Warnings, r.binPackingWarnings()...)
+	for _, d := range r.allDiagnostics() {
+		if d.Missing() {
+			doc.Errors = append(doc.Errors, d.String())
+		} else {
+			doc.Warnings = append(doc.Warnings, d.String())
+		}
+	}
+
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+
+		id := workload(m.From, m.To)
+		rc := resourcesCosts(m.CostModel, m.To, r.mainPeriod())
+
+		w := jsonWorkload{
+			Cluster:   m.CostModel.Cluster.Name,
+			Namespace: id.Namespace,
+			Kind:      id.Kind,
+			Name:      id.Name,
+			Team:      m.team(),
+			Replicas:  m.To.Replicas,
+			CPU:       r.jsonCost(rc.CPU),
+			Memory:    r.jsonCost(rc.Memory),
+			Storage:   r.jsonCost(rc.Storage),
+			Costs:     make(map[string]float64),
+			Discounts: m.CostModel.Discounts,
+		}
+		if r.assumptions {
+			w.ReplicaSource = m.replicaSource.String()
+		}
+		for _, p := range r.periods {
+			keys := p.Keys()
+			fromCost, toCost := calculateTotalCostForPeriod(p, m.From, m.To, m.CostModel)
+			w.Costs[keys.From] = r.jsonCost(fromCost)
+			w.Costs[keys.To] = r.jsonCost(toCost)
+			w.Costs[keys.Delta] = r.jsonCost(toCost - fromCost)
+			doc.Totals[keys.From] += fromCost
+			doc.Totals[keys.To] += toCost
+			doc.Totals[keys.Delta] += toCost - fromCost
+		}
+		if r.scenarios {
+			w.Scenarios = make(map[Scenario]jsonScenario)
+			for _, c := range scenarioCosts(m, r.mainPeriod()) {
+				w.Scenarios[c.Scenario] = jsonScenario{
+					From:      r.jsonBound(c.Old, c.OldUnbounded),
+					To:        r.jsonBound(c.New, c.NewUnbounded),
+					Delta:     r.jsonBound(c.Delta(), c.Unbounded()),
+					Unbounded: c.Unbounded(),
+				}
+			}
+		}
+		for _, p := range PairContainers(m.From, m.To) {
+			c := jsonContainer{
+				Name:       p.Name,
+				CPUFrom:    p.From.CPU,
+				CPUTo:      p.To.CPU,
+				MemoryFrom: p.From.Memory,
+				MemoryTo:   p.To.Memory,
+				Costs:      make(map[string]float64),
+			}
+			for _, period := range r.periods {
+				keys := period.Keys()
+				fromCost := containerCost(m.CostModel, p.From, m.From.Replicas, period).Total()
+				toCost := containerCost(m.CostModel, p.To, m.To.Replicas, period).Total()
+				c.Costs[keys.From] = r.jsonCost(fromCost)
+				c.Costs[keys.To] = r.jsonCost(toCost)
+				c.Costs[keys.Delta] = r.jsonCost(toCost - fromCost)
+			}
+			w.Containers = append(w.Containers, c)
+		}
+		if r.listPrices {
+			keys := r.mainPeriod().Keys()
+			fromCost, toCost := calculateTotalCostForPeriod(r.mainPeriod(), m.From, m.To, m.CostModel.ListPrices())
+			w.Costs["list-"+keys.From] = r.jsonCost(fromCost)
+			w.Costs["list-"+keys.To] = r.jsonCost(toCost)
+			w.Costs["list-"+keys.Delta] = r.jsonCost(toCost - fromCost)
+		}
+		if e, ok := r.efficiency(m); ok {
+			w.Efficiency = &jsonEfficiency{
+				CPURequest:      e.CPURequest,
+				CPUUsage:        e.Usage.CPU,
+				MemoryRequest:   e.MemoryRequest,
+				MemoryUsage:     e.Usage.Memory,
+				OverProvisioned: e.OverProvisioned(),
+				Savings:         r.jsonCost(e.Savings),
+			}
+		}
+		if from, to, ok := binPackedCosts(m, r.mainPeriod()); ok {
+			w.BinPacked = &jsonBinPacked{
+				From:      r.jsonCost(from.Cost),
+				To:        r.jsonCost(to.Cost),
+				Delta:     r.jsonCost(to.Cost - from.Cost),
+				NodesFrom: math.Round(from.Nodes*100) / 100,
+				NodesTo:   math.Round(to.Nodes*100) / 100,
+				NodeShape: m.nodeShapes.shape().String(),
+			}
+		}
+		if m.carbon != nil {
+			w.Carbon = newJSONCarbon(carbonEmissions(m, r.mainPeriod()))
+		}
+		if m.egress != nil {
+			fromCost, toCost := egressCosts(m, r.mainPeriod())
+			w.Egress = &jsonEgress{
+				BytesPerSecond: math.Round(m.egress.BytesPerSecond),
+				From:           r.jsonCost(fromCost),
+				To:             r.jsonCost(toCost),
+				Delta:          r.jsonCost(toCost - fromCost),
+			}
+		}
+		if m.observability != nil {
+			fromCost, toCost := observabilityCosts(m, r.mainPeriod())
+			w.Observability = &jsonObservability{
+				Signals: m.observability.Signals,
+				From:    r.jsonCost(fromCost),
+				To:      r.jsonCost(toCost),
+				Delta:   r.jsonCost(toCost - fromCost),
+			}
+		}
+		if m.hasRange() {
+			w.Range = r.newJSONCostRange(costRanges(m, r.mainPeriod()))
+		}
+		if m.backups != nil {
+			fromCost, toCost := backupCosts(m, r.mainPeriod())
+			w.Backups = &jsonBackups{
+				From:  r.jsonCost(fromCost),
+				To:    r.jsonCost(toCost),
+				Delta: r.jsonCost(toCost - fromCost),
+			}
+			if m.backups.From != nil {
+				w.Backups.FromPolicy = m.backups.From.Name
+			}
+			if m.backups.To != nil {
+				w.Backups.ToPolicy = m.backups.To.Name
+			}
+		}
+		doc.Workloads = append(doc.Workloads, w)
+	}
+	if r.hasCarbon() {
+		doc.Carbon = newJSONCarbon(r.carbonTotals())
+	}
+	if from, to, ok := r.egressTotals(); ok {
+		doc.Egress = &jsonEgress{From: r.jsonCost(from), To: r.jsonCost(to), Delta: r.jsonCost(to - from)}
+	}
+	if from, to, ok := r.observabilityTotals(); ok {
+		doc.Observability = &jsonObservability{From: r.jsonCost(from), To: r.jsonCost(to), Delta: r.jsonCost(to - from)}
+	}
+	if from, to, ok := r.backupTotals(); ok {
+		doc.Backups = &jsonBackups{From: r.jsonCost(from), To: r.jsonCost(to), Delta: r.jsonCost(to - from)}
+	}
+	if from, to, delta, ok := r.rangeTotals(); ok {
+		doc.Range = r.newJSONCostRange(from, to, delta)
+	}
+	if all := r.clusterAssumptions(); len(all) > 0 {
+		doc.Assumptions = &jsonAssumptions{Hours: float64(r.mainPeriod())}
+		for _, a := range all {
+			doc.Assumptions.Clusters = append(doc.Assumptions.Clusters, jsonClusterAssumptions{
+				Cluster:           a.Cluster,
+				CPUPerCoreHour:    r.currency.Convert(a.CPU),
+				MemoryPerGiBHour:  r.currency.Convert(a.Memory),
+				StoragePerGiBHour: r.currency.Convert(a.Storage),
+				Tier:              a.Tier,
+				Nodes:             a.Nodes,
+				ReplicaSources:    a.ReplicaSources,
+			})
+		}
+	}
+	for _, c := range r.nodeChanges() {
+		doc.NodeChanges = append(doc.NodeChanges, jsonNodeChange{
+			Cluster:      c.Cluster,
+			Pool:         c.Pool,
+			InstanceType: c.InstanceType,
+			Nodes:        c.Nodes,
+		})
+	}
+	for k, v := range doc.Totals {
+		doc.Totals[k] = r.jsonCost(v)
+	}
+
+	enc := json.NewEncoder(r.Writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// jsonCost converts a cost to the report currency, rounded to cents.
+func (r *Reporter) jsonCost(v float64) float64 {
+	return math.Round(r.currency.Convert(v)*100) / 100
+}
+
+// jsonBound converts a cost in a scenario like jsonCost, or returns nil if
+// it is unbounded.
+func (r *Reporter) jsonBound(v float64, unbounded bool) *float64 {
+	if unbounded {
+		return nil
+	}
+	c := r.jsonCost(v)
+	return &c
+}
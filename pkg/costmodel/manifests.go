@@ -0,0 +1,110 @@
+package costmodel
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ParseManifests parses a stream of YAML or JSON documents, as produced by
+// tools like kustomize or helm, and returns the requirements of every
+// workload found in it. Documents of a kind unknown to ParseManifest, such as
+// Services or ConfigMaps, are skipped.
+func ParseManifests(src []byte, costModel *CostModel) ([]Requirements, error) {
+	var reqs []Requirements
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(src)))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading manifest document: %w", err)
+		}
+
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		req, err := ParseManifest(doc, costModel)
+		if errors.Is(err, ErrUnknownKind) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		reqs = append(reqs, req)
+	}
+
+	return reqs, nil
+}
+
+// ErrDuplicateWorkload is returned when a set of manifests has several
+// workloads of the same kind, namespace and name.
+var ErrDuplicateWorkload = errors.New("duplicate workload")
+
+// Key returns an identifier for the workload the requirements were
+// parsed from, in the form kind/namespace/name.
+func (r Requirements) Key() string {
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// RequirementsPair holds the previous and desired requirements for the
+// same workload. Either side is empty when the workload was added or
+// removed.
+type RequirementsPair struct {
+	From, To Requirements
+}
+
+// PairRequirements matches workloads from two sets of requirements by
+// their Key. The returned pairs are sorted by Key so reports are stable
+// between runs. Returns ErrDuplicateWorkload if a Key appears twice in
+// either set, since one would hide the other.
+func PairRequirements(from, to []Requirements) ([]RequirementsPair, error) {
+	pairs := make(map[string]RequirementsPair)
+
+	for _, r := range from {
+		p := pairs[r.Key()]
+		if p.From.Kind != "" {
+			return nil, fmt.Errorf("%w: %s in from manifests", ErrDuplicateWorkload, r.Key())
+		}
+		p.From = r
+		pairs[r.Key()] = p
+	}
+
+	for _, r := range to {
+		p := pairs[r.Key()]
+		if p.To.Kind != "" {
+			return nil, fmt.Errorf("%w: %s in to manifests", ErrDuplicateWorkload, r.Key())
+		}
+		p.To = r
+		pairs[r.Key()] = p
+	}
+
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]RequirementsPair, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, pairs[k])
+	}
+
+	return out, nil
+}
+
+// workload returns the side of a change the workload exists on, the
+// requirements after the change unless it removes the workload.
+func workload(from, to Requirements) Requirements {
+	if to.Kind == "" {
+		return from
+	}
+	return to
+}
@@ -0,0 +1,88 @@
+package costmodel
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseManifests(t *testing.T) {
+	var docs []string
+	for _, f := range []string{"Deployment.json", "StatefulSet-without-replicas.yaml", "DaemonSet.json"} {
+		src, err := os.ReadFile("testdata/resource/" + f)
+		if err != nil {
+			t.Fatalf("unexpected error reading manifest file: %v", err)
+		}
+		docs = append(docs, string(src))
+	}
+	// Kinds unknown to the parser must be skipped.
+	docs = append(docs, "apiVersion: v1\nkind: Service\nmetadata:\n  name: svc\n", "")
+
+	got, err := ParseManifests([]byte(strings.Join(docs, "\n---\n")), &CostModel{Cluster: &Cluster{NodeCount: 3}})
+	if err != nil {
+		t.Fatalf("unexpected error parsing manifests: %v", err)
+	}
+
+	exp := []string{
+		"Deployment/opencost/prom-label-proxy",
+		"StatefulSet/alertmanager/alertmanager",
+		"DaemonSet/conntrack-exporter/conntrack-exporter",
+	}
+	if e, g := len(exp), len(got); e != g {
+		t.Fatalf("expecting %d requirements, got %d", e, g)
+	}
+	for i, e := range exp {
+		if g := got[i].Key(); e != g {
+			t.Errorf("expecting %s at index %d, got %s", e, i, g)
+		}
+	}
+
+	if e, g := 3, got[2].Replicas; e != g {
+		t.Errorf("expecting DaemonSet to have %d replicas, got %d", e, g)
+	}
+}
+
+func TestPairRequirements(t *testing.T) {
+	a := Requirements{Kind: "Deployment", Namespace: "ns", Name: "a", CPUPerPod: 1}
+	b := Requirements{Kind: "Deployment", Namespace: "ns", Name: "b", CPUPerPod: 1}
+	b2 := Requirements{Kind: "Deployment", Namespace: "ns", Name: "b", CPUPerPod: 2}
+	c := Requirements{Kind: "StatefulSet", Namespace: "ns", Name: "c", CPUPerPod: 1}
+
+	got, err := PairRequirements([]Requirements{b, a}, []Requirements{c, b2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exp := []RequirementsPair{
+		{From: a},
+		{From: b, To: b2},
+		{To: c},
+	}
+
+	if e, g := len(exp), len(got); e != g {
+		t.Fatalf("expecting %d pairs, got %d", e, g)
+	}
+	for i, e := range exp {
+		if g := got[i]; !reflect.DeepEqual(e, g) {
+			t.Errorf("expecting pair %#v at index %d, got %#v", e, i, g)
+		}
+	}
+}
+
+func TestPairRequirements_Duplicates(t *testing.T) {
+	a := Requirements{Kind: "Deployment", Namespace: "ns", Name: "a", CPUPerPod: 1}
+	a2 := Requirements{Kind: "Deployment", Namespace: "ns", Name: "a", CPUPerPod: 2}
+
+	for name, tt := range map[string]struct{ from, to []Requirements }{
+		"from": {from: []Requirements{a, a2}, to: []Requirements{a}},
+		"to":   {from: []Requirements{a}, to: []Requirements{a2, a}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := PairRequirements(tt.from, tt.to); !errors.Is(err, ErrDuplicateWorkload) {
+				t.Errorf("expecting ErrDuplicateWorkload, got %v", err)
+			}
+		})
+	}
+}
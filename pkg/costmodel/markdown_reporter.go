@@ -3,58 +3,147 @@ package costmodel
 import (
 	_ "embed"
 	"fmt"
+	"math"
+	"os"
 	"sort"
+	"strings"
 	"text/template"
+	"time"
 )
 
-// resourcesCost contains the detailed cost for cluster resources.
-type resourcesCost struct {
+// ResourcesCost is the cost of each resource of a workload over the
+// report period, in US dollars.
+type ResourcesCost struct {
 	CPU       float64
 	Memory    float64
 	Storage   float64
 	Kind      string
 	Namespace string
 	Name      string
+	// Replicas is the number of replicas the cost is for.
+	Replicas int
 }
 
-func (c resourcesCost) Total() float64 {
+// Total returns the cost of all resources.
+func (c ResourcesCost) Total() float64 {
 	return c.CPU + c.Memory + c.Storage
 }
 
-func resourcesCosts(m *CostModel, req Requirements) resourcesCost {
-	return resourcesCost{
-		CPU:       m.CPU.NonSpotCPUForPeriod(Monthly, req.TotalCPU()),
-		Memory:    m.RAM.NonSpotMemoryForPeriod(Monthly, req.TotalMemory()),
-		Storage:   m.PersistentVolume.DollarsForPeriod(Monthly, req.TotalPersistentVolume()),
+// ContainerCost is the cost of the CPU and memory requested by a container
+// across the replicas of a workload over the report period, in US dollars.
+type ContainerCost struct {
+	Name   string
+	CPU    float64
+	Memory float64
+}
+
+// Total returns the cost of the CPU and memory.
+func (c ContainerCost) Total() float64 {
+	return c.CPU + c.Memory
+}
+
+// ContainerReport holds the cost of a container before and after the
+// change, zero on the side it doesn't exist.
+type ContainerReport struct {
+	Name     string
+	Old, New ContainerCost
+}
+
+// Delta returns the change in total cost.
+func (r ContainerReport) Delta() float64 {
+	return r.New.Total() - r.Old.Total()
+}
+
+func resourcesCosts(m *CostModel, req Requirements, p Period) ResourcesCost {
+	return ResourcesCost{
+		CPU:       m.CPU.NonSpotCPUForPeriod(p, req.TotalCPU()),
+		Memory:    m.RAM.NonSpotMemoryForPeriod(p, req.TotalMemory()),
+		Storage:   m.PersistentVolume.DollarsForPeriod(p, req.TotalPersistentVolume()),
 		Kind:      req.Kind,
 		Namespace: req.Namespace,
 		Name:      req.Name,
+		Replicas:  req.Replicas,
 	}
 }
 
-// costReport holds information about a cluster & resource cost from
+// containerReports returns the cost of each container before and after
+// the change, paired by PairContainers.
+func containerReports(m *CostModel, from, to Requirements, p Period) []ContainerReport {
+	var reports []ContainerReport
+	for _, c := range PairContainers(from, to) {
+		reports = append(reports, ContainerReport{
+			Name: c.Name,
+			Old:  containerCost(m, c.From, from.Replicas, p),
+			New:  containerCost(m, c.To, to.Replicas, p),
+		})
+	}
+	return reports
+}
+
+// containerCost returns the cost of a container across the replicas of
+// its workload, zero if it doesn't exist.
+func containerCost(m *CostModel, c ContainerRequirements, replicas int, p Period) ContainerCost {
+	return ContainerCost{
+		Name:   c.Name,
+		CPU:    m.CPU.NonSpotCPUForPeriod(p, c.CPU*int64(replicas)),
+		Memory: m.RAM.NonSpotMemoryForPeriod(p, c.Memory*int64(replicas)),
+	}
+}
+
+// CostReport holds information about a cluster & resource cost from
 // its previous state and the desired new requirements.
-type costReport struct {
+type CostReport struct {
 	Cluster string
+	Team    string
+	// ReplicaSource tells where the replicas come from, see
+	// ReplicaSource.String.
+	ReplicaSource string
+	// Scenarios holds the cost in each scenario, when reported.
+	Scenarios []ScenarioCost
+	// Observability holds the cost of the signals of the workload, when
+	// added, see Reporter.AddObservability. It isn't part of the totals.
+	Observability *SummaryReport
+	// DeltaRange is the range of the change in cost, given the spread of
+	// prices and replicas, when added, see Reporter.AddRanges.
+	DeltaRange *Range
+	// Containers breaks the costs down by container, in the order of
+	// PairContainers.
+	Containers []ContainerReport
 
-	Old, New resourcesCost
+	Old, New ResourcesCost
 }
 
-func (r costReport) Delta() float64 {
+// Delta returns the change in total cost.
+func (r CostReport) Delta() float64 {
 	return r.New.Total() - r.Old.Total()
 }
 
-func (s summaryReport) Delta() float64 {
+// Delta returns the change in cost.
+func (s SummaryReport) Delta() float64 {
 	return s.New - s.Old
 }
 
-// costReports is a collection of CostReport.
-type costReports []costReport
-type summaryReport struct {
+// CostReports is a collection of CostReport.
+type CostReports []CostReport
+
+// SummaryReport holds the total cost before and after the change.
+type SummaryReport struct {
 	Old, New float64
 }
 
-func (rs costReports) Totals() (float64, float64) {
+// HasObservability returns whether the observability cost of any report
+// was added.
+func (rs CostReports) HasObservability() bool {
+	for _, r := range rs {
+		if r.Observability != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Totals returns the total cost after and before the change.
+func (rs CostReports) Totals() (float64, float64) {
 	var n, o float64
 
 	for _, r := range rs {
@@ -65,25 +154,99 @@ func (rs costReports) Totals() (float64, float64) {
 	return n, o
 }
 
-func (rs costReports) Sort() {
-	sort.Slice(rs, func(i, j int) bool {
+// Sort sorts the reports by decreasing delta.
+func (rs CostReports) Sort() {
+	sort.SliceStable(rs, func(i, j int) bool {
 		// Higher deltas go on top
-		return rs[i].Delta() > rs[j].Delta()
+		if di, dj := rs[i].Delta(), rs[j].Delta(); di != dj {
+			return di > dj
+		}
+		// Equal deltas, e.g. when listing current costs, are
+		// grouped by namespace and kind.
+		a, b := rs[i].New, rs[j].New
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
 	})
 }
 
-// templateData holds the information passed to the markdown comment
-// template.
-type templateData struct {
-	Reports map[string]costReports
-	Summary map[string]summaryReport
+// TemplateData holds the information passed to the markdown comment
+// template. Costs are in US dollars; the dollars and cost template
+// functions format them in the report currency.
+type TemplateData struct {
+	// Reports holds the reports of each cluster, sorted by decreasing delta.
+	Reports map[string]CostReports
+	// Summary holds the total cost of each cluster.
+	Summary map[string]SummaryReport
+	// Teams holds the summary of the workloads attributed to each team.
+	Teams map[string]SummaryReport
 	// Errors are events that aren't expected and can lead to unexpected results of kost.
 	Errors []string
 	// Warnings are expected events, or known limitations.
 	Warnings []string
+	// CachedAges holds the age of the prices of each cluster whose
+	// cost model was read from a cache.
+	CachedAges map[string]time.Duration
+	// PriceModes holds the clusters whose prices were evaluated in each
+	// mode other than current instant prices, e.g. averaged over a window.
+	PriceModes map[string][]string
+	// Discounts holds the names of the discounts applied to the prices
+	// of each cluster.
+	Discounts map[string][]string
+	// ListPrices holds the total cost at list prices, when reported
+	// next to the effective cost.
+	ListPrices *SummaryReport
+	// Currency is the currency costs are reported in.
+	Currency Currency
+	// Period is the period costs are reported for.
+	Period Period
+	// Efficiency compares the requests of the modified workloads with
+	// their usage, when added, see Reporter.AddUsage.
+	Efficiency []Efficiency
+	// Scenarios holds the total cost in each scenario, when reported,
+	// see Scenario.
+	Scenarios []ScenarioCost
+	// BinPacked holds the total cost bin-packed onto nodes, when node
+	// shapes were added, see Reporter.AddNodeShapes.
+	BinPacked *SummaryReport
+	// NodeShapes holds the shapes each cluster was bin-packed onto, by
+	// node pool.
+	NodeShapes map[string][]NodeShape
+	// NodeChanges holds the predicted change in the node count of each
+	// node pool, when node pools were added, see Reporter.AddNodePools.
+	NodeChanges []NodeChange
+	// Carbon holds the total carbon footprint in kg of CO2e, when carbon
+	// factors were added, see Reporter.AddCarbon.
+	Carbon *SummaryReport
+	// Egress holds the total network egress cost, estimated from the
+	// current traffic of the workloads whose replicas change, when added,
+	// see Reporter.AddEgress. It isn't part of the other totals.
+	Egress *SummaryReport
+	// Observability holds the total observability cost, estimated from
+	// the current signals of the workloads, when added, see
+	// Reporter.AddObservability. It isn't part of the other totals.
+	Observability *SummaryReport
+	// Backups holds the total cost of the snapshots of the persistent
+	// volumes, when backed up, see Reporter.AddBackups. It isn't part of
+	// the other totals.
+	Backups *SummaryReport
+	// Assumptions holds the inputs of the costs of each cluster, when
+	// reported, see WithAssumptions.
+	Assumptions []Assumptions
+	// DeltaRange is the range of the change in total cost, given the
+	// spread of prices and replicas, when added, see Reporter.AddRanges.
+	DeltaRange *Range
+	// Inventory tells the reports are the current cost of the workloads
+	// rather than a change, see WithInventory.
+	Inventory bool
 }
 
-func (d templateData) Delta() float64 {
+// Delta returns the change in total cost of all clusters.
+func (d TemplateData) Delta() float64 {
 	var n, o float64
 	for _, s := range d.Reports {
 		nt, ot := s.Totals()
@@ -94,7 +257,18 @@ func (d templateData) Delta() float64 {
 	return n - o
 }
 
-func (d templateData) OldTotal() float64 {
+// NewTotal returns the total cost of all clusters after the change.
+func (d TemplateData) NewTotal() float64 {
+	var output float64
+	for _, s := range d.Reports {
+		n, _ := s.Totals()
+		output += n
+	}
+	return output
+}
+
+// OldTotal returns the total cost of all clusters before the change.
+func (d TemplateData) OldTotal() float64 {
 	var output float64
 	for _, s := range d.Reports {
 		_, o := s.Totals()
@@ -112,9 +286,19 @@ var commentTemplate string
 // templateFuncs holds the custom functions used within the template.
 var templateFuncs = template.FuncMap{
 	"commentPrefix": func() string { return CommentPrefix },
-	"dollars": func(v float64) string {
-		return displayCostInDollars(v)
-	},
+	// carbon formats a carbon footprint in kg of CO2e.
+	"carbon": formatCarbon,
+	// dollars formats a cost in US dollars in the report currency, see
+	// Reporter.writeMarkdown.
+	"dollars": USD.Format,
+	// signed formats a change in cost like dollars, with a plus sign when
+	// it's positive.
+	"signed": USD.FormatSigned,
+	// price formats an hourly unit price like dollars, see
+	// Currency.FormatPrice.
+	"price": USD.FormatPrice,
+	// hours returns the hours of a period.
+	"hours": func(p Period) float64 { return float64(p) },
 	"percentage": func(r float64) string {
 		return fmt.Sprintf("%.2f%%", r*100)
 	},
@@ -130,35 +314,139 @@ var templateFuncs = template.FuncMap{
 	"multiply": func(a, b float64) float64 {
 		return a * b
 	},
+	// cost is dollars under a name that doesn't assume the currency.
+	"cost": USD.Format,
+	"add": func(a, b float64) float64 {
+		return a + b
+	},
+	"subtract": func(a, b float64) float64 {
+		return a - b
+	},
+	"abs": math.Abs,
+	// code wraps a value in a code element that browsers don't translate.
+	"code": func(v any) string {
+		return fmt.Sprintf(`<code class="notranslate">%v</code>`, v)
+	},
+	"join":  strings.Join,
+	"title": title,
 }
 
 var tpl = template.Must(template.New("").Funcs(templateFuncs).Parse(commentTemplate))
 
+// LoadTemplate reads a markdown comment template, see TemplateData for
+// its data and templateFuncs for its functions. The template is parsed on
+// top of the default one, so that a file only defining some of its
+// templates, e.g. {{ define "footer" }}, overrides those only.
+func LoadTemplate(path string) (*template.Template, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading template: %w", err)
+	}
+
+	t, err := tpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.Parse(string(src)); err != nil {
+		return nil, fmt.Errorf("parsing template %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// title capitalizes the first letter of s.
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
 // writeMarkdown
 func (r *Reporter) writeMarkdown() error {
-	d := templateData{
-		Reports:  make(map[string]costReports),
-		Summary:  make(map[string]summaryReport),
+	d := TemplateData{
+		Reports:  make(map[string]CostReports),
+		Summary:  make(map[string]SummaryReport),
+		Teams:    make(map[string]SummaryReport),
 		Warnings: append([]string(nil), r.warnings...),
 		Errors:   append([]string(nil), r.errors...),
+
+		CachedAges: r.cachedAges(),
+		PriceModes: r.priceModes(),
+		Discounts:  r.discounts(),
+		Currency:   r.currency,
+		Period:     r.mainPeriod(),
+		Efficiency: r.efficiencies(),
+		Scenarios:  r.scenarioTotals(),
+
+		NodeChanges: r.nodeChanges(),
+		Inventory:   r.inventory,
+	}
+	if r.listPrices {
+		from, to := r.listTotals()
+		d.ListPrices = &SummaryReport{Old: from, New: to}
+	}
+	if shapes := r.binPacking(); shapes != nil {
+		from, to := r.binPackedTotals()
+		d.BinPacked = &SummaryReport{Old: from, New: to}
+		d.NodeShapes = shapes
+	}
+	if r.hasCarbon() {
+		from, to := r.carbonTotals()
+		d.Carbon = &SummaryReport{Old: from, New: to}
+	}
+	if from, to, ok := r.egressTotals(); ok {
+		d.Egress = &SummaryReport{Old: from, New: to}
+	}
+	if from, to, ok := r.observabilityTotals(); ok {
+		d.Observability = &SummaryReport{Old: from, New: to}
+	}
+	if from, to, ok := r.backupTotals(); ok {
+		d.Backups = &SummaryReport{Old: from, New: to}
+	}
+	d.Assumptions = r.clusterAssumptions()
+	if _, _, delta, ok := r.rangeTotals(); ok {
+		d.DeltaRange = &delta
+	}
+
+	for _, w := range r.limitWarnings() {
+		d.Warnings = append(d.Warnings, w+".")
+	}
+	for _, w := range r.binPackingWarnings() {
+		d.Warnings = append(d.Warnings, w+".")
+	}
+
+	for _, diag := range r.allDiagnostics() {
+		if diag.Missing() {
+			d.Errors = append(d.Errors, diag.markdown())
+		} else {
+			d.Warnings = append(d.Warnings, diag.markdown())
+		}
 	}
 
 	for _, r := range r.reports {
 		if r.CostModel == nil {
-			d.Errors = append(d.Errors, fmt.Sprintf("<code class=\"notranslate\">%v</code> report is missing cost model", r.To.Name))
+			d.Errors = append(d.Errors, fmt.Sprintf("<code class=\"notranslate\">%v</code> report is missing cost model, see the other errors for why it couldn't be queried", r.To.Name))
 			continue
 		}
 
-		// We have no good estimation for the time a (Cron)Job is running, therefor a cost estimation is highly impossible
-		if r.To.Kind == "CronJob" || r.To.Kind == "Job" {
-			d.Warnings = append(d.Warnings, fmt.Sprintf("<code class=\"notranslate\">%v</code> is a Job or CronJob, cost estimation impossible.", r.To.Name))
-			continue
+		cr := CostReport{
+			Cluster:       r.CostModel.Cluster.Name,
+			Team:          r.team(),
+			ReplicaSource: r.replicaSource.String(),
+			Old:           resourcesCosts(r.CostModel, r.From, d.Period),
+			New:           resourcesCosts(r.CostModel, r.To, d.Period),
+			Containers:    containerReports(r.CostModel, r.From, r.To, d.Period),
 		}
-
-		cr := costReport{
-			Cluster: r.CostModel.Cluster.Name,
-			Old:     resourcesCosts(r.CostModel, r.From),
-			New:     resourcesCosts(r.CostModel, r.To),
+		if d.Scenarios != nil {
+			cr.Scenarios = scenarioCosts(r, d.Period)
+		}
+		if r.observability != nil {
+			from, to := observabilityCosts(r, d.Period)
+			cr.Observability = &SummaryReport{Old: from, New: to}
+		}
+		if r.hasRange() {
+			_, _, delta := costRanges(r, d.Period)
+			cr.DeltaRange = &delta
 		}
 		reports := d.Reports[r.CostModel.Cluster.Name]
 		reports = append(reports, cr)
@@ -168,11 +456,26 @@ func (r *Reporter) writeMarkdown() error {
 		sr.Old += cr.Old.Total()
 		sr.New += cr.New.Total()
 		d.Summary[r.CostModel.Cluster.Name] = sr
+
+		if cr.Team != "" {
+			tr := d.Teams[cr.Team]
+			tr.Old += cr.Old.Total()
+			tr.New += cr.New.Total()
+			d.Teams[cr.Team] = tr
+		}
 	}
 
 	for _, reports := range d.Reports {
 		reports.Sort()
 	}
 
-	return tpl.Execute(r.Writer, d)
+	base := tpl
+	if r.template != nil {
+		base = r.template
+	}
+	t, err := base.Clone()
+	if err != nil {
+		return err
+	}
+	return t.Funcs(template.FuncMap{"dollars": r.currency.Format, "cost": r.currency.Format, "price": r.currency.FormatPrice, "signed": r.currency.FormatSigned}).Execute(r.Writer, d)
 }
@@ -1,8 +1,12 @@
 package costmodel
 
 import (
+	"context"
+	"encoding/json"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -10,7 +14,7 @@ import (
 )
 
 func TestResourcesCost(t *testing.T) {
-	rc := resourcesCost{
+	rc := ResourcesCost{
 		CPU:     1024,
 		Memory:  512,
 		Storage: 256,
@@ -40,9 +44,9 @@ func TestResourcesCosts(t *testing.T) {
 		Replicas:               1,
 	}
 
-	got := resourcesCosts(cm, req)
+	got := resourcesCosts(cm, req, Monthly)
 
-	exp := resourcesCost{
+	exp := ResourcesCost{
 		CPU:     0.1 * 1 * 24 * 30,
 		Memory:  utils.BytesToGiB(2147483648) * 2 * 24 * 30,
 		Storage: utils.BytesToGiB(1024*1024*1024*4) * 3 * 24 * 30,
@@ -66,17 +70,17 @@ func eq(a, b float64) bool {
 
 func TestCostReport(t *testing.T) {
 	tests := []struct {
-		cr  costReport
+		cr  CostReport
 		exp float64
 	}{
 		{
-			costReport{
-				Old: resourcesCost{
+			CostReport{
+				Old: ResourcesCost{
 					CPU:     1,
 					Memory:  2,
 					Storage: 3,
 				},
-				New: resourcesCost{
+				New: ResourcesCost{
 					CPU:     1,
 					Memory:  2,
 					Storage: 3,
@@ -85,13 +89,13 @@ func TestCostReport(t *testing.T) {
 			0,
 		},
 		{
-			costReport{
-				Old: resourcesCost{
+			CostReport{
+				Old: ResourcesCost{
 					CPU:     1,
 					Memory:  2,
 					Storage: 3,
 				},
-				New: resourcesCost{
+				New: ResourcesCost{
 					CPU:     10,
 					Memory:  20,
 					Storage: 30,
@@ -100,13 +104,13 @@ func TestCostReport(t *testing.T) {
 			54,
 		},
 		{
-			costReport{
-				Old: resourcesCost{
+			CostReport{
+				Old: ResourcesCost{
 					CPU:     2,
 					Memory:  4,
 					Storage: 6,
 				},
-				New: resourcesCost{
+				New: ResourcesCost{
 					CPU:     1,
 					Memory:  2,
 					Storage: 3,
@@ -124,14 +128,14 @@ func TestCostReport(t *testing.T) {
 }
 
 func TestCostReports(t *testing.T) {
-	crs := costReports{
+	crs := CostReports{
 		{
-			New: resourcesCost{CPU: 1, Memory: 2, Storage: 3},
-			Old: resourcesCost{CPU: 2, Memory: 4, Storage: 6},
+			New: ResourcesCost{CPU: 1, Memory: 2, Storage: 3},
+			Old: ResourcesCost{CPU: 2, Memory: 4, Storage: 6},
 		},
 		{
-			New: resourcesCost{CPU: 1, Memory: 2, Storage: 3},
-			Old: resourcesCost{CPU: 2, Memory: 4, Storage: 6},
+			New: ResourcesCost{CPU: 1, Memory: 2, Storage: 3},
+			Old: ResourcesCost{CPU: 2, Memory: 4, Storage: 6},
 		},
 	}
 
@@ -241,19 +245,19 @@ func TestTemplate(t *testing.T) {
 }
 
 func TestCostRerpots_Sort(t *testing.T) {
-	crs := costReports{
-		costReport{
+	crs := CostReports{
+		CostReport{
 			Cluster: "foo",
-			New:     resourcesCost{CPU: 1, Memory: 1, Storage: 1},
+			New:     ResourcesCost{CPU: 1, Memory: 1, Storage: 1},
 		},
-		costReport{
+		CostReport{
 			Cluster: "bar",
-			New:     resourcesCost{CPU: 1, Memory: 1, Storage: 1},
-			Old:     resourcesCost{CPU: 1, Memory: 1, Storage: 1},
+			New:     ResourcesCost{CPU: 1, Memory: 1, Storage: 1},
+			Old:     ResourcesCost{CPU: 1, Memory: 1, Storage: 1},
 		},
-		costReport{
+		CostReport{
 			Cluster: "quux",
-			Old:     resourcesCost{CPU: 1, Memory: 1, Storage: 1},
+			Old:     ResourcesCost{CPU: 1, Memory: 1, Storage: 1},
 		},
 	}
 
@@ -269,3 +273,244 @@ func TestCostRerpots_Sort(t *testing.T) {
 		}
 	}
 }
+
+func TestCostReports_SortEqualDeltas(t *testing.T) {
+	crs := CostReports{
+		{New: ResourcesCost{Namespace: "b", Kind: "Deployment", Name: "x"}},
+		{New: ResourcesCost{Namespace: "a", Kind: "StatefulSet", Name: "y"}},
+		{New: ResourcesCost{Namespace: "a", Kind: "Deployment", Name: "z"}},
+		{New: ResourcesCost{Namespace: "a", Kind: "Deployment", Name: "w"}},
+	}
+
+	crs.Sort()
+
+	for i, exp := range []string{"w", "z", "y", "x"} {
+		if g := crs[i].New.Name; g != exp {
+			t.Errorf("expecting %s at index %d, got %s", exp, i, g)
+		}
+	}
+}
+
+func TestReporter_TeamDeltas(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "test"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	req := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "a", Team: "mimir"}
+	bigger := req
+	bigger.Replicas = 2
+	other := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "b", Team: "loki"}
+	unowned := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "c"}
+
+	var s strings.Builder
+	r := New(&s, "markdown")
+	r.AddReport(cm, req, bigger)
+	r.AddReport(cm, other, Requirements{})
+	r.AddReport(cm, Requirements{}, unowned)
+
+	exp := map[string]float64{"mimir": 720, "loki": -720}
+	got := r.TeamDeltas()
+	if len(exp) != len(got) {
+		t.Fatalf("expecting %d teams, got %v", len(exp), got)
+	}
+	for team, e := range exp {
+		if g := got[team]; !eq(e, g) {
+			t.Errorf("expecting delta %.2f for team %s, got %.2f", e, team, g)
+		}
+	}
+
+	if err := r.Write(); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	for _, exp := range []string{"| Team | Previous | New | Delta |", "| `mimir` | $720.00 | $1440.00 | $720.00 (100.00%) |", "| `loki` | $720.00 | $0.00 | -$720.00 (-100.00%) |"} {
+		if !strings.Contains(s.String(), exp) {
+			t.Errorf("expecting markdown to contain %q, got:\n%s", exp, s.String())
+		}
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	req := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+
+	tests := []struct {
+		name       string
+		src        string
+		want       []string
+		notWant    []string
+		currency   Currency
+		wantErrMsg string
+	}{
+		{
+			name:    "footer",
+			src:     `{{ define "footer" }}See the [docs](https://example.com/kost).{{ end }}`,
+			want:    []string{"## :dollar: Cost Estimation Report", "See the [docs](https://example.com/kost)."},
+			notWant: []string{"deployment_tools", "raintank-corp"},
+		},
+		{
+			name: "full",
+			src: `{{ range $cluster, $reports := .Reports }}{{ range $reports }}{{ title $cluster }} {{ code .New.Name }} ` +
+				`{{ cost .New.CPU }} {{ .ReplicaSource }} {{ abs (subtract .Old.Total .New.Total) | cost }}{{ end }}{{ end }} {{ .Currency.Code }} {{ .Period }}`,
+			currency: Currency{Code: "EUR", Rate: 0.5},
+			want:     []string{`Prod <code class="notranslate">wk</code> €360.00 manifest €0.00 EUR monthly`},
+			notWant:  []string{"Cost Estimation Report"},
+		},
+		{name: "invalid", src: "{{ .Reports", wantErrMsg: "parsing template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "comment.tmpl.md")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("writing template: %v", err)
+			}
+
+			tpl, err := LoadTemplate(path)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Errorf("expecting error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			currency := USD
+			if tt.currency.Code != "" {
+				currency = tt.currency
+			}
+			var s strings.Builder
+			r := New(&s, string(Markdown), WithTemplate(tpl), WithCurrency(currency))
+			r.AddReport(cm, req, req)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(s.String(), want) {
+					t.Errorf("expecting comment to contain %q, got:\n%s", want, s.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(s.String(), notWant) {
+					t.Errorf("expecting comment not to contain %q, got:\n%s", notWant, s.String())
+				}
+			}
+		})
+	}
+
+	t.Run("default template is kept", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Markdown))
+		r.AddReport(cm, req, req)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if !strings.Contains(s.String(), "deployment_tools") {
+			t.Errorf("expecting the default footer, got:\n%s", s.String())
+		}
+	})
+}
+
+func TestTemplate_ObservedReplicas(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	from := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.CPUPerPod = 2000
+
+	var s strings.Builder
+	r := New(&s, string(Markdown))
+	r.AddReportWithResolvedReplicas(context.Background(), &fakeResolver{hpaName: "wk", observed: 3}, cm, from, to)
+	if err := r.Write(); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if !strings.Contains(s.String(), "<sub>3 observed replicas</sub>") {
+		t.Errorf("expecting the replica source in the details, got:\n%s", s.String())
+	}
+}
+
+func TestReporter_Containers(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	from := Requirements{
+		CPUPerPod: 2000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk",
+		Containers: []ContainerRequirements{{Name: "app", CPU: 1000}, {Name: "sidecar", CPU: 1000}},
+	}
+	to := from
+	to.CPUPerPod = 3000
+	to.Containers = []ContainerRequirements{{Name: "app", CPU: 1000}, {Name: "sidecar", CPU: 2000}}
+
+	t.Run("markdown", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Markdown))
+		r.AddReport(cm, from, to)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		want := "| `ns` | `Deployment`<br/>`wk` | $1440.00→<br/>$2160.00 | $0.00→<br/>$0.00 | $0.00→<br/>$0.00 | $1440.00→<br/>$2160.00 | $720.00<br/>(50.00%) |\n" +
+			"| | ↳ <sub>`app`</sub> | <sub>$720.00→<br/>$720.00</sub> | <sub>$0.00→<br/>$0.00</sub> | | <sub>$720.00→<br/>$720.00</sub> | <sub>N/A</sub> |\n" +
+			"| | ↳ <sub>`sidecar`</sub> | <sub>$720.00→<br/>$1440.00</sub> | <sub>$0.00→<br/>$0.00</sub> | | <sub>$720.00→<br/>$1440.00</sub> | <sub>$720.00</sub> |\n"
+		if !strings.Contains(s.String(), want) {
+			t.Errorf("expecting the container rows below the workload, got:\n%s", s.String())
+		}
+	})
+
+	// The container rows get an empty observability cell, like the
+	// workloads without signals.
+	t.Run("observability", func(t *testing.T) {
+		o := &Observability{Signals: []ObservabilitySignal{{Name: "series", Query: "series_{{ .Name }}", USDPerUnitMonth: 0.01}}}
+		if err := o.compile(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		other := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "other"}
+		otherTo := other
+		otherTo.Replicas = 2
+
+		var s strings.Builder
+		r := New(&s, string(Markdown))
+		r.AddReport(cm, from, to)
+		r.AddReport(cm, other, otherTo)
+		r.AddObservability(context.Background(), o, fakeObservabilityQuerier{"series_wk": 1000})
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		want, err := os.ReadFile("testdata/markdown/containers-observability.md")
+		if err != nil {
+			t.Fatalf("reading golden file: %v", err)
+		}
+		if s.String() != string(want) {
+			t.Errorf("expecting:\n%s\ngot:\n%s", want, s.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(JSON))
+		r.AddReport(cm, from, to)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		var got jsonReport
+		if err := json.Unmarshal([]byte(s.String()), &got); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", s.String(), err)
+		}
+		cs := got.Workloads[0].Containers
+		if len(cs) != 2 || cs[1].Name != "sidecar" || cs[1].CPUFrom != 1000 || cs[1].CPUTo != 2000 || !eq(cs[1].Costs["monthly-delta"], 720) {
+			t.Errorf("unexpected containers %+v", cs)
+		}
+	})
+
+	t.Run("removed container", func(t *testing.T) {
+		got := containerReports(cm, from, Requirements{Replicas: 1, Containers: from.Containers[:1]}, Monthly)
+		if len(got) != 2 || got[1].Name != "sidecar" || !eq(got[1].Delta(), -720) {
+			t.Errorf("expecting the removed sidecar last, got %+v", got)
+		}
+	})
+}
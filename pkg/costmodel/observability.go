@@ -0,0 +1,228 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+var ErrInvalidObservability = errors.New("invalid observability configuration")
+
+// ObservabilitySignal is a signal ingested into the observability stack
+// for each pod, e.g. its active series, log bytes or spans.
+type ObservabilitySignal struct {
+	// Name identifies the signal in reports, e.g. series.
+	Name string `json:"name"`
+	// Query is a PromQL template returning the amount of the signal of
+	// each pod of a workload, averaged over its pods. It is executed with
+	// ObservabilityQueryData.
+	Query string `json:"query"`
+	// USDPerUnitMonth is the price of a unit of the signal for a month,
+	// e.g. of an active series, or of a GB of logs if the query returns
+	// the GB ingested per month.
+	USDPerUnitMonth float64 `json:"usd_per_unit_month"`
+}
+
+// ObservabilityQueryData is the data the query templates of the signals
+// are executed with.
+type ObservabilityQueryData struct {
+	Cluster   string
+	Namespace string
+	Kind      string
+	Name      string
+	// OwnedPods is a query of the pods of the workload, with a value of
+	// 1, to join the series of the signal with on (namespace, pod).
+	OwnedPods string
+}
+
+// Observability are the signals the cost of observing workloads is
+// estimated from.
+type Observability struct {
+	Signals []ObservabilitySignal `json:"signals"`
+
+	queries []*template.Template
+}
+
+// LoadObservability reads the observability signals from a YAML file with
+// a top-level signals list.
+func LoadObservability(path string) (*Observability, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading observability configuration: %w", err)
+	}
+
+	var o Observability
+	if err := yaml.UnmarshalStrict(src, &o); err != nil {
+		return nil, fmt.Errorf("parsing observability configuration: %w", err)
+	}
+	if err := o.compile(); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// compile validates the signals and parses their queries.
+func (o *Observability) compile() error {
+	o.queries = make([]*template.Template, 0, len(o.Signals))
+	for _, s := range o.Signals {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("%w: missing name", ErrInvalidObservability)
+		case s.Query == "":
+			return fmt.Errorf("%w: %s: missing query", ErrInvalidObservability, s.Name)
+		case s.USDPerUnitMonth < 0:
+			return fmt.Errorf("%w: %s: usd_per_unit_month must be positive, got %v", ErrInvalidObservability, s.Name, s.USDPerUnitMonth)
+		}
+		t, err := template.New(s.Name).Option("missingkey=error").Parse(s.Query)
+		if err != nil {
+			return fmt.Errorf("%w: %s: query: %w", ErrInvalidObservability, s.Name, err)
+		}
+		o.queries = append(o.queries, t)
+	}
+	return nil
+}
+
+// ObservabilityQuerier is the subset of *Client behavior Reporter.AddObservability needs.
+type ObservabilityQuerier interface {
+	GetPodSignal(ctx context.Context, cluster, query string) (float64, error)
+}
+
+var (
+	_ ObservabilityQuerier = (*Client)(nil)
+	_ ObservabilityQuerier = (*Clients)(nil)
+)
+
+// GetPodSignal returns the average over its series of the result of a query of a
+// signal of the pods of a workload. Returns ErrNoResults if the query returns none,
+// e.g. because the workload isn't deployed yet.
+func (c *Client) GetPodSignal(ctx context.Context, _ string, query string) (float64, error) {
+	vec, err := c.queryVectorNow(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if len(vec) == 0 {
+		return 0, ErrNoResults
+	}
+	var sum float64
+	for _, s := range vec {
+		sum += float64(s.Value)
+	}
+	return sum / float64(len(vec)), nil
+}
+
+// PodObservability is the amount of each signal ingested for a pod of a
+// workload, and its cost.
+type PodObservability struct {
+	// Signals holds the amount of each signal observed.
+	Signals map[string]float64
+	// USDPerMonth is the cost of the signals of a pod for a month.
+	USDPerMonth float64
+}
+
+// CostForPeriod returns the observability cost of the replicas over the
+// period, in US dollars.
+func (o PodObservability) CostForPeriod(p Period, replicas int) float64 {
+	return o.USDPerMonth * float64(p) / Monthly * float64(replicas)
+}
+
+// AddObservability queries the signals of the workloads deployed before the
+// change in the reports added so far, to estimate their observability cost
+// from the replicas before and after it. Workloads without any signal are left
+// out; failed queries are added as warnings.
+func (r *Reporter) AddObservability(ctx context.Context, o *Observability, q ObservabilityQuerier) {
+	if o == nil {
+		return
+	}
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil || m.From.Kind == "" || m.To.Kind == "" {
+			continue
+		}
+		data := ObservabilityQueryData{
+			Cluster:   m.CostModel.Cluster.Name,
+			Namespace: m.To.Namespace,
+			Kind:      m.To.Kind,
+			Name:      m.To.Name,
+			OwnedPods: ownedPods(m.CostModel.Cluster.Name, m.To.Namespace, m.To.Kind, m.To.Name),
+		}
+		var pod *PodObservability
+		for j, s := range o.Signals {
+			v, err := r.podSignal(ctx, q, o.queries[j], data)
+			if errors.Is(err, ErrNoResults) {
+				continue
+			} else if err != nil {
+				r.AddWarning(fmt.Sprintf("querying %s of %s/%s/%s on %s: %v",
+					s.Name, data.Namespace, data.Kind, data.Name, data.Cluster, err))
+				continue
+			}
+			if pod == nil {
+				pod = &PodObservability{Signals: make(map[string]float64)}
+			}
+			pod.Signals[s.Name] = v
+			pod.USDPerMonth += v * s.USDPerUnitMonth
+		}
+		r.reports[i].observability = pod
+	}
+}
+
+// podSignal executes the query template of a signal and queries it.
+func (r *Reporter) podSignal(ctx context.Context, q ObservabilityQuerier, t *template.Template, data ObservabilityQueryData) (float64, error) {
+	var query strings.Builder
+	if err := t.Execute(&query, data); err != nil {
+		return 0, err
+	}
+	return q.GetPodSignal(ctx, data.Cluster, query.String())
+}
+
+// observabilityCosts returns the observability cost of the report over
+// the period before and after the change, zero if its signals weren't
+// added.
+func observabilityCosts(m report, p Period) (float64, float64) {
+	if m.observability == nil {
+		return 0, 0
+	}
+	return m.observability.CostForPeriod(p, m.From.Replicas), m.observability.CostForPeriod(p, m.To.Replicas)
+}
+
+// hasObservability returns whether the signals of a report were added.
+func (r *Reporter) hasObservability() bool {
+	for _, m := range r.reports {
+		if m.observability != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// observabilityTotals returns the total observability cost over the main
+// period before and after the change, and whether the signals of any
+// workload were added.
+func (r *Reporter) observabilityTotals() (float64, float64, bool) {
+	var from, to float64
+	var ok bool
+	for _, m := range r.reports {
+		if m.observability == nil {
+			continue
+		}
+		f, t := observabilityCosts(m, r.mainPeriod())
+		from += f
+		to += t
+		ok = true
+	}
+	return from, to, ok
+}
+
+// observabilityTotalLines returns the line of the total observability cost
+// over the main period, if the signals of any workload were added.
+func (r *Reporter) observabilityTotalLines() []string {
+	from, to, ok := r.observabilityTotals()
+	if !ok {
+		return nil
+	}
+	return []string{fmt.Sprintf("Total %s Observability Cost went from %s to %s, based on current signals.",
+		r.mainPeriod().Title(), r.currency.Format(from), r.currency.Format(to))}
+}
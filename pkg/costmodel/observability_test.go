@@ -0,0 +1,179 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeObservabilityQuerier map[string]float64
+
+func (f fakeObservabilityQuerier) GetPodSignal(_ context.Context, cluster, query string) (float64, error) {
+	if strings.Contains(query, "broken") {
+		return 0, errors.New("boom")
+	}
+	v, ok := f[query]
+	if !ok {
+		return 0, ErrNoResults
+	}
+	return v, nil
+}
+
+func TestLoadObservability(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr error
+	}{
+		{
+			name: "valid",
+			src: `signals:
+  - name: series
+    query: count({namespace="{{ .Namespace }}"} * on (namespace, pod) group_left() {{ .OwnedPods }}) by (pod)
+    usd_per_unit_month: 0.008
+`,
+		},
+		{name: "missing name", src: "signals: [{query: up, usd_per_unit_month: 1}]", wantErr: ErrInvalidObservability},
+		{name: "missing query", src: "signals: [{name: series, usd_per_unit_month: 1}]", wantErr: ErrInvalidObservability},
+		{name: "negative price", src: "signals: [{name: series, query: up, usd_per_unit_month: -1}]", wantErr: ErrInvalidObservability},
+		{name: "bad template", src: "signals: [{name: series, query: '{{ .OwnedPods', usd_per_unit_month: 1}]", wantErr: ErrInvalidObservability},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "observability.yaml")
+			if err := os.WriteFile(path, []byte(tt.src), 0o644); err != nil {
+				t.Fatalf("writing observability configuration: %v", err)
+			}
+
+			got, err := LoadObservability(path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expecting %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got.queries) != 1 {
+				t.Fatalf("expecting 1 query, got %d", len(got.queries))
+			}
+			var query strings.Builder
+			data := ObservabilityQueryData{Namespace: "ns", OwnedPods: ownedPods("prod", "ns", "StatefulSet", "wk")}
+			if err := got.queries[0].Execute(&query, data); err != nil {
+				t.Fatalf("unexpected error executing query: %v", err)
+			}
+			if want := `count({namespace="ns"} * on (namespace, pod) group_left() max by (namespace, pod) (kube_pod_owner{cluster="prod", namespace="ns", owner_kind="StatefulSet", owner_name="wk"})) by (pod)`; query.String() != want {
+				t.Errorf("expecting %s, got %s", want, query.String())
+			}
+		})
+	}
+}
+
+func TestClient_GetPodSignal(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		switch q := r.Form.Get("query"); q {
+		case "series_wk":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"pod":"wk-0"},"value":[0,"1000"]},
+				{"metric":{"pod":"wk-1"},"value":[0,"3000"]}]}}`)
+		case "series_new":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			t.Errorf("unexpected query %s", q)
+		}
+	})
+
+	if got, err := c.GetPodSignal(context.Background(), "prod", "series_wk"); err != nil || got != 2000 {
+		t.Errorf("expecting the average of the pods 2000, got %v, %v", got, err)
+	}
+	if _, err := c.GetPodSignal(context.Background(), "prod", "series_new"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without series, got %v", err)
+	}
+}
+
+func TestReporter_AddObservability(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod"}, CPU: Cost{NonSpot: 1}}
+	from := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 4
+	unobserved := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "unobserved"}
+	broken := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "broken"}
+	o := &Observability{
+		Signals: []ObservabilitySignal{
+			{Name: "series", Query: "series_{{ .Name }}", USDPerUnitMonth: 0.01},
+			{Name: "logs", Query: "logs_{{ .Name }}", USDPerUnitMonth: 0.5},
+		},
+	}
+	if err := o.compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 1000 series and 10 GB of logs a month are $15 per replica.
+	q := fakeObservabilityQuerier{"series_wk": 1000, "logs_wk": 10}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.AddReport(prod, unobserved, unobserved)
+		r.AddReport(prod, broken, broken)
+		r.AddObservability(context.Background(), o, q)
+		return r
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		if p := r.reports[0].observability; p == nil || p.Signals["series"] != 1000 || !feq(p.USDPerMonth, 15) {
+			t.Errorf("unexpected observability of wk %+v", p)
+		}
+		if r.reports[1].observability != nil || r.reports[2].observability != nil {
+			t.Errorf("expecting no observability for workloads without signals, got %+v", r.reports)
+		}
+		want := []string{
+			"querying series of ns/Deployment/broken on prod: boom",
+			"querying logs of ns/Deployment/broken on prod: boom",
+		}
+		if len(r.warnings) != len(want) || r.warnings[0] != want[0] || r.warnings[1] != want[1] {
+			t.Errorf("expecting %v, got %v", want, r.warnings)
+		}
+	})
+
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary: {"Total Monthly Observability Cost went from $30.00 to $60.00, based on current signals.\n"},
+		CSV:     {"observability_monthly_to,observability_monthly_delta\n", ",60.00,30.00\n"},
+		Markdown: {
+			":telescope: Monthly observability cost will go from $30.00 to $60.00 ($30.00), based on current signals.",
+			"| $30.00→<br/>$60.00 |",
+		},
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Markdown))
+		r.AddReport(prod, to, to)
+		r.AddObservability(context.Background(), o, q)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if want := ":telescope: Monthly observability cost is $60.00, based on current signals."; !strings.Contains(s.String(), want) {
+			t.Errorf("expecting report to contain %q, got:\n%s", want, s.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		if o := got.Workloads[0].Observability; o == nil || o.Signals["logs"] != 10 || !feq(o.From, 30) || !feq(o.To, 60) {
+			t.Errorf("unexpected observability %+v", o)
+		}
+		if !feq(got.Totals["monthly-delta"], 2*720) {
+			t.Errorf("expecting the observability cost not to be part of the totals, got %v", got.Totals)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// queryPriceRange reports the lowest or highest hourly price of a resource across the instance types of a cluster.
+	// Format args: aggregation (min or max), metric, cluster, metric, cluster, metric, cluster.
+	queryPriceRange = `
+	%s by (price_tier) (
+		cloudcost_aws_ec2_instance_%s{cluster_name="%s"}
+		or
+		cloudcost_azure_aks_instance_%s{cluster_name="%s"}
+		or
+		cloudcost_gcp_gke_instance_%s{cluster_name="%s"}
+)
+`
+
+	// queryReplicaQuantile reports a quantile of the replica count of a workload over a 7d window.
+	// Format args: quantile, metric, cluster, namespace, kindLabel, name.
+	queryReplicaQuantile = `avg(quantile_over_time(%v, %s{cluster="%s", namespace="%s", %s="%s"}[7d]))`
+)
+
+// Price metrics of the instances of cloudcost-exporter, without their
+// cloud prefix.
+const (
+	metricCPUPrice    = "cpu_usd_per_core_hour"
+	metricMemoryPrice = "memory_usd_per_gib_hour"
+)
+
+// replicaQuantiles are the quantiles of the observed replicas bounding
+// their range.
+var replicaQuantiles = Range{Low: 0.1, High: 0.9}
+
+// Range is an interval around a point estimate.
+type Range struct {
+	Low, High float64
+}
+
+// PriceRange holds the lowest and highest non-spot hourly prices of CPU
+// and memory across the instance types of a cluster, at list prices.
+type PriceRange struct {
+	CPU    Range
+	Memory Range
+}
+
+// RangeQuerier is the subset of *Client behavior Reporter.AddRanges needs.
+type RangeQuerier interface {
+	GetPriceRange(ctx context.Context, cluster string) (PriceRange, error)
+	GetReplicaRange(ctx context.Context, cluster, namespace, kind, name string) (Range, error)
+}
+
+var (
+	_ RangeQuerier = (*Client)(nil)
+	_ RangeQuerier = (*Clients)(nil)
+)
+
+// GetPriceRange returns the lowest and highest price of CPU and memory across the
+// instance types of a cluster, over the price window if set. Returns ErrNoResults if
+// the cluster has no price.
+func (c *Client) GetPriceRange(ctx context.Context, cluster string) (PriceRange, error) {
+	var pr PriceRange
+	bounds := []struct {
+		agg    string
+		metric string
+		price  *float64
+	}{
+		{"min", metricCPUPrice, &pr.CPU.Low},
+		{"max", metricCPUPrice, &pr.CPU.High},
+		{"min", metricMemoryPrice, &pr.Memory.Low},
+		{"max", metricMemoryPrice, &pr.Memory.High},
+	}
+	for _, b := range bounds {
+		query := c.priceRangeQuery(b.agg, fmt.Sprintf(queryPriceRange, b.agg, b.metric, cluster, b.metric, cluster, b.metric, cluster))
+		vec, _, err := c.queryVector(ctx, query, c.pricedAt())
+		if err != nil {
+			return PriceRange{}, err
+		}
+		cost, err := c.parseResults(vec)
+		if err != nil {
+			return PriceRange{}, err
+		}
+		*b.price = cost.NonSpot
+	}
+	return pr, nil
+}
+
+// priceRangeQuery returns the query to evaluate for a bound of a price,
+// taking the same bound over the price window if set.
+func (c *Client) priceRangeQuery(agg, query string) string {
+	if c.priceWindow <= 0 {
+		return query
+	}
+	return fmt.Sprintf("%s_over_time((%s)[%s:%s])", agg, strings.TrimSpace(query), model.Duration(c.priceWindow), model.Duration(c.priceStep()))
+}
+
+// GetReplicaRange returns the 10th and 90th percentiles of the replicas of a
+// workload over the last 7 days. Returns ErrNoResults if the workload has none.
+func (c *Client) GetReplicaRange(ctx context.Context, cluster, namespace, kind, name string) (Range, error) {
+	metric, kindLabel, err := replicaMetricForKind(kind)
+	if err != nil {
+		return Range{}, err
+	}
+	var r Range
+	for _, q := range []struct {
+		quantile float64
+		replicas *float64
+	}{{replicaQuantiles.Low, &r.Low}, {replicaQuantiles.High, &r.High}} {
+		vec, err := c.queryVectorNow(ctx, fmt.Sprintf(queryReplicaQuantile, q.quantile, metric, cluster, namespace, kindLabel, name))
+		if err != nil {
+			return Range{}, err
+		}
+		if len(vec) == 0 {
+			return Range{}, ErrNoResults
+		}
+		*q.replicas = float64(vec[0].Value)
+	}
+	return r, nil
+}
+
+// AddRanges queries the spread of the prices of the clusters of the reports
+// added so far across their instance types, and of the observed replicas of
+// the HPA-managed workloads, to report the range of their costs next to the
+// point estimates. Failed queries are added as warnings.
+func (r *Reporter) AddRanges(ctx context.Context, q RangeQuerier) {
+	prices := make(map[string]*PriceRange)
+	for i, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.Cluster == nil {
+			continue
+		}
+		cluster := m.CostModel.Cluster.Name
+		pr, ok := prices[cluster]
+		if !ok {
+			p, err := q.GetPriceRange(ctx, cluster)
+			if err == nil {
+				pr = &p
+			} else if !errors.Is(err, ErrNoResults) {
+				r.AddWarning(fmt.Sprintf("querying price range of %s: %v", cluster, err))
+			}
+			prices[cluster] = pr
+		}
+		r.reports[i].priceRange = pr
+
+		if m.replicaSource != SourceObservedHPA {
+			continue
+		}
+		id := workload(m.From, m.To)
+		rr, err := q.GetReplicaRange(ctx, cluster, id.Namespace, id.Kind, id.Name)
+		if errors.Is(err, ErrNoResults) {
+			continue
+		} else if err != nil {
+			r.AddWarning(fmt.Sprintf("querying replica percentiles of %s/%s/%s on %s: %v",
+				id.Namespace, id.Kind, id.Name, cluster, err))
+			continue
+		}
+		r.reports[i].replicaRange = &rr
+	}
+}
+
+// hasRange returns whether the report has a price or replica range.
+func (m report) hasRange() bool {
+	return m.priceRange != nil || m.replicaRange != nil
+}
+
+// boundCostModel returns the cost model at the low or high bound of the
+// price range, scaled by the discounts applied to the prices.
+func (m report) boundCostModel(high bool) *CostModel {
+	if m.priceRange == nil {
+		return m.CostModel
+	}
+	cm := *m.CostModel
+	list := m.CostModel.ListPrices()
+	bound := func(r Range, price, listPrice float64) float64 {
+		b := r.Low
+		if high {
+			b = r.High
+		}
+		if listPrice == 0 {
+			return b
+		}
+		return b * price / listPrice
+	}
+	cm.CPU.NonSpot = bound(m.priceRange.CPU, m.CostModel.CPU.NonSpot, list.CPU.NonSpot)
+	cm.RAM.NonSpot = bound(m.priceRange.Memory, m.CostModel.RAM.NonSpot, list.RAM.NonSpot)
+	return &cm
+}
+
+// boundRequirements returns the requirements at the low or high bound of
+// the replica range.
+func (m report) boundRequirements(req Requirements, high bool) Requirements {
+	if m.replicaRange == nil || req.Kind == "" {
+		return req
+	}
+	replicas := m.replicaRange.Low
+	if high {
+		replicas = m.replicaRange.High
+	}
+	req.Replicas = int(math.Round(replicas))
+	return req
+}
+
+// costRanges returns the range of the total cost of the report over the
+// period before and after the change, and of its change. The ranges are
+// the point estimates if the report has no range.
+func costRanges(m report, p Period) (Range, Range, Range) {
+	var from, to, delta [2]float64
+	for i, high := range []bool{false, true} {
+		cm := m.boundCostModel(high)
+		from[i], to[i] = calculateTotalCostForPeriod(p, m.boundRequirements(m.From, high), m.boundRequirements(m.To, high), cm)
+		delta[i] = to[i] - from[i]
+	}
+	span := func(v [2]float64) Range {
+		return Range{Low: math.Min(v[0], v[1]), High: math.Max(v[0], v[1])}
+	}
+	return span(from), span(to), span(delta)
+}
+
+// hasRanges returns whether any report has a range.
+func (r *Reporter) hasRanges() bool {
+	for _, m := range r.reports {
+		if m.hasRange() {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeTotals returns the range of the total cost over the main period
+// before and after the change, and of its change, and whether any report
+// has a range.
+func (r *Reporter) rangeTotals() (Range, Range, Range, bool) {
+	var from, to, delta Range
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+		f, t, d := costRanges(m, r.mainPeriod())
+		from.Low, from.High = from.Low+f.Low, from.High+f.High
+		to.Low, to.High = to.Low+t.Low, to.High+t.High
+		delta.Low, delta.High = delta.Low+d.Low, delta.High+d.High
+	}
+	return from, to, delta, r.hasRanges()
+}
+
+// rangeTotalLines returns the line of the range of the change in total
+// cost over the main period, if any report has a range.
+func (r *Reporter) rangeTotalLines() []string {
+	_, to, delta, ok := r.rangeTotals()
+	if !ok {
+		return nil
+	}
+	return []string{fmt.Sprintf("Total %s Cost is likely between %s and %s, a change of %s to %s given the spread of prices and replicas.",
+		r.mainPeriod().Title(), r.currency.Format(to.Low), r.currency.Format(to.High),
+		r.currency.FormatSigned(delta.Low), r.currency.FormatSigned(delta.High))}
+}
@@ -0,0 +1,153 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type fakeRangeQuerier struct {
+	prices   map[string]PriceRange
+	replicas map[string]Range
+}
+
+func (f fakeRangeQuerier) GetPriceRange(_ context.Context, cluster string) (PriceRange, error) {
+	if cluster == "broken" {
+		return PriceRange{}, errors.New("boom")
+	}
+	pr, ok := f.prices[cluster]
+	if !ok {
+		return PriceRange{}, ErrNoResults
+	}
+	return pr, nil
+}
+
+func (f fakeRangeQuerier) GetReplicaRange(_ context.Context, cluster, namespace, kind, name string) (Range, error) {
+	rr, ok := f.replicas[name]
+	if !ok {
+		return Range{}, ErrNoResults
+	}
+	return rr, nil
+}
+
+func TestClient_GetPriceRange(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		q := r.Form.Get("query")
+		prices := map[string]string{
+			`min by (price_tier) ( cloudcost_aws_ec2_instance_cpu_usd_per_core_hour{cluster_name="prod"}`:                   "0.02",
+			`max by (price_tier) ( cloudcost_aws_ec2_instance_cpu_usd_per_core_hour{cluster_name="prod"}`:                   "0.05",
+			`min by (price_tier) ( cloudcost_aws_ec2_instance_memory_usd_per_gib_hour{cluster_name="prod"}`:                 "0.003",
+			`max by (price_tier) ( cloudcost_aws_ec2_instance_memory_usd_per_gib_hour{cluster_name="prod"}`:                 "0.006",
+			`quantile_over_time(0.1, kube_deployment_status_replicas{cluster="prod", namespace="ns", deployment="wk"}[7d])`: "2",
+			`quantile_over_time(0.9, kube_deployment_status_replicas{cluster="prod", namespace="ns", deployment="wk"}[7d])`: "7",
+		}
+		for prefix, v := range prices {
+			if strings.Contains(compactQuery(q), prefix) {
+				fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"price_tier":"ondemand"},"value":[0,"%s"]}]}}`, v)
+				return
+			}
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	})
+
+	pr, err := c.GetPriceRange(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (PriceRange{CPU: Range{0.02, 0.05}, Memory: Range{0.003, 0.006}}); pr != want {
+		t.Errorf("expecting %+v, got %+v", want, pr)
+	}
+	if _, err := c.GetPriceRange(context.Background(), "dev"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without prices, got %v", err)
+	}
+
+	rr, err := c.GetReplicaRange(context.Background(), "prod", "ns", "Deployment", "wk")
+	if err != nil || rr != (Range{2, 7}) {
+		t.Errorf("expecting replicas from 2 to 7, got %+v, %v", rr, err)
+	}
+	if _, err := c.GetReplicaRange(context.Background(), "prod", "ns", "Deployment", "new"); !errors.Is(err, ErrNoResults) {
+		t.Errorf("expecting ErrNoResults without replicas, got %v", err)
+	}
+}
+
+func TestReporter_AddRanges(t *testing.T) {
+	prod := &CostModel{Cluster: &Cluster{Name: "prod"}, CPU: Cost{NonSpot: 1}}
+	broken := &CostModel{Cluster: &Cluster{Name: "broken"}, CPU: Cost{NonSpot: 1}}
+	from := Requirements{CPUPerPod: 1000, Replicas: 2, Kind: "Deployment", Namespace: "ns", Name: "wk"}
+	to := from
+	to.Replicas = 4
+	hpaFrom := Requirements{CPUPerPod: 1000, Replicas: 3, Kind: "Deployment", Namespace: "ns", Name: "hpa"}
+	hpaTo := hpaFrom
+	hpaTo.CPUPerPod = 2000
+	q := fakeRangeQuerier{
+		prices:   map[string]PriceRange{"prod": {CPU: Range{Low: 0.5, High: 2}}},
+		replicas: map[string]Range{"hpa": {Low: 2, High: 5}},
+	}
+
+	newReporter := reporterFunc(func(s *strings.Builder, reportType ReportType) *Reporter {
+		r := New(s, string(reportType))
+		r.AddReport(prod, from, to)
+		r.addReport(prod, hpaFrom, hpaTo, SourceObservedHPA)
+		r.AddReport(broken, from, from)
+		r.AddRanges(context.Background(), q)
+		return r
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		r := newReporter(nil, Table)
+		if r.reports[0].priceRange == nil || r.reports[0].replicaRange != nil {
+			t.Errorf("expecting the price range only for wk, got %+v", r.reports[0])
+		}
+		if rr := r.reports[1].replicaRange; rr == nil || *rr != (Range{2, 5}) {
+			t.Errorf("expecting the replica range of hpa, got %+v", rr)
+		}
+		if len(r.warnings) != 1 || r.warnings[0] != "querying price range of broken: boom" {
+			t.Errorf("expecting a warning for the failed query, got %v", r.warnings)
+		}
+
+		// wk adds 2 CPUs for 720h, at $0.5 to $2 per core-hour.
+		_, _, delta := costRanges(r.reports[0], Monthly)
+		if !feq(delta.Low, 720) || !feq(delta.High, 2880) {
+			t.Errorf("expecting a change of $720 to $2880, got %+v", delta)
+		}
+		// hpa adds a CPU to each of 2 to 5 replicas.
+		_, to, delta := costRanges(r.reports[1], Monthly)
+		if !feq(delta.Low, 720) || !feq(delta.High, 7200) || !feq(to.Low, 1440) {
+			t.Errorf("expecting a change of $720 to $7200, got %+v", delta)
+		}
+	})
+
+	newReporter.assertContains(t, map[ReportType][]string{
+		Summary:  {"Total Monthly Cost is likely between $4320.00 and $21600.00, a change of +$1440.00 to +$10080.00 given the spread of prices and replicas.\n"},
+		Markdown: {"(100.00%)<br/><sub>+$720.00 to +$7200.00</sub> |"},
+	})
+
+	t.Run("json", func(t *testing.T) {
+		got := newReporter.writeJSON(t)
+		if rg := got.Workloads[0].Range; rg == nil || !feq(rg.Delta.Low, 720) || !feq(rg.Delta.High, 2880) {
+			t.Errorf("unexpected range %+v", rg)
+		}
+		if got.Workloads[2].Range != nil {
+			t.Errorf("expecting no range for broken, got %+v", got.Workloads[2].Range)
+		}
+	})
+}
+
+func TestReport_boundCostModel(t *testing.T) {
+	list := &CostModel{CPU: Cost{NonSpot: 1}, RAM: Cost{NonSpot: 0.1}}
+	discounted := &CostModel{CPU: Cost{NonSpot: 0.8}, RAM: Cost{NonSpot: 0.1}, List: list}
+	m := report{CostModel: discounted, priceRange: &PriceRange{CPU: Range{0.5, 2}, Memory: Range{0.05, 0.2}}}
+
+	if cm := m.boundCostModel(false); !feq(cm.CPU.NonSpot, 0.4) || !feq(cm.RAM.NonSpot, 0.05) {
+		t.Errorf("expecting the discounted low prices, got %+v", cm)
+	}
+	if cm := m.boundCostModel(true); !feq(cm.CPU.NonSpot, 1.6) || !feq(cm.RAM.NonSpot, 0.2) {
+		t.Errorf("expecting the discounted high prices, got %+v", cm)
+	}
+}
@@ -17,6 +17,14 @@ const (
 	SourceObservedHPA
 )
 
+// String returns manifest or observed.
+func (s ReplicaSource) String() string {
+	if s == SourceObservedHPA {
+		return "observed"
+	}
+	return "manifest"
+}
+
 // HPAResolver is the subset of *Client behavior ResolveReplicas needs.
 // Lets policy be tested without httptest.
 type HPAResolver interface {
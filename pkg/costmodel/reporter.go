@@ -2,20 +2,25 @@ package costmodel
 
 import (
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"text/template"
+	"time"
 )
 
-var (
-	headers = []string{"Cluster", "Total Weekly Cost", "Δ Weekly Cost", "Total Monthly Cost", "Δ Monthly Cost"}
-	periods = []Period{
-		Weekly,
-		Monthly,
-	}
-)
+// defaultPeriods are the periods reported when none are configured.
+var defaultPeriods = []Period{
+	Weekly,
+	Monthly,
+}
 
 var ErrNoReports = errors.New("nothing to report")
 
@@ -25,6 +30,8 @@ const (
 	Table    ReportType = "table"
 	Summary  ReportType = "summary"
 	Markdown ReportType = "markdown"
+	CSV      ReportType = "csv"
+	JSON     ReportType = "json"
 )
 
 type Reporter struct {
@@ -33,6 +40,78 @@ type Reporter struct {
 	reportType ReportType
 	warnings   []string
 	errors     []string
+	// diagnostics describe problems querying cost models outside
+	// of the reports.
+	diagnostics []Diagnostic
+	// listPrices reports the monthly cost at list prices next to the
+	// effective cost.
+	listPrices bool
+	// currency is the currency costs are reported in.
+	currency Currency
+	// periods are the periods costs are reported for. The last one is
+	// used where a single period is reported.
+	periods []Period
+	// columns are the columns of the table and csv reports. The report
+	// type defaults are used if empty.
+	columns []Column
+	// template is the markdown comment template, the embedded one if nil.
+	template *template.Template
+	// scenarios reports the cost at limits and with the Guaranteed QoS
+	// class, see Scenario.
+	scenarios bool
+	// nodePools holds the node pools of each cluster, if added, see
+	// AddNodePools.
+	nodePools map[string][]NodePool
+	// assumptions reports the inputs of the costs of each cluster, see
+	// Assumptions.
+	assumptions bool
+	// inventory reports the current cost of the workloads rather than a
+	// change, see WithInventory.
+	inventory bool
+}
+
+// WithCurrency reports costs converted to the currency.
+func WithCurrency(c Currency) Option {
+	return func(r *Reporter) {
+		r.currency = c
+	}
+}
+
+// WithPeriods reports costs for the periods, in order. The last period is
+// used where a single period is reported, e.g. in the summary and markdown
+// reports.
+func WithPeriods(periods ...Period) Option {
+	return func(r *Reporter) {
+		if len(periods) > 0 {
+			r.periods = periods
+		}
+	}
+}
+
+// WithColumns sets the columns of the table and csv reports.
+func WithColumns(columns ...Column) Option {
+	return func(r *Reporter) {
+		r.columns = columns
+	}
+}
+
+// WithTemplate writes markdown reports with the template, see
+// LoadTemplate.
+func WithTemplate(t *template.Template) Option {
+	return func(r *Reporter) {
+		r.template = t
+	}
+}
+
+// Option configures a Reporter.
+type Option func(*Reporter)
+
+// WithListPrices reports the monthly cost at list prices, before
+// discounts, next to the effective cost.
+func WithListPrices() Option {
+	return func(r *Reporter) {
+		r.listPrices = true
+	}
 }
 
 // report is a model for a cost report.
@@ -40,17 +119,50 @@ type report struct {
 	CostModel *CostModel
 	From      Requirements
 	To        Requirements
+	// replicaSource tells where the replicas of From and To come from.
+	replicaSource ReplicaSource
+	// usage is the usage of the workload, if added, see AddUsage.
+	usage *PodUsage
+	// nodeShapes are the shapes of the nodes the workload is bin-packed
+	// onto, if added, see AddNodeShapes.
+	nodeShapes *WorkloadShapes
+	// carbon are the carbon factors of the cluster of the workload, if
+	// added, see AddCarbon.
+	carbon *CarbonFactors
+	// egress is the traffic of a pod of the workload, if added, see
+	// AddEgress.
+	egress *PodEgress
+	// observability is the signals of a pod of the workload, if added,
+	// see AddObservability.
+	observability *PodObservability
+	// backups are the backup policies of the volumes of the workload, if
+	// added, see AddBackups.
+	backups *WorkloadBackups
+	// priceRange is the spread of the prices of the cluster of the
+	// workload, if added, see AddRanges.
+	priceRange *PriceRange
+	// replicaRange is the spread of the observed replicas of the
+	// workload, if added, see AddRanges.
+	replicaRange *Range
 }
 
 // AddReport adds a costmodel and associated from, to resources to the reporter.
 func (r *Reporter) AddReport(costModel *CostModel, from, to Requirements) {
-	if to.Kind == "Job" || to.Kind == "Cronjob" {
+	r.addReport(costModel, from, to, SourceManifest)
+}
+
+func (r *Reporter) addReport(costModel *CostModel, from, to Requirements, source ReplicaSource) {
+	// We have no good estimation for the time a (Cron)Job is running,
+	// therefore a cost estimation is impossible.
+	if w := workload(from, to); w.Kind == "Job" || w.Kind == "CronJob" {
+		r.AddWarning(fmt.Sprintf("%s/%s/%s is a Job or CronJob, cost estimation impossible", w.Namespace, w.Kind, w.Name))
 		return
 	}
 	r.reports = append(r.reports, report{
-		CostModel: costModel,
-		From:      from,
-		To:        to,
+		CostModel:     costModel,
+		From:          from,
+		To:            to,
+		replicaSource: source,
 	})
 }
 
@@ -77,10 +189,7 @@ func (r *Reporter) AddReportWithResolvedReplicas(
 	cm *CostModel,
 	from, to Requirements,
 ) {
-	id := to
-	if id.Kind == "" {
-		id = from
-	}
+	id := workload(from, to)
 	if cm == nil || cm.Cluster == nil || (id.Kind != "Deployment" && id.Kind != "StatefulSet") {
 		r.AddReport(cm, from, to)
 		return
@@ -108,7 +217,184 @@ func (r *Reporter) AddReportWithResolvedReplicas(
 		))
 	}
 
-	r.AddReport(cm, from, to)
+	r.addReport(cm, from, to, source)
+}
+
+// team returns the team attributed to the report's workload.
+func (r report) team() string {
+	if r.To.Kind != "" {
+		return r.To.Team
+	}
+	return r.From.Team
+}
+
+// TeamDeltas returns the change in monthly cost attributed to each team.
+// Workloads without a team are left out.
+func (r *Reporter) TeamDeltas() map[string]float64 {
+	deltas := make(map[string]float64)
+	for _, m := range r.reports {
+		if m.CostModel == nil || m.team() == "" {
+			continue
+		}
+		from, to := calculateTotalCostForPeriod(Monthly, m.From, m.To, m.CostModel)
+		deltas[m.team()] += to - from
+	}
+	return deltas
+}
+
+// cachedAges returns the age of the cost model of each cluster whose
+// prices were read from a cache rather than queried for this report.
+func (r *Reporter) cachedAges() map[string]time.Duration {
+	ages := make(map[string]time.Duration)
+	for _, m := range r.reports {
+		if m.CostModel == nil || !m.CostModel.Cached {
+			continue
+		}
+		ages[m.CostModel.Cluster.Name] = m.CostModel.Age().Round(time.Minute)
+	}
+	return ages
+}
+
+// AddDiagnostic records a problem querying the cost model of a cluster
+// that isn't in the report, e.g. because it couldn't be queried at all.
+// The diagnostics of the cost models in the report are surfaced without
+// being added.
+func (r *Reporter) AddDiagnostic(d Diagnostic) {
+	r.diagnostics = append(r.diagnostics, d)
+}
+
+// AddCostModelError records why the cost model of a cluster couldn't be
+// queried, with a diagnostic per missing part if err is a *CostModelError.
+func (r *Reporter) AddCostModelError(cluster string, err error) {
+	var cmErr *CostModelError
+	if !errors.As(err, &cmErr) {
+		r.AddError(fmt.Sprintf("could not get cost model for cluster %s: %s", cluster, err))
+		return
+	}
+	for _, d := range cmErr.Diagnostics {
+		r.AddDiagnostic(d)
+	}
+}
+
+// allDiagnostics returns the diagnostics added to the reporter followed
+// by those of the cost models in the report.
+func (r *Reporter) allDiagnostics() []reportedDiagnostic {
+	ds := make([]reportedDiagnostic, 0, len(r.diagnostics))
+	for _, d := range r.diagnostics {
+		ds = append(ds, reportedDiagnostic{Diagnostic: d})
+	}
+
+	seen := make(map[*CostModel]bool)
+	for _, m := range r.reports {
+		if m.CostModel == nil || seen[m.CostModel] {
+			continue
+		}
+		seen[m.CostModel] = true
+		for _, d := range m.CostModel.Diagnostics {
+			ds = append(ds, reportedDiagnostic{Diagnostic: d, partial: true})
+		}
+	}
+	return ds
+}
+
+// priceModes returns the clusters whose prices were evaluated in each
+// mode other than current instant prices, see CostModel.PriceMode.
+func (r *Reporter) priceModes() map[string][]string {
+	modes := make(map[string][]string)
+	for _, m := range r.reports {
+		if m.CostModel == nil || m.CostModel.PriceMode() == "" {
+			continue
+		}
+		mode := m.CostModel.PriceMode()
+		if !slices.Contains(modes[mode], m.CostModel.Cluster.Name) {
+			modes[mode] = append(modes[mode], m.CostModel.Cluster.Name)
+		}
+	}
+	for _, clusters := range modes {
+		sort.Strings(clusters)
+	}
+	return modes
+}
+
+// discounts returns the names of the discounts applied to the prices
+// of each cluster.
+func (r *Reporter) discounts() map[string][]string {
+	discounts := make(map[string][]string)
+	for _, m := range r.reports {
+		if m.CostModel == nil || len(m.CostModel.Discounts) == 0 {
+			continue
+		}
+		discounts[m.CostModel.Cluster.Name] = m.CostModel.Discounts
+	}
+	return discounts
+}
+
+// mainPeriod is the period used where a single period is reported.
+func (r *Reporter) mainPeriod() Period {
+	return r.periods[len(r.periods)-1]
+}
+
+// listTotals returns the total cost over the main period at list prices
+// before and after the change.
+func (r *Reporter) listTotals() (float64, float64) {
+	var from, to float64
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+		f, t := calculateTotalCostForPeriod(r.mainPeriod(), m.From, m.To, m.CostModel.ListPrices())
+		from += f
+		to += t
+	}
+	return from, to
+}
+
+// writeFootnotes writes the currency and when the prices were evaluated,
+// a line per cluster whose prices were cached or discounted, a line per
+// over-provisioned workload, and the diagnostics.
+func (r *Reporter) writeFootnotes() error {
+	if r.currency.Code != USD.Code {
+		if _, err := fmt.Fprintf(r.Writer, "Costs are in %s, converted from USD at %v %s per USD.\n", r.currency.Code, r.currency.Rate, r.currency.Code); err != nil {
+			return err
+		}
+	}
+
+	modes := r.priceModes()
+	for _, mode := range slices.Sorted(maps.Keys(modes)) {
+		if _, err := fmt.Fprintf(r.Writer, "Prices for %s were %s.\n", strings.Join(modes[mode], ", "), mode); err != nil {
+			return err
+		}
+	}
+
+	ages := r.cachedAges()
+	for _, c := range slices.Sorted(maps.Keys(ages)) {
+		if _, err := fmt.Fprintf(r.Writer, "Prices for cluster %s were cached %s ago.\n", c, ages[c]); err != nil {
+			return err
+		}
+	}
+
+	discounts := r.discounts()
+	for _, c := range slices.Sorted(maps.Keys(discounts)) {
+		if _, err := fmt.Fprintf(r.Writer, "Prices for cluster %s include discounts: %s.\n", c, strings.Join(discounts[c], ", ")); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range r.efficiencies() {
+		if !e.OverProvisioned() {
+			continue
+		}
+		if _, err := io.WriteString(r.Writer, e.text(r.currency, r.mainPeriod())); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range r.allDiagnostics() {
+		if _, err := io.WriteString(r.Writer, d.text()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // AddError records a message about an unexpected event that may have led to
@@ -117,15 +403,21 @@ func (r *Reporter) AddError(msg string) {
 	r.errors = append(r.errors, msg)
 }
 
-func New(w io.Writer, reportType string) *Reporter {
+func New(w io.Writer, reportType string, opts ...Option) *Reporter {
 	// If the writer passed in is nil, set it to io.Discard to prevent nil pointer exceptions later on
 	if w == nil {
 		w = io.Discard
 	}
-	return &Reporter{
+	r := &Reporter{
 		Writer:     w,
 		reportType: ReportType(reportType),
+		currency:   USD,
+		periods:    defaultPeriods,
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
 }
 
 func (r *Reporter) Write() error {
@@ -140,6 +432,10 @@ func (r *Reporter) Write() error {
 		return r.writeTable()
 	case Markdown:
 		return r.writeMarkdown()
+	case CSV:
+		return r.writeCSV()
+	case JSON:
+		return r.writeJSON()
 	default:
 		return fmt.Errorf("report type %s not supported", r.reportType)
 	}
@@ -148,7 +444,7 @@ func (r *Reporter) Write() error {
 func (r *Reporter) writeSummary() error {
 	tabwriter := tabwriter.NewWriter(r.Writer, 8, 6, 2, ' ', 0)
 
-	var p Period = Monthly
+	p := r.mainPeriod()
 	fromTotalCost, toTotalCost := 0.0, 0.0
 	for _, m := range r.reports {
 		// Prevent a nil pointer exception here. Probably better ways to handle this
@@ -164,55 +460,135 @@ func (r *Reporter) writeSummary() error {
 	var rows []string
 	rows = append(
 		rows,
-		fmt.Sprintf("PR changed the overall cost by %s(%.1f%%).", displayCostInDollars(totalDiff), percentageChange(fromTotalCost, toTotalCost)),
-		fmt.Sprintf("Total Monthly Cost went from $%.2f to $%.2f.", fromTotalCost, toTotalCost),
+		fmt.Sprintf("PR changed the overall cost by %s(%.1f%%).", r.currency.Format(totalDiff), percentageChange(fromTotalCost, toTotalCost)),
+		fmt.Sprintf("Total %s Cost went from %s to %s.", p.Title(), r.currency.Format(fromTotalCost), r.currency.Format(toTotalCost)),
 	)
+	if r.inventory {
+		rows = r.inventorySummary()
+	} else if r.listPrices {
+		from, to := r.listTotals()
+		rows = append(rows, fmt.Sprintf("Total %s Cost at list prices went from %s to %s.", p.Title(), r.currency.Format(from), r.currency.Format(to)))
+	}
 	if _, err := fmt.Fprintln(r.Writer, strings.Join(rows, "\n")); err != nil {
 		return err
 	}
-	return tabwriter.Flush()
+	if err := tabwriter.Flush(); err != nil {
+		return err
+	}
+	return r.writeTotals()
+}
+
+// writeTotals writes the lines of the totals of each estimator added, after
+// the summary or the table, then the assumptions and the footnotes.
+func (r *Reporter) writeTotals() error {
+	for _, lines := range []func() []string{
+		r.rangeTotalLines,
+		r.scenarioTotalLines,
+		r.binPackedTotalLines,
+		r.nodeChangeLines,
+		r.carbonTotalLines,
+		r.egressTotalLines,
+		r.observabilityTotalLines,
+		r.backupTotalLines,
+	} {
+		for _, l := range lines() {
+			if _, err := fmt.Fprintln(r.Writer, l); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.writeAssumptions(); err != nil {
+		return err
+	}
+	return r.writeFootnotes()
 }
 
 func (r *Reporter) writeTable() error {
 	tabWriter := tabwriter.NewWriter(r.Writer, 8, 6, 2, ' ', 0)
-	if _, err := fmt.Fprintln(tabWriter, strings.Join(headers, "\t")); err != nil {
+	cells := r.layout()
+
+	// The total row is labeled in the first cell that isn't a cost, or
+	// in a column of its own if all of them are.
+	label := slices.IndexFunc(cells, func(c cell) bool { return !c.isCost() && !c.isPrice() })
+	newRow := func() []string {
+		row := make([]string, 0, len(cells)+1)
+		if label < 0 {
+			row = append(row, "")
+		}
+		return row
+	}
+
+	header := newRow()
+	for _, c := range cells {
+		header = append(header, c.tableHeader())
+	}
+	if _, err := fmt.Fprintln(tabWriter, strings.Join(header, "\t")); err != nil {
 		return err
 	}
-	totalCosts := make(map[string]float64)
 
-	for _, m := range r.reports {
-		row := []string{
-			m.CostModel.Cluster.Name,
-		}
+	// Total costs before and after the change, by cell.
+	totalFrom, totalTo := make([]float64, len(cells)), make([]float64, len(cells))
 
-		for _, p := range periods {
-			keys := p.Keys()
+	// The inventory is sorted for its groups to be subtotaled.
+	reports := r.reports
+	var groups *subtotals
+	if r.inventory {
+		reports = r.inventoryReports()
+		groups = newSubtotals(cells, reports)
+	}
 
-			fromCost, toCost := calculateTotalCostForPeriod(p, m.From, m.To, m.CostModel)
-			row = append(row,
-				fmt.Sprintf("$%.2f", toCost),
-				fmt.Sprintf("%s(%.1f%%)", displayCostInDollars(toCost-fromCost), percentageChange(fromCost, toCost)),
-			)
-			totalCosts[keys.From] += fromCost
-			totalCosts[keys.To] += toCost
+	for j, m := range reports {
+		if m.CostModel == nil {
+			continue
+		}
+
+		row := newRow()
+		rowFrom, rowTo := make([]float64, len(cells)), make([]float64, len(cells))
+		for i, c := range cells {
+			if c.isPrice() {
+				row = append(row, r.currency.FormatPrice(c.price(m)))
+				continue
+			}
+			if !c.isCost() {
+				row = append(row, c.text(m))
+				continue
+			}
+			rowFrom[i], rowTo[i] = c.costs(m)
+			row = append(row, r.tableCost(c, rowFrom[i], rowTo[i]))
+			totalFrom[i] += rowFrom[i]
+			totalTo[i] += rowTo[i]
 		}
 
 		if _, err := fmt.Fprintln(tabWriter, strings.Join(row, "\t")); err != nil {
 			return err
 		}
+
+		if groups == nil {
+			continue
+		}
+		groups.add(rowFrom, rowTo)
+		for _, subtotal := range groups.rows(r, j) {
+			if _, err := fmt.Fprintln(tabWriter, strings.Join(subtotal, "\t")); err != nil {
+				return err
+			}
+		}
 	}
 
 	// If there are multiple models, print a Total Costs row.
 	if len(r.reports) > 1 {
-		row := []string{"Total Cost:"}
-
-		for _, p := range periods {
-			keys := p.Keys()
-			fromCost, toCost := totalCosts[keys.From], totalCosts[keys.To]
-			row = append(row,
-				fmt.Sprintf("$%.2f", toCost),
-				fmt.Sprintf("$%.2f(%.1f%%)", toCost-fromCost, percentageChange(fromCost, toCost)),
-			)
+		row := newRow()
+		if label < 0 {
+			row[0] = "Total Cost:"
+		}
+		for i, c := range cells {
+			switch {
+			case i == label:
+				row = append(row, "Total Cost:")
+			case c.isCost():
+				row = append(row, r.tableCost(c, totalFrom[i], totalTo[i]))
+			default:
+				row = append(row, "")
+			}
 		}
 
 		if _, err := fmt.Fprintln(tabWriter, strings.Join(row, "\t")); err != nil {
@@ -220,7 +596,78 @@ func (r *Reporter) writeTable() error {
 		}
 	}
 
-	return tabWriter.Flush()
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+	return r.writeTotals()
+}
+
+// tableCost formats the value of a cost cell, with the percentage of
+// change for deltas.
+func (r *Reporter) tableCost(c cell, from, to float64) string {
+	v := r.currency.Format(c.cost(from, to))
+	if c.isCarbon() {
+		v = formatCarbon(c.cost(from, to))
+	}
+	if c.isDelta() {
+		return fmt.Sprintf("%s(%.1f%%)", v, percentageChange(from, to))
+	}
+	return v
+}
+
+// writeCSV writes one row per report with the configured columns, by
+// default the cost of each resource over the last period and the total
+// costs for each period.
+func (r *Reporter) writeCSV() error {
+	w := csv.NewWriter(r.Writer)
+	cells := r.layout()
+
+	header := make([]string, 0, len(cells))
+	for _, c := range cells {
+		header = append(header, c.csvHeader())
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+
+		row := make([]string, 0, len(cells))
+		for _, c := range cells {
+			if c.isPrice() {
+				row = append(row, strconv.FormatFloat(r.currency.Convert(c.price(m)), 'f', 6, 64))
+				continue
+			}
+			if !c.isCost() {
+				row = append(row, c.text(m))
+				continue
+			}
+			if c.isCarbon() {
+				row = append(row, formatCSVCost(c.cost(c.costs(m))))
+				continue
+			}
+			row = append(row, r.csvCost(c.cost(c.costs(m))))
+		}
+
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// csvCost converts a cost to the report currency and formats it.
+func (r *Reporter) csvCost(v float64) string {
+	return formatCSVCost(r.currency.Convert(v))
+}
+
+func formatCSVCost(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
 }
 
 func calculateTotalCostForPeriod(p Period, from Requirements, to Requirements, cm *CostModel) (float64, float64) {
@@ -235,13 +682,3 @@ func percentageChange(from, to float64) float64 {
 	}
 	return ((to - from) / from) * 100.0
 }
-
-// displayCostInDollars is a helper to print out the dollars properly if it's negative or positive.
-func displayCostInDollars(cost float64) string {
-	sign := ""
-	if cost < 0 {
-		sign, cost = "-", cost*-1
-	}
-
-	return fmt.Sprintf("%s$%.2f", sign, cost)
-}
@@ -116,6 +116,32 @@ func TestReporter_writeSummary(t *testing.T) {
 		}
 	})
 
+	t.Run("Test a table total row labels the first column that isn't a cost", func(t *testing.T) {
+		for cols, want := range map[string]string{
+			"delta,name":  "$4320.00(100.0%) Total Cost:",
+			"delta,to":    "Total Cost: $4320.00(100.0%) $8640.00",
+			"to,delta":    "Total Cost: $8640.00 $4320.00(100.0%)",
+			"cluster,to":  "Total Cost: $8640.00",
+			"to,replicas": "$8640.00 Total Cost:",
+		} {
+			columns, err := ParseColumns(cols)
+			if err != nil {
+				t.Fatalf("parsing columns: %v", err)
+			}
+			var b bytes.Buffer
+			r := New(&b, "table", WithPeriods(Monthly), WithColumns(columns...))
+			r.AddReport(baseCostModel, fromRequirements, toRequirements)
+			r.AddReport(baseCostModel, fromRequirements, toRequirements)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+			if got := strings.Join(strings.Fields(lines[len(lines)-1]), " "); got != want {
+				t.Errorf("expecting the total row of %s to be %q, got:\n%s", cols, want, b.String())
+			}
+		}
+	})
+
 	t.Run("Test a table with a single decreasing report", func(t *testing.T) {
 		var b bytes.Buffer
 		r := New(&b, "table")
@@ -242,7 +268,7 @@ func Test_calculateTotalCostForPeriod(t *testing.T) {
 
 func TestReporter_Write(t *testing.T) {
 	t.Run("no reports", func(t *testing.T) {
-		for _, rt := range []ReportType{Table, Summary, Markdown} {
+		for _, rt := range []ReportType{Table, Summary, Markdown, CSV} {
 			rt := string(rt)
 			t.Run(rt, func(t *testing.T) {
 				var s strings.Builder
@@ -258,6 +284,39 @@ func TestReporter_Write(t *testing.T) {
 	})
 }
 
+func TestReporter_writeCSV(t *testing.T) {
+	cm := &CostModel{
+		Cluster:          &Cluster{Name: "test"},
+		CPU:              Cost{NonSpot: 1},
+		RAM:              Cost{NonSpot: 1},
+		PersistentVolume: Cost{Dollars: 1},
+	}
+	from := Requirements{
+		CPUPerPod:    1000,
+		MemoryPerPod: 1024 * 1024 * 1024,
+		Replicas:     1,
+		Kind:         "Deployment",
+		Namespace:    "ns",
+		Name:         "wk",
+	}
+	to := from
+	to.Replicas = 2
+
+	var s strings.Builder
+	r := New(&s, string(CSV))
+	r.AddReport(cm, from, to)
+	r.AddReport(nil, from, to)
+	if err := r.Write(); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	want := "cluster,namespace,kind,name,replicas,monthly_cpu,monthly_memory,monthly_storage,weekly-from,weekly-to,weekly-delta,monthly-from,monthly-to,monthly-delta\n" +
+		"test,ns,Deployment,wk,2,1440.00,1440.00,0.00,336.00,672.00,336.00,1440.00,2880.00,1440.00\n"
+	if got := s.String(); got != want {
+		t.Errorf("writeCSV()\n%v\n%v", got, want)
+	}
+}
+
 func TestReporter_AddWarning_AppearsInMarkdown(t *testing.T) {
 	cm := &CostModel{
 		Cluster:          &Cluster{Name: "test"},
@@ -292,6 +351,29 @@ func TestReporter_AddWarning_AppearsInMarkdown(t *testing.T) {
 	}
 }
 
+func TestReporter_AddReport_Jobs(t *testing.T) {
+	cm := &CostModel{Cluster: &Cluster{Name: "test"}, CPU: Cost{NonSpot: 1}}
+	job := Requirements{CPUPerPod: 1000, Replicas: 1, Kind: "CronJob", Namespace: "ns", Name: "backup"}
+
+	tests := map[string]struct{ from, to Requirements }{
+		"added":   {to: job},
+		"changed": {from: job, to: job},
+		"removed": {from: job},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := New(nil, string(Summary))
+			r.AddReport(cm, tt.from, tt.to)
+			if len(r.reports) != 0 {
+				t.Errorf("expecting the CronJob not to be reported, got %+v", r.reports)
+			}
+			if want := "ns/CronJob/backup is a Job or CronJob, cost estimation impossible"; len(r.warnings) != 1 || r.warnings[0] != want {
+				t.Errorf("expecting warning %q, got %v", want, r.warnings)
+			}
+		})
+	}
+}
+
 func TestReporter_AddReportWithResolvedReplicas(t *testing.T) {
 	ctx := context.Background()
 	cm := &CostModel{
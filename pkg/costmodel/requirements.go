@@ -21,6 +21,10 @@ var ErrUnknownKind = errors.New("unknown kind")
 // CPUPerPod is in millicores; MemoryPerPod and PersistentVolumePerPod are in bytes.
 // Each PerPod field is the sum across all containers (or PVC templates) in a single pod.
 // Use TotalCPU / TotalMemory / TotalPersistentVolume to get aggregate values across replicas.
+// Containers breaks CPUPerPod and MemoryPerPod down by container.
+// Labels and Annotations are copied from the workload metadata; Team is left for
+// the caller to attribute, e.g. using the owners package. NodeSelector is the
+// node selector of the pods, used to tell the node pool they're scheduled on.
 type Requirements struct {
 	CPUPerPod              int64
 	MemoryPerPod           int64
@@ -29,12 +33,71 @@ type Requirements struct {
 	Kind                   string
 	Namespace              string
 	Name                   string
+	Labels                 map[string]string
+	Annotations            map[string]string
+	Team                   string
+	Containers             []ContainerRequirements
+	NodeSelector           map[string]string
 }
 
-// AddRequirements increments the per-pod resources by the amount specified.
+// ContainerRequirements holds the resources requested by a container of a pod,
+// and its limits, zero when unset. CPU is in millicores; Memory is in bytes.
+type ContainerRequirements struct {
+	Name        string
+	CPU         int64
+	Memory      int64
+	CPULimit    int64
+	MemoryLimit int64
+}
+
+// containerRequirements returns the requirements of a container from its resources.
+func containerRequirements(name string, reqs corev1.ResourceRequirements) ContainerRequirements {
+	return ContainerRequirements{
+		Name:        name,
+		CPU:         reqs.Requests.Cpu().MilliValue(),
+		Memory:      reqs.Requests.Memory().Value(),
+		CPULimit:    reqs.Limits.Cpu().MilliValue(),
+		MemoryLimit: reqs.Limits.Memory().Value(),
+	}
+}
+
+// ContainerPair holds the requirements of a container before and after a change,
+// zero on the side it doesn't exist.
+type ContainerPair struct {
+	Name     string
+	From, To ContainerRequirements
+}
+
+// PairContainers pairs the containers of two requirements by name, in the order
+// of the containers after the change followed by those removed by it.
+func PairContainers(from, to Requirements) []ContainerPair {
+	var pairs []ContainerPair
+	seen := make(map[string]bool)
+	for _, c := range to.Containers {
+		p := ContainerPair{Name: c.Name, To: c}
+		for _, f := range from.Containers {
+			if f.Name == c.Name {
+				p.From = f
+			}
+		}
+		seen[c.Name] = true
+		pairs = append(pairs, p)
+	}
+	for _, f := range from.Containers {
+		if !seen[f.Name] {
+			pairs = append(pairs, ContainerPair{Name: f.Name, From: f})
+		}
+	}
+	return pairs
+}
+
+// AddRequirements increments the per-pod resources by the amount specified,
+// recording them, with their limits, as an unnamed container.
 func (r *Requirements) AddRequirements(reqs corev1.ResourceRequirements) {
-	r.CPUPerPod += reqs.Requests.Cpu().MilliValue()
-	r.MemoryPerPod += reqs.Requests.Memory().Value()
+	c := containerRequirements("", reqs)
+	r.CPUPerPod += c.CPU
+	r.MemoryPerPod += c.Memory
+	r.Containers = append(r.Containers, c)
 }
 
 // TotalCPU returns aggregate CPU (millicores) across all replicas.
@@ -66,26 +129,26 @@ func ParseManifest(src []byte, costModel *CostModel) (Requirements, error) {
 	}
 
 	var (
-		containers []corev1.Container
-		replicas   = 1
+		spec     corev1.PodSpec
+		replicas = 1
 	)
 
 	switch x := obj.(type) {
 	case *appsv1.StatefulSet:
-		containers = x.Spec.Template.Spec.Containers
+		spec = x.Spec.Template.Spec
 		if x.Spec.Replicas != nil {
 			replicas = int(*x.Spec.Replicas)
 		}
 		addPersistentVolumeClaimRequirements(x.Spec.VolumeClaimTemplates, &r)
 
 	case *appsv1.Deployment:
-		containers = x.Spec.Template.Spec.Containers
+		spec = x.Spec.Template.Spec
 		if x.Spec.Replicas != nil {
 			replicas = int(*x.Spec.Replicas)
 		}
 
 	case *appsv1.DaemonSet:
-		containers = x.Spec.Template.Spec.Containers
+		spec = x.Spec.Template.Spec
 		// DaemonSets don't have a replica count, so we need to use the number of nodes in the cluster.
 		if costModel == nil {
 			return r, fmt.Errorf("%w: daemonsets require a cost model", ErrUnknownKind)
@@ -95,13 +158,13 @@ func ParseManifest(src []byte, costModel *CostModel) (Requirements, error) {
 		}
 
 	case *batchv1.Job:
-		containers = x.Spec.Template.Spec.Containers
+		spec = x.Spec.Template.Spec
 
 	case *batchv1.CronJob:
-		containers = x.Spec.JobTemplate.Spec.Template.Spec.Containers
+		spec = x.Spec.JobTemplate.Spec.Template.Spec
 
 	case *corev1.Pod:
-		containers = x.Spec.Containers
+		spec = x.Spec
 
 	default:
 		return r, fmt.Errorf("%w: %v (%T)", ErrUnknownKind, kind, x)
@@ -109,7 +172,8 @@ func ParseManifest(src []byte, costModel *CostModel) (Requirements, error) {
 
 	r.Kind = kind.Kind
 	r.Replicas = replicas
-	addContainersRequirements(containers, &r)
+	r.NodeSelector = spec.NodeSelector
+	addContainersRequirements(spec.Containers, &r)
 	err = addMetadataToRequirements(obj, &r)
 	if err != nil {
 		return r, err
@@ -124,6 +188,8 @@ func addMetadataToRequirements(obj runtime.Object, requirements *Requirements) e
 	}
 	requirements.Namespace = metadata.GetNamespace()
 	requirements.Name = metadata.GetName()
+	requirements.Labels = metadata.GetLabels()
+	requirements.Annotations = metadata.GetAnnotations()
 	return nil
 }
 
@@ -137,20 +203,32 @@ func addPersistentVolumeClaimRequirements(templates []corev1.PersistentVolumeCla
 // addContainersRequirements adds per-pod container CPU and memory to the given requirements.
 func addContainersRequirements(containers []corev1.Container, r *Requirements) {
 	for _, container := range containers {
-		resources := container.Resources
-		r.CPUPerPod += resources.Requests.Cpu().MilliValue()
-		r.MemoryPerPod += resources.Requests.Memory().Value()
+		c := containerRequirements(container.Name, container.Resources)
+		r.CPUPerPod += c.CPU
+		r.MemoryPerPod += c.Memory
+		r.Containers = append(r.Containers, c)
 	}
 }
 
-// Delta returns the field-wise difference between two resources.
+// Delta returns the field-wise difference between two resources, and
+// between each of their containers, see PairContainers.
 // A positive value signals that the resource has increased.
 // A negative value signals that the resource has decreased.
 func Delta(from, to Requirements) Requirements {
-	return Requirements{
+	d := Requirements{
 		CPUPerPod:              to.CPUPerPod - from.CPUPerPod,
 		MemoryPerPod:           to.MemoryPerPod - from.MemoryPerPod,
 		PersistentVolumePerPod: to.PersistentVolumePerPod - from.PersistentVolumePerPod,
 		Replicas:               to.Replicas - from.Replicas,
 	}
+	for _, p := range PairContainers(from, to) {
+		d.Containers = append(d.Containers, ContainerRequirements{
+			Name:        p.Name,
+			CPU:         p.To.CPU - p.From.CPU,
+			Memory:      p.To.Memory - p.From.Memory,
+			CPULimit:    p.To.CPULimit - p.From.CPULimit,
+			MemoryLimit: p.To.MemoryLimit - p.From.MemoryLimit,
+		})
+	}
+	return d
 }
@@ -2,6 +2,7 @@ package costmodel
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -40,6 +41,7 @@ func TestParseManifest(t *testing.T) {
 			Kind:         "Deployment",
 			Namespace:    "opencost",
 			Name:         "prom-label-proxy",
+			Containers:   []ContainerRequirements{{Name: "prom-label-proxy", CPU: cpu("500m"), Memory: mem("1000Mi"), CPULimit: cpu("2"), MemoryLimit: mem("4000Mi")}},
 		},
 		"Job": {
 			CPUPerPod:    cpu("50m"),
@@ -48,6 +50,7 @@ func TestParseManifest(t *testing.T) {
 			Kind:         "Job",
 			Namespace:    "hosted-grafana",
 			Name:         "hosted-grafana-source-ips-update-27973440",
+			Containers:   []ContainerRequirements{{Name: "source-ips-update", CPU: cpu("50m"), Memory: mem("200Mi"), MemoryLimit: mem("400Mi")}},
 		},
 
 		"StatefulSet": {
@@ -58,6 +61,7 @@ func TestParseManifest(t *testing.T) {
 			Kind:                   "StatefulSet",
 			Namespace:              "opencost",
 			Name:                   "opencost",
+			Containers:             []ContainerRequirements{{Name: "opencost", CPU: cpu("1"), Memory: mem("4Gi"), CPULimit: cpu("4"), MemoryLimit: mem("8Gi")}},
 		},
 
 		"DaemonSet": {
@@ -67,6 +71,7 @@ func TestParseManifest(t *testing.T) {
 			Kind:         "DaemonSet",
 			Namespace:    "conntrack-exporter",
 			Name:         "conntrack-exporter",
+			Containers:   []ContainerRequirements{{Name: "conntrack-exporter", CPU: cpu("50m"), Memory: mem("50Mi")}},
 		},
 
 		"Pod": {
@@ -76,6 +81,7 @@ func TestParseManifest(t *testing.T) {
 			Kind:         "Pod",
 			Namespace:    "default",
 			Name:         "prometheus-0",
+			Containers:   []ContainerRequirements{{Name: "prometheus", CPU: cpu("45"), Memory: mem("320Gi"), MemoryLimit: mem("360Gi")}},
 		},
 
 		// Multi-container manifests
@@ -87,6 +93,10 @@ func TestParseManifest(t *testing.T) {
 			Kind:                   "StatefulSet",
 			Namespace:              "opencost",
 			Name:                   "opencost",
+			Containers: []ContainerRequirements{
+				{Name: "opencost", CPU: cpu("1"), Memory: mem("4Gi"), CPULimit: cpu("2500m"), MemoryLimit: mem("8Gi")},
+				{Name: "opencost-ui", CPU: cpu("10m"), Memory: mem("55M"), CPULimit: cpu("2"), MemoryLimit: mem("1Gi")},
+			},
 		},
 
 		// With replicas
@@ -98,6 +108,11 @@ func TestParseManifest(t *testing.T) {
 			Kind:                   "StatefulSet",
 			Namespace:              "default",
 			Name:                   "prometheus",
+			Containers: []ContainerRequirements{
+				{Name: "prometheus", CPU: cpu("45"), Memory: mem("320Gi"), MemoryLimit: mem("360Gi")},
+				// Containers without requests are listed too.
+				{Name: "watch"},
+			},
 		},
 	}
 
@@ -112,8 +127,10 @@ func TestParseManifest(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected error parsing manifest: %v", err)
 			}
+			// Metadata is covered by its own test below.
+			got.Labels, got.Annotations = nil, nil
 
-			if exp != got {
+			if !reflect.DeepEqual(exp, got) {
 				t.Fatalf("wrong parsed values:\nexp: %#v\ngot: %#v", exp, got)
 			}
 		})
@@ -132,6 +149,7 @@ func TestParseManifest(t *testing.T) {
 		if err != nil {
 			t.Fatalf("unexpected error parsing manifest: %v", err)
 		}
+		got.Labels, got.Annotations = nil, nil
 
 		exp := Requirements{
 			CPUPerPod:              cpu("200m"),
@@ -141,13 +159,33 @@ func TestParseManifest(t *testing.T) {
 			Kind:                   "StatefulSet",
 			Namespace:              "alertmanager",
 			Name:                   "alertmanager",
+			Containers:             []ContainerRequirements{{Name: "alertmanager", CPU: cpu("200m"), Memory: mem("1Gi"), MemoryLimit: mem("15Gi")}},
 		}
 
-		if exp != got {
+		if !reflect.DeepEqual(exp, got) {
 			t.Fatalf("wrong parsed values:\nexp: %#v\ngot: %#v", exp, got)
 		}
 	})
 
+	t.Run("copies workload labels and annotations", func(t *testing.T) {
+		src, err := os.ReadFile("testdata/resource/Deployment.json")
+		if err != nil {
+			t.Fatalf("unexpected error reading manifest file: %v", err)
+		}
+
+		got, err := ParseManifest(src, &CostModel{})
+		if err != nil {
+			t.Fatalf("unexpected error parsing manifest: %v", err)
+		}
+
+		if e, g := "kube-manifests-opencost", got.Labels["kustomize.toolkit.fluxcd.io/name"]; e != g {
+			t.Errorf("expecting label %q, got %q", e, g)
+		}
+		if e, g := "2", got.Annotations["deployment.kubernetes.io/revision"]; e != g {
+			t.Errorf("expecting annotation %q, got %q", e, g)
+		}
+	})
+
 	t.Run("panics on Daemonset if costmodel is nil", func(t *testing.T) {
 		src, err := os.ReadFile("testdata/resource/DaemonSet.json")
 		if err != nil {
@@ -209,10 +247,34 @@ func TestDelta(t *testing.T) {
 				MemoryPerPod: -2,
 			},
 		},
+		"Containers are paired by name": {
+			from: Requirements{
+				CPUPerPod: 3,
+				Containers: []ContainerRequirements{
+					{Name: "app", CPU: 2, Memory: 4},
+					{Name: "removed", CPU: 1},
+				},
+			},
+			to: Requirements{
+				CPUPerPod: 4,
+				Containers: []ContainerRequirements{
+					{Name: "sidecar", CPU: 1, Memory: 1},
+					{Name: "app", CPU: 3, Memory: 4},
+				},
+			},
+			want: Requirements{
+				CPUPerPod: 1,
+				Containers: []ContainerRequirements{
+					{Name: "sidecar", CPU: 1, Memory: 1},
+					{Name: "app", CPU: 1},
+					{Name: "removed", CPU: -1},
+				},
+			},
+		},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			if got := Delta(test.from, test.to); got != test.want {
+			if got := Delta(test.from, test.to); !reflect.DeepEqual(got, test.want) {
 				t.Errorf("Delta() = %v, want %v", got, test.want)
 			}
 		})
@@ -0,0 +1,83 @@
+package costmodel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+)
+
+// DefaultRetryBackoff is the delay before the first retry when
+// ClientConfig.MaxRetries is set without a backoff.
+const DefaultRetryBackoff = 500 * time.Millisecond
+
+// retryClient is an api.Client retrying requests that failed with a
+// status code worth retrying, waiting exponentially longer between
+// attempts.
+type retryClient struct {
+	api.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// retryable reports whether a request that got the given status code
+// may succeed if sent again. 501 is left out since the Prometheus client
+// relies on it to fall back from POST to GET.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// Do implements api.Client.
+func (c *retryClient) Do(ctx context.Context, req *http.Request) (*http.Response, []byte, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.Client.Do(ctx, req)
+		if err != nil || !retryable(resp.StatusCode) || attempt >= c.maxRetries {
+			return resp, body, err
+		}
+
+		wait := backoff
+		if after := retryAfter(resp); after > wait {
+			wait = after
+		}
+		backoff *= 2
+
+		select {
+		case <-ctx.Done():
+			return resp, body, fmt.Errorf("retrying after status %d: %w", resp.StatusCode, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		// The body of the previous attempt was consumed.
+		if req, err = rewind(req); err != nil {
+			return resp, body, err
+		}
+	}
+}
+
+// rewind returns a copy of req whose body can be sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("rewinding request body: %w", err)
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of a
+// response, if given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	s, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || s < 0 {
+		return 0
+	}
+	return time.Duration(s) * time.Second
+}
@@ -0,0 +1,109 @@
+package costmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+const oneSampleVector = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[0,"4"]}]}}`
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries int
+		wantCalls  int32
+		// wantStatus is the status code of the failure, 0 if the query succeeds.
+		wantStatus int
+	}{
+		{"succeeds after server errors", []int{http.StatusServiceUnavailable, http.StatusBadGateway}, 3, 3, 0},
+		{"succeeds after rate limit", []int{http.StatusTooManyRequests}, 3, 2, 0},
+		{"gives up after max retries", []int{500, 500, 500, 500}, 2, 3, 500},
+		{"does not retry without max retries", []int{500}, 0, 1, 500},
+		{"does not retry client errors", []int{http.StatusUnauthorized}, 3, 1, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				if n <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[n-1])
+					return
+				}
+				// Retries must resend the query.
+				if err := r.ParseForm(); err != nil || r.Form.Get("query") == "" {
+					t.Errorf("expecting query to be resent, got %v (%v)", r.Form, err)
+				}
+				fmt.Fprint(w, oneSampleVector)
+			}))
+			defer svr.Close()
+
+			c, err := NewClient(&ClientConfig{Address: svr.URL, MaxRetries: tt.maxRetries, RetryBackoff: time.Millisecond})
+			if err != nil {
+				t.Fatalf("creating client: %v", err)
+			}
+
+			got, err := c.GetNodeCount(context.Background(), "test")
+			if tt.wantStatus != 0 {
+				if !errors.Is(err, ErrBadQuery) {
+					t.Errorf("expecting ErrBadQuery, got %v", err)
+				}
+				// The cause must be kept.
+				var apiErr *v1.Error
+				if !errors.As(err, &apiErr) || !strings.HasSuffix(apiErr.Msg, fmt.Sprint(tt.wantStatus)) {
+					t.Errorf("expecting the failure to be caused by status %d, got %v", tt.wantStatus, err)
+				}
+			} else if err != nil || got != 4 {
+				t.Errorf("expecting 4 nodes, got %d (%v)", got, err)
+			}
+			if g := calls.Load(); g != tt.wantCalls {
+				t.Errorf("expecting %d calls, got %d", tt.wantCalls, g)
+			}
+		})
+	}
+}
+
+func TestClient_QueryTimeout(t *testing.T) {
+	done := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer svr.Close()
+	defer close(done)
+
+	c, err := NewClient(&ClientConfig{Address: svr.URL, QueryTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	_, err = c.GetNodeCount(context.Background(), "test")
+	if !errors.Is(err, ErrBadQuery) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expecting ErrBadQuery caused by the deadline, got %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"":                              0,
+		"2":                             2 * time.Second,
+		"-1":                            0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", header)
+		if got := retryAfter(resp); got != want {
+			t.Errorf("expecting %s for Retry-After %q, got %s", want, header, got)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package costmodel
+
+import (
+	"fmt"
+)
+
+// Scenario is a view of the resources a workload's pods may consume.
+type Scenario string
+
+const (
+	// ScenarioRequests prices the requests, what the pods reserve.
+	ScenarioRequests Scenario = "requests"
+	// ScenarioLimits prices the limits, the worst-case footprint of pods
+	// bursting to them. It is unbounded, and not priced, if a container
+	// has no CPU or memory limit.
+	ScenarioLimits Scenario = "limits"
+	// ScenarioGuaranteed prices the requests raised to the limits, what the
+	// pods would reserve with the Guaranteed QoS class. Containers without
+	// a limit are given one equal to their request.
+	ScenarioGuaranteed Scenario = "guaranteed"
+)
+
+// scenarios are the scenarios reported, in order.
+var scenarios = []Scenario{ScenarioRequests, ScenarioLimits, ScenarioGuaranteed}
+
+// Title returns the name of the scenario in reports.
+func (s Scenario) Title() string {
+	switch s {
+	case ScenarioLimits:
+		return "Limits"
+	case ScenarioGuaranteed:
+		return "Guaranteed QoS"
+	default:
+		return "Requests"
+	}
+}
+
+// ForScenario returns the requirements with the per-pod CPU and memory of
+// the scenario, computed from the containers, and whether they are bounded.
+// Unbounded requirements, at the limits of a container without one, can't
+// be priced. Requirements without containers are returned as they are.
+func (r Requirements) ForScenario(s Scenario) (Requirements, bool) {
+	if s == ScenarioRequests || len(r.Containers) == 0 {
+		return r, true
+	}
+
+	bounded := true
+	out := r
+	out.CPUPerPod, out.MemoryPerPod = 0, 0
+	out.Containers = make([]ContainerRequirements, 0, len(r.Containers))
+	for _, c := range r.Containers {
+		switch s {
+		case ScenarioLimits:
+			if c.CPULimit == 0 || c.MemoryLimit == 0 {
+				bounded = false
+			}
+			c.CPU, c.Memory = c.CPULimit, c.MemoryLimit
+		case ScenarioGuaranteed:
+			// A container without a limit is given one equal to its
+			// request, and a request below the limit is raised to it.
+			c.CPU = max(c.CPU, c.CPULimit)
+			c.Memory = max(c.Memory, c.MemoryLimit)
+			c.CPULimit, c.MemoryLimit = c.CPU, c.Memory
+		}
+		out.CPUPerPod += c.CPU
+		out.MemoryPerPod += c.Memory
+		out.Containers = append(out.Containers, c)
+	}
+	return out, bounded
+}
+
+// RaisesLimitsOnly returns whether the change raises the CPU or memory
+// limit of a container without raising its request.
+func RaisesLimitsOnly(from, to Requirements) bool {
+	for _, p := range PairContainers(from, to) {
+		if p.From.Name == "" || p.To.Name == "" {
+			continue
+		}
+		if p.To.CPULimit > p.From.CPULimit && p.To.CPU <= p.From.CPU {
+			return true
+		}
+		if p.To.MemoryLimit > p.From.MemoryLimit && p.To.Memory <= p.From.Memory {
+			return true
+		}
+	}
+	return false
+}
+
+// WithScenarios reports the cost of the workloads at their limits and
+// with the Guaranteed QoS class next to the cost at their requests, and
+// warns about changes raising limits without raising requests.
+func WithScenarios() Option {
+	return func(r *Reporter) {
+		r.scenarios = true
+	}
+}
+
+// ScenarioCost is the total cost of a workload over the report period in
+// a scenario, before and after the change, in US dollars.
+type ScenarioCost struct {
+	Scenario Scenario
+	Old, New float64
+	// OldUnbounded and NewUnbounded are set when a container has no limit
+	// before or after the change, leaving the cost at the limits without
+	// a bound. Old or New is then zero.
+	OldUnbounded, NewUnbounded bool
+}
+
+// Unbounded returns whether the cost before or after the change is
+// unbounded, leaving its change unknown.
+func (c ScenarioCost) Unbounded() bool {
+	return c.OldUnbounded || c.NewUnbounded
+}
+
+// Delta returns the change in cost, zero if it is unbounded.
+func (c ScenarioCost) Delta() float64 {
+	if c.Unbounded() {
+		return 0
+	}
+	return c.New - c.Old
+}
+
+// scenarioCosts returns the cost of the report in each scenario over the
+// period.
+func scenarioCosts(m report, p Period) []ScenarioCost {
+	costs := make([]ScenarioCost, 0, len(scenarios))
+	for _, s := range scenarios {
+		from, fromBounded := m.From.ForScenario(s)
+		to, toBounded := m.To.ForScenario(s)
+		c := ScenarioCost{Scenario: s, OldUnbounded: !fromBounded, NewUnbounded: !toBounded}
+		fromCost, toCost := calculateTotalCostForPeriod(p, from, to, m.CostModel)
+		if fromBounded {
+			c.Old = fromCost
+		}
+		if toBounded {
+			c.New = toCost
+		}
+		costs = append(costs, c)
+	}
+	return costs
+}
+
+// limitWarnings returns a warning per workload whose change raises limits
+// without raising requests, when scenarios are reported.
+func (r *Reporter) limitWarnings() []string {
+	if !r.scenarios {
+		return nil
+	}
+	var warnings []string
+	for _, m := range r.reports {
+		if m.CostModel == nil || m.From.Kind == "" || m.To.Kind == "" || !RaisesLimitsOnly(m.From, m.To) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s/%s/%s on %s raises limits without raising requests",
+			m.To.Namespace, m.To.Kind, m.To.Name, m.CostModel.Cluster.Name))
+	}
+	return warnings
+}
+
+// scenarioTotals returns the total cost over the main period in each
+// scenario, or nil if scenarios aren't reported.
+func (r *Reporter) scenarioTotals() []ScenarioCost {
+	if !r.scenarios {
+		return nil
+	}
+
+	totals := make([]ScenarioCost, len(scenarios))
+	for i, s := range scenarios {
+		totals[i].Scenario = s
+	}
+	for _, m := range r.reports {
+		if m.CostModel == nil {
+			continue
+		}
+		for i, c := range scenarioCosts(m, r.mainPeriod()) {
+			totals[i].Old += c.Old
+			totals[i].New += c.New
+			totals[i].OldUnbounded = totals[i].OldUnbounded || c.OldUnbounded
+			totals[i].NewUnbounded = totals[i].NewUnbounded || c.NewUnbounded
+		}
+	}
+	return totals
+}
+
+// scenarioTotalLines returns the lines of the total cost over the main
+// period in each scenario but requests, and the limit warnings.
+func (r *Reporter) scenarioTotalLines() []string {
+	var lines []string
+	for _, t := range r.scenarioTotals() {
+		if t.Scenario == ScenarioRequests {
+			continue
+		}
+		note := ""
+		if t.Unbounded() {
+			note = " as some containers have no limit"
+		}
+		lines = append(lines, fmt.Sprintf("Total %s Cost at %s went from %s to %s%s.",
+			r.mainPeriod().Title(), t.Scenario.Title(), r.formatBound(t.Old, t.OldUnbounded), r.formatBound(t.New, t.NewUnbounded), note))
+	}
+	for _, w := range r.limitWarnings() {
+		lines = append(lines, w+".")
+	}
+	return lines
+}
+
+// formatBound formats a cost in a scenario, or "unbounded".
+func (r *Reporter) formatBound(usd float64, unbounded bool) string {
+	if unbounded {
+		return "unbounded"
+	}
+	return r.currency.Format(usd)
+}
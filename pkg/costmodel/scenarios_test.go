@@ -0,0 +1,169 @@
+package costmodel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRequirements_ForScenario(t *testing.T) {
+	req := Requirements{
+		CPUPerPod:    1500,
+		MemoryPerPod: 3,
+		Containers: []ContainerRequirements{
+			{Name: "app", CPU: 1000, Memory: 2, CPULimit: 4000, MemoryLimit: 8},
+			{Name: "sidecar", CPU: 500, Memory: 1, MemoryLimit: 2},
+		},
+	}
+
+	limited := Requirements{
+		CPUPerPod:    1500,
+		MemoryPerPod: 3,
+		Containers: []ContainerRequirements{
+			{Name: "app", CPU: 1000, Memory: 2, CPULimit: 4000, MemoryLimit: 8},
+			{Name: "sidecar", CPU: 500, Memory: 1, CPULimit: 500, MemoryLimit: 2},
+		},
+	}
+
+	tests := []struct {
+		req         Requirements
+		scenario    Scenario
+		cpu, memory int64
+		bounded     bool
+	}{
+		{req, ScenarioRequests, 1500, 3, true},
+		// The sidecar has no CPU limit: it may burst to the whole node.
+		{req, ScenarioLimits, 4000, 10, false},
+		// The sidecar is given a CPU limit equal to its request.
+		{req, ScenarioGuaranteed, 4500, 10, true},
+		{limited, ScenarioLimits, 4500, 10, true},
+		{limited, ScenarioGuaranteed, 4500, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scenario), func(t *testing.T) {
+			got, bounded := tt.req.ForScenario(tt.scenario)
+			if got.CPUPerPod != tt.cpu || got.MemoryPerPod != tt.memory || bounded != tt.bounded {
+				t.Errorf("expecting %d CPU, %d memory, bounded %v, got %d, %d, %v", tt.cpu, tt.memory, tt.bounded, got.CPUPerPod, got.MemoryPerPod, bounded)
+			}
+		})
+	}
+
+	if req.Containers[0].CPU != 1000 {
+		t.Errorf("expecting the requirements not to be modified, got %+v", req.Containers[0])
+	}
+}
+
+func TestRaisesLimitsOnly(t *testing.T) {
+	from := Requirements{Containers: []ContainerRequirements{{Name: "app", CPU: 1000, CPULimit: 2000, MemoryLimit: 4}}}
+
+	tests := []struct {
+		name string
+		to   ContainerRequirements
+		want bool
+	}{
+		{"unchanged", ContainerRequirements{Name: "app", CPU: 1000, CPULimit: 2000, MemoryLimit: 4}, false},
+		{"cpu limit only", ContainerRequirements{Name: "app", CPU: 1000, CPULimit: 4000, MemoryLimit: 4}, true},
+		{"memory limit only", ContainerRequirements{Name: "app", CPU: 1000, CPULimit: 2000, MemoryLimit: 8}, true},
+		{"limit and request", ContainerRequirements{Name: "app", CPU: 2000, CPULimit: 4000, MemoryLimit: 4}, false},
+		{"new container", ContainerRequirements{Name: "sidecar", CPULimit: 4000}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to := Requirements{Containers: []ContainerRequirements{tt.to}}
+			if got := RaisesLimitsOnly(from, to); got != tt.want {
+				t.Errorf("expecting %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReporter_Scenarios(t *testing.T) {
+	cm := &CostModel{
+		Cluster: &Cluster{Name: "prod"},
+		CPU:     Cost{NonSpot: 1},
+	}
+	from := Requirements{
+		CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "wk",
+		Containers: []ContainerRequirements{{Name: "app", CPU: 1000, CPULimit: 2000, MemoryLimit: gib}},
+	}
+	to := from
+	to.Containers = []ContainerRequirements{{Name: "app", CPU: 1000, CPULimit: 4000, MemoryLimit: gib}}
+	unbounded := Requirements{
+		CPUPerPod: 1000, Replicas: 1, Kind: "Deployment", Namespace: "ns", Name: "nolimit",
+		Containers: []ContainerRequirements{{Name: "app", CPU: 1000}},
+	}
+
+	tests := []struct {
+		reportType ReportType
+		want       []string
+	}{
+		{Summary, []string{
+			"Total Monthly Cost at Limits went from unbounded to unbounded as some containers have no limit.\n",
+			"Total Monthly Cost at Guaranteed QoS went from $2160.00 to $3600.00.\n",
+			"ns/Deployment/wk on prod raises limits without raising requests.\n",
+		}},
+		{Table, []string{"Total Monthly Cost at Guaranteed QoS went from $2160.00 to $3600.00.\n"}},
+		{Markdown, []string{
+			"| Requests | $1440.00 | $1440.00 | $0.00 |\n",
+			"| Limits<sup>*</sup> | unbounded | unbounded | N/A |\n",
+			"| Guaranteed QoS | $2160.00 | $3600.00 | $1440.00 |\n",
+			"Unbounded, some containers have no limit.",
+			"ns/Deployment/wk on prod raises limits without raising requests.",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reportType), func(t *testing.T) {
+			var s strings.Builder
+			r := New(&s, string(tt.reportType), WithScenarios())
+			r.AddReport(cm, from, to)
+			r.AddReport(cm, unbounded, unbounded)
+			if err := r.Write(); err != nil {
+				t.Fatalf("unexpected: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(s.String(), want) {
+					t.Errorf("expecting report to contain %q, got:\n%s", want, s.String())
+				}
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(JSON), WithScenarios())
+		r.AddReport(cm, from, to)
+		r.AddReport(cm, unbounded, unbounded)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		var got jsonReport
+		if err := json.Unmarshal([]byte(s.String()), &got); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", s.String(), err)
+		}
+		sc := got.Workloads[0].Scenarios[ScenarioLimits]
+		if sc.From == nil || sc.To == nil || sc.Delta == nil || !feq(*sc.From, 1440) || !feq(*sc.To, 2880) || !feq(*sc.Delta, 1440) || sc.Unbounded {
+			t.Errorf("unexpected limits scenario %+v", sc)
+		}
+		if sc := got.Workloads[1].Scenarios[ScenarioLimits]; sc.From != nil || sc.To != nil || sc.Delta != nil || !sc.Unbounded {
+			t.Errorf("expecting the limits of nolimit to be unbounded, got %+v", sc)
+		}
+		if sc := got.Workloads[1].Scenarios[ScenarioGuaranteed]; sc.To == nil || !feq(*sc.To, 720) {
+			t.Errorf("expecting nolimit to be priced at its requests with the Guaranteed QoS, got %+v", sc)
+		}
+		if len(got.Warnings) != 1 {
+			t.Errorf("expecting the limits warning, got %v", got.Warnings)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var s strings.Builder
+		r := New(&s, string(Summary))
+		r.AddReport(cm, from, to)
+		if err := r.Write(); err != nil {
+			t.Fatalf("unexpected: %v", err)
+		}
+		if strings.Contains(s.String(), "Limits") || strings.Contains(s.String(), "raises limits") {
+			t.Errorf("expecting no scenarios, got:\n%s", s.String())
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package costmodel
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultVeleroTTL is how long Velero keeps the backups of a schedule not
+// setting a ttl.
+const defaultVeleroTTL = 30 * 24 * time.Hour
+
+// veleroSchedule is the part of a Velero Schedule telling which volumes
+// are snapshotted, how often and for how long.
+type veleroSchedule struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		// Schedule is a cron expression, or @every and a duration.
+		Schedule string `json:"schedule"`
+		Template struct {
+			IncludedNamespaces []string `json:"includedNamespaces"`
+			LabelSelector      *struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"labelSelector"`
+			SnapshotVolumes *bool  `json:"snapshotVolumes"`
+			TTL             string `json:"ttl"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// policies returns the backup policies of a schedule, one per included
+// namespace, or none if it doesn't snapshot volumes. The retention is the
+// backups made over the ttl. Only the matchLabels of the label selector
+// are matched.
+func (s veleroSchedule) policies() ([]BackupPolicy, error) {
+	t := s.Spec.Template
+	if t.SnapshotVolumes != nil && !*t.SnapshotVolumes {
+		return nil, nil
+	}
+
+	interval, err := scheduleInterval(s.Spec.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: velero schedule %s: %w", ErrInvalidBackupPolicy, s.Metadata.Name, err)
+	}
+	ttl := defaultVeleroTTL
+	if t.TTL != "" {
+		if ttl, err = time.ParseDuration(t.TTL); err != nil {
+			return nil, fmt.Errorf("%w: velero schedule %s: ttl: %w", ErrInvalidBackupPolicy, s.Metadata.Name, err)
+		}
+	}
+
+	p := BackupPolicy{
+		Name:      "velero/" + s.Metadata.Name,
+		Retention: max(1, int(math.Round(float64(ttl)/float64(interval)))),
+	}
+	if t.LabelSelector != nil {
+		p.Labels = t.LabelSelector.MatchLabels
+	}
+	if len(t.IncludedNamespaces) == 0 || slices.Contains(t.IncludedNamespaces, "*") {
+		return []BackupPolicy{p}, nil
+	}
+
+	var policies []BackupPolicy
+	for _, ns := range t.IncludedNamespaces {
+		p.Namespace = ns
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// cronFields are the fields of a cron expression, with their range and
+// the names of their values.
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string
+}{
+	{name: "minute", max: 59},
+	{name: "hour", max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", max: 6, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// scheduleInterval returns the average interval between the runs of a
+// cron schedule, such as 0 1 * * * or @daily, or @every and a duration.
+func scheduleInterval(schedule string) (time.Duration, error) {
+	switch s := strings.TrimSpace(schedule); {
+	case strings.HasPrefix(s, "@every "):
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(s, "@every ")))
+		if err == nil && d <= 0 {
+			err = fmt.Errorf("interval must be positive, got %s", d)
+		}
+		return d, err
+	case s == "@yearly" || s == "@annually":
+		return time.Duration(Yearly) * time.Hour, nil
+	case s == "@monthly":
+		return time.Duration(Monthly) * time.Hour, nil
+	case s == "@weekly":
+		return time.Duration(Weekly) * time.Hour, nil
+	case s == "@daily" || s == "@midnight":
+		return time.Duration(Daily) * time.Hour, nil
+	case s == "@hourly":
+		return time.Duration(Hourly) * time.Hour, nil
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return 0, fmt.Errorf("schedule %q must have %d fields", schedule, len(cronFields))
+	}
+	counts := make([]float64, len(fields))
+	for i, f := range fields {
+		n, err := cronCount(f, i)
+		if err != nil {
+			return 0, fmt.Errorf("schedule %q: %s: %w", schedule, cronFields[i].name, err)
+		}
+		counts[i] = float64(n)
+	}
+
+	// A schedule restricting both days of the month and of the week runs
+	// on either, like cron.
+	minutes, hours, days, months, weekdays := counts[0], counts[1], counts[2], counts[3], counts[4]
+	daysPerYear := 365 * months / 12
+	restricted := func(f string) bool { return f != "*" && f != "?" }
+	switch dom, dow := restricted(fields[2]), restricted(fields[4]); {
+	case dom && dow:
+		daysPerYear = (days*12 + weekdays*365/7) * months / 12
+	case dom:
+		daysPerYear = days * months
+	case dow:
+		daysPerYear = weekdays * 365 / 7 * months / 12
+	}
+	return time.Duration(float64(Yearly) * float64(time.Hour) / (minutes * hours * daysPerYear)), nil
+}
+
+// cronCount returns the number of values of a field of a cron expression,
+// e.g. 2 for 1,15 or 12 for */5 minutes.
+func cronCount(field string, i int) (int, error) {
+	f := cronFields[i]
+	value := func(s string) (int, error) {
+		if n := slices.Index(f.names, strings.ToLower(s)); n >= 0 {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < f.min || n > f.max {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		return n, nil
+	}
+
+	var count int
+	for _, item := range strings.Split(field, ",") {
+		rng, step, hasStep := strings.Cut(item, "/")
+		every := 1
+		if hasStep {
+			var err error
+			if every, err = strconv.Atoi(step); err != nil || every < 1 {
+				return 0, fmt.Errorf("invalid step %q", step)
+			}
+		}
+
+		low, high := f.min, f.max
+		switch from, to, isRange := strings.Cut(rng, "-"); {
+		case rng == "*" || rng == "?":
+		case isRange:
+			var err error
+			if low, err = value(from); err != nil {
+				return 0, err
+			}
+			if high, err = value(to); err != nil {
+				return 0, err
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := value(rng)
+			if err != nil {
+				return 0, err
+			}
+			low = n
+			if !hasStep {
+				high = n
+			}
+		}
+		count += (high-low)/every + 1
+	}
+	return count, nil
+}
@@ -0,0 +1,36 @@
+package costmodel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleInterval(t *testing.T) {
+	tests := map[string]time.Duration{
+		"@every 6h":       6 * time.Hour,
+		"@daily":          24 * time.Hour,
+		"0 1 * * *":       24 * time.Hour,
+		"0 */6 * * *":     6 * time.Hour,
+		"0,30 * * * *":    30 * time.Minute,
+		"0 2 * * 0":       7 * 24 * time.Hour,
+		"0 2 * * MON-FRI": 33*time.Hour + 36*time.Minute,
+		"0 0 1 * *":       730 * time.Hour,
+		"0 0 1 JAN,JUL *": 4380 * time.Hour,
+	}
+	for schedule, want := range tests {
+		got, err := scheduleInterval(schedule)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", schedule, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("expecting %s between the runs of %q, got %s", want, schedule, got)
+		}
+	}
+
+	for _, schedule := range []string{"daily", "@every -1h", "0 25 * * *", "* * * *", "0 5-1 * * *", "*/0 * * * *"} {
+		if _, err := scheduleInterval(schedule); err == nil {
+			t.Errorf("expecting an error for %q", schedule)
+		}
+	}
+}
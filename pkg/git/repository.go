@@ -6,8 +6,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -49,6 +51,28 @@ func (r Repository) GetCommit(ctx context.Context, ref string) (string, error) {
 	return strings.TrimSpace(string(head)), nil
 }
 
+// CommitTime returns the time the given ref was committed at.
+func (r Repository) CommitTime(ctx context.Context, ref string) (time.Time, error) {
+	out, err := r.git(ctx, "show", "-s", "--format=%cI", ref)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+}
+
+// FirstParentCommits returns up to n commits reachable from ref following
+// only first parents, newest first. On a branch where pull requests are
+// merged or squashed, each of them is a merged pull request.
+func (r Repository) FirstParentCommits(ctx context.Context, ref string, n int) ([]string, error) {
+	out, err := r.git(ctx, "rev-list", "--first-parent", fmt.Sprintf("--max-count=%d", n), ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return toLines(out), nil
+}
+
 func (r Repository) ChangedFiles(ctx context.Context, oldCommit string, newCommit string) (ChangedFiles, error) {
 	cf := ChangedFiles{
 		Renamed: make(map[string]string),
@@ -83,6 +107,51 @@ func (r Repository) Contents(ctx context.Context, head, path string) ([]byte, er
 	return r.git(ctx, "cat-file", "blob", head+":"+path)
 }
 
+// ListFiles returns the paths of all files under path at the given ref,
+// relative to the top-level directory of the repository.
+func (r Repository) ListFiles(ctx context.Context, ref, path string) ([]string, error) {
+	out, err := r.git(ctx, "ls-tree", "-r", "--name-only", "--full-tree", ref, "--", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return toLines(out), nil
+}
+
+// Prefix returns the path of the working directory relative to the
+// top-level directory of the repository. It is empty when the working
+// directory is the top-level directory.
+func (r Repository) Prefix(ctx context.Context) (string, error) {
+	out, err := r.git(ctx, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Worktree checks out ref in a new temporary worktree and returns its
+// path. The returned function removes the worktree and must be called
+// once the caller is done with it.
+func (r Repository) Worktree(ctx context.Context, ref string) (string, func() error, error) {
+	dir, err := os.MkdirTemp("", "kost-worktree-")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating worktree directory: %w", err)
+	}
+
+	if _, err := r.git(ctx, "worktree", "add", "--detach", dir, ref); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	remove := func() error {
+		_, err := r.git(context.Background(), "worktree", "remove", "--force", dir)
+		return err
+	}
+
+	return dir, remove, nil
+}
+
 func toLines(b []byte) []string {
 	var lines []string
 
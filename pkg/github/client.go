@@ -74,6 +74,16 @@ func (c Client) Comment(ctx context.Context, org, repo string, nr int, comment s
 	return err
 }
 
+// RequestReviews requests a review of the pull request from the given
+// user logins and team slugs.
+func (c Client) RequestReviews(ctx context.Context, org, repo string, nr int, users, teams []string) error {
+	_, _, err := c.c.PullRequests.RequestReviewers(ctx, org, repo, nr, github.ReviewersRequest{
+		Reviewers:     users,
+		TeamReviewers: teams,
+	})
+	return err
+}
+
 func (c Client) HideCommentsWithPrefix(ctx context.Context, org, repo string, nr int, prefix string) error {
 	opts := &github.IssueListCommentsOptions{
 		ListOptions: github.ListOptions{
@@ -0,0 +1,93 @@
+package helm
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+// Options configures how a chart is templated.
+type Options struct {
+	// ReleaseName is the name given to the release, available to
+	// templates as .Release.Name.
+	ReleaseName string
+	// Namespace is the namespace the release is installed to,
+	// available to templates as .Release.Namespace.
+	Namespace string
+	// ValuesFiles are merged in order, with later files taking
+	// precedence, on top of the chart default values.
+	ValuesFiles []string
+}
+
+// Template renders the chart found at the given path, either a directory
+// or a packaged archive, the same way `helm template` does and returns the
+// resulting multi-document YAML stream. Rendering is done in-process
+// without access to a cluster, so lookups return empty results.
+func Template(chartPath string, opts Options) ([]byte, error) {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart %s: %w", chartPath, err)
+	}
+
+	vals := map[string]interface{}{}
+	for _, f := range opts.ValuesFiles {
+		v, err := chartutil.ReadValuesFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading values file %s: %w", f, err)
+		}
+		vals = chartutil.CoalesceTables(v.AsMap(), vals)
+	}
+
+	if err := chartutil.ProcessDependenciesWithMerge(chrt, vals); err != nil {
+		return nil, fmt.Errorf("processing chart dependencies: %w", err)
+	}
+
+	releaseName := opts.ReleaseName
+	if releaseName == "" {
+		releaseName = chrt.Name()
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	renderValues, err := chartutil.ToRenderValues(chrt, vals, chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("computing values for chart %s: %w", chartPath, err)
+	}
+
+	files, err := engine.Render(chrt, renderValues)
+	if err != nil {
+		return nil, fmt.Errorf("rendering chart %s: %w", chartPath, err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name, content := range files {
+		// Partials and NOTES.txt aren't manifests.
+		if strings.HasPrefix(path.Base(name), "_") || strings.HasSuffix(name, "NOTES.txt") {
+			continue
+		}
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", name, files[name])
+	}
+
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,104 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for p, c := range files {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(c), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", p, err)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"chart/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"chart/values.yaml": "replicas: 1\ncpu: 100m\n",
+		"chart/templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+  namespace: {{ .Release.Namespace }}
+spec:
+  replicas: {{ .Values.replicas }}
+  template:
+    spec:
+      containers:
+      - name: app
+        resources:
+          requests:
+            cpu: {{ .Values.cpu }}
+`,
+		"chart/templates/_helpers.tpl": `{{- define "app.name" -}}app{{- end -}}`,
+		"chart/templates/NOTES.txt":    "Thanks for installing {{ .Release.Name }}",
+		"replicas.yaml":                "replicas: 2\ncpu: 200m\n",
+		"cpu.yaml":                     "cpu: 250m\n",
+	})
+
+	tests := map[string]struct {
+		values []string
+		exp    []string
+		notExp []string
+	}{
+		"default values": {
+			exp: []string{"name: release", "namespace: ns", "replicas: 1", "cpu: 100m"},
+		},
+		"later values files take precedence": {
+			values: []string{filepath.Join(dir, "replicas.yaml"), filepath.Join(dir, "cpu.yaml")},
+			exp:    []string{"replicas: 2", "cpu: 250m"},
+			notExp: []string{"cpu: 200m"},
+		},
+		"earlier values files are overridden": {
+			values: []string{filepath.Join(dir, "cpu.yaml"), filepath.Join(dir, "replicas.yaml")},
+			exp:    []string{"replicas: 2", "cpu: 200m"},
+			notExp: []string{"cpu: 250m"},
+		},
+	}
+
+	for n, tt := range tests {
+		t.Run(n, func(t *testing.T) {
+			out, err := Template(filepath.Join(dir, "chart"), Options{
+				ReleaseName: "release",
+				Namespace:   "ns",
+				ValuesFiles: tt.values,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error templating chart: %v", err)
+			}
+
+			for _, exp := range tt.exp {
+				if !strings.Contains(string(out), exp) {
+					t.Errorf("expecting rendered chart to contain %q, got:\n%s", exp, out)
+				}
+			}
+			for _, exp := range tt.notExp {
+				if strings.Contains(string(out), exp) {
+					t.Errorf("expecting rendered chart not to contain %q, got:\n%s", exp, out)
+				}
+			}
+
+			if strings.Contains(string(out), "Thanks for installing") {
+				t.Errorf("expecting NOTES.txt to be skipped, got:\n%s", out)
+			}
+		})
+	}
+
+	t.Run("missing values file", func(t *testing.T) {
+		_, err := Template(filepath.Join(dir, "chart"), Options{ValuesFiles: []string{filepath.Join(dir, "missing.yaml")}})
+		if err == nil {
+			t.Fatalf("expecting an error with a missing values file")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package kustomize
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/grafana/kost/pkg/git"
+)
+
+// Build renders the kustomization found in the given directory and
+// returns the resulting multi-document YAML stream.
+func Build(path string) ([]byte, error) {
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	resources, err := k.Run(filesys.MakeFsOnDisk(), path)
+	if err != nil {
+		return nil, fmt.Errorf("building kustomization %s: %w", path, err)
+	}
+
+	out, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("rendering kustomization %s: %w", path, err)
+	}
+
+	return out, nil
+}
+
+// BuildAtRef renders the kustomization found in the given directory as
+// it was at the given git ref. The directory must be inside a git
+// repository; it is checked out in a temporary worktree so that bases
+// referenced by relative paths resolve at the same ref.
+func BuildAtRef(ctx context.Context, path, ref string) ([]byte, error) {
+	repo := git.NewRepository(path)
+
+	prefix, err := repo.Prefix(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("finding %s in repository: %w", path, err)
+	}
+
+	wt, remove, err := repo.Worktree(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("checking out %s: %w", ref, err)
+	}
+	defer func() { _ = remove() }()
+
+	return Build(filepath.Join(wt, prefix))
+}
+
+// ClusterFromPath returns the cluster an overlay targets, which by
+// convention is the name of the overlay directory, e.g.
+// overlays/prod-us-central-0 targets prod-us-central-0.
+func ClusterFromPath(path string) string {
+	return filepath.Base(filepath.Clean(path))
+}
@@ -0,0 +1,118 @@
+package kustomize
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"base/kustomization.yaml": "resources:\n- deployment.yaml\n",
+		"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app
+`,
+		"overlays/prod-us-central-0/kustomization.yaml": `namespace: prod
+resources:
+- ../../base
+replicas:
+- name: app
+  count: 3
+`,
+	}
+	for p, c := range files {
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(c), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", p, err)
+		}
+	}
+
+	out, err := Build(filepath.Join(dir, "overlays/prod-us-central-0"))
+	if err != nil {
+		t.Fatalf("unexpected error building overlay: %v", err)
+	}
+
+	for _, exp := range []string{"namespace: prod", "replicas: 3"} {
+		if !strings.Contains(string(out), exp) {
+			t.Errorf("expecting rendered overlay to contain %q, got:\n%s", exp, out)
+		}
+	}
+
+	if _, err := Build(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expecting an error building a missing overlay")
+	}
+}
+
+func TestBuildAtRef(t *testing.T) {
+	dir := t.TempDir()
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("running git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(p, c string) {
+		t.Helper()
+		p = filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("creating directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(c), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", p, err)
+		}
+	}
+	configMap := func(v string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\ndata:\n  value: " + v + "\n"
+	}
+
+	git("init", "-q")
+	write("overlays/dev/kustomization.yaml", "resources:\n- cm.yaml\n")
+	write("overlays/dev/cm.yaml", configMap("old"))
+	git("add", "-A")
+	git("commit", "-q", "-m", "old")
+	write("overlays/dev/cm.yaml", configMap("new"))
+	git("commit", "-q", "-am", "new")
+
+	for ref, exp := range map[string]string{"HEAD^": "value: old", "HEAD": "value: new"} {
+		out, err := BuildAtRef(context.Background(), filepath.Join(dir, "overlays/dev"), ref)
+		if err != nil {
+			t.Fatalf("unexpected error building overlay at %s: %v", ref, err)
+		}
+		if !strings.Contains(string(out), exp) {
+			t.Errorf("expecting overlay at %s to contain %q, got:\n%s", ref, exp, out)
+		}
+	}
+}
+
+func TestClusterFromPath(t *testing.T) {
+	tests := map[string]string{
+		"overlays/prod-us-central-0":               "prod-us-central-0",
+		"overlays/prod-us-central-0/":              "prod-us-central-0",
+		"/repo/apps/foo/dev-us-east-0/../ops-eu-0": "ops-eu-0",
+	}
+
+	for p, exp := range tests {
+		if got := ClusterFromPath(p); exp != got {
+			t.Errorf("expecting cluster %s for path %s, got %s", exp, p, got)
+		}
+	}
+}
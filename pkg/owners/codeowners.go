@@ -0,0 +1,112 @@
+package owners
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// CodeOwners holds the rules of a GitHub CODEOWNERS file.
+type CodeOwners []codeOwnersRule
+
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// ParseCodeOwners parses a CODEOWNERS file. See
+// https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners
+// for the syntax.
+func ParseCodeOwners(r io.Reader) (CodeOwners, error) {
+	var co CodeOwners
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		re, err := patternToRegexp(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing CODEOWNERS line %d: %w", n, err)
+		}
+
+		co = append(co, codeOwnersRule{pattern: re, owners: fields[1:]})
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading CODEOWNERS: %w", err)
+	}
+
+	return co, nil
+}
+
+// Owners returns the owners of the given path, relative to the root of
+// the repository. As in GitHub, the last matching rule takes precedence.
+func (co CodeOwners) Owners(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	for i := len(co) - 1; i >= 0; i-- {
+		if co[i].pattern.MatchString(path) {
+			return co[i].owners
+		}
+	}
+	return nil
+}
+
+// patternToRegexp converts a gitignore-style CODEOWNERS pattern into a
+// regular expression matching paths relative to the repository root.
+func patternToRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("(^|/)")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+				// `**/` also matches no directory at all.
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					b.WriteString("/?")
+					i++
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	switch {
+	case dir || pattern == "*":
+		b.WriteString("(/|$)")
+	case strings.HasSuffix(pattern, "/*"):
+		// docs/* matches the files in docs but not in its subdirectories.
+		b.WriteString("$")
+	default:
+		// A pattern matches both a file and everything inside a
+		// directory with that name.
+		b.WriteString("(/.*)?$")
+	}
+
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,124 @@
+package owners
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/grafana/kost/pkg/costmodel"
+)
+
+// DefaultKey is the label or annotation read when no key is configured.
+const DefaultKey = "team"
+
+// Resolver attributes workloads to the team owning them.
+type Resolver struct {
+	// Keys are the labels, then annotations, looked up on the
+	// workload metadata. The first one set wins.
+	Keys []string
+
+	// CodeOwners are matched against the path of the manifest file.
+	CodeOwners CodeOwners
+
+	// Namespaces maps a namespace to the team owning it.
+	Namespaces map[string]string
+}
+
+// Team returns the team owning the workload described by req, parsed from
+// the manifest at path. The sources are checked in order of precedence:
+// the workload labels and annotations, the CODEOWNERS rules and the
+// namespace mapping. It returns an empty string if no owner is found.
+func (r Resolver) Team(path string, req costmodel.Requirements) string {
+	for _, k := range r.Keys {
+		if t := req.Labels[k]; t != "" {
+			return t
+		}
+	}
+	for _, k := range r.Keys {
+		if t := req.Annotations[k]; t != "" {
+			return t
+		}
+	}
+
+	if path != "" {
+		// With multiple owners, the first one is considered the
+		// main owner.
+		if co := r.CodeOwners.Owners(path); len(co) > 0 {
+			return co[0]
+		}
+	}
+
+	return r.Namespaces[req.Namespace]
+}
+
+// LoadNamespaces reads a YAML or JSON file mapping namespaces to teams, e.g.
+//
+//	hosted-grafana: hosted-grafana-team
+//	mimir: mimir-squad
+func LoadNamespaces(path string) (map[string]string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]string
+	if err := yaml.Unmarshal(src, &m); err != nil {
+		return nil, fmt.Errorf("parsing namespace mapping %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// IsEmail returns whether the owner is an email address, as CODEOWNERS
+// allows: "alice@example.com".
+func IsEmail(owner string) bool {
+	return !strings.HasPrefix(owner, "@") && strings.Contains(owner, "@")
+}
+
+// IsUser returns whether the owner is a GitHub user rather than a team:
+// "@alice" is a user, while "@grafana/mimir", "grafana/mimir" and "mimir"
+// are teams.
+func IsUser(owner string) bool {
+	return strings.HasPrefix(owner, "@") && !strings.Contains(owner, "/")
+}
+
+// Reviewers splits owners into the logins of the users and the slugs of
+// the teams to request reviews from. Email owners are left out since
+// reviews can't be requested from them.
+func Reviewers(owners []string) (users, teams []string) {
+	for _, o := range owners {
+		switch {
+		case IsEmail(o):
+		case IsUser(o):
+			users = append(users, strings.TrimPrefix(o, "@"))
+		default:
+			teams = append(teams, Slug(o))
+		}
+	}
+	return users, teams
+}
+
+// Slug returns the GitHub team slug of a team, as used when requesting
+// reviews: "@grafana/platform-monitoring" becomes "platform-monitoring".
+func Slug(team string) string {
+	team = strings.TrimPrefix(team, "@")
+	if _, slug, ok := strings.Cut(team, "/"); ok {
+		return slug
+	}
+	return team
+}
+
+// Mention returns the GitHub mention of an owner, qualifying teams with the
+// given organization: "platform-monitoring" becomes
+// "@grafana/platform-monitoring". Users and emails are mentioned as is.
+func Mention(org, owner string) string {
+	if strings.HasPrefix(owner, "@") || IsEmail(owner) {
+		return owner
+	}
+	if strings.Contains(owner, "/") {
+		return "@" + owner
+	}
+	return "@" + org + "/" + owner
+}
@@ -0,0 +1,147 @@
+package owners
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grafana/kost/pkg/costmodel"
+)
+
+const codeOwners = `# Default owners
+*                          @grafana/platform
+*.md                       @grafana/docs # trailing comment
+/flux/*/mimir/             @grafana/mimir-squad
+flux/prod-us-central-0/loki/ @grafana/loki-squad @grafana/platform
+/docs/*                    @grafana/docs-root
+**/logs                    @grafana/logs
+`
+
+func TestCodeOwners(t *testing.T) {
+	co, err := ParseCodeOwners(strings.NewReader(codeOwners))
+	if err != nil {
+		t.Fatalf("unexpected error parsing CODEOWNERS: %v", err)
+	}
+
+	tests := map[string][]string{
+		"flux/dev-us-central-0/default/Deployment-foo.yaml":     {"@grafana/platform"},
+		"flux/dev-us-central-0/mimir/StatefulSet-ingester.yaml": {"@grafana/mimir-squad"},
+		"flux/prod-us-central-0/loki/StatefulSet-ingester.yaml": {"@grafana/loki-squad", "@grafana/platform"},
+		"flux/prod-us-central-0/default/README.md":              {"@grafana/docs"},
+		"flux/prod-us-central-0/mimir/README.md":                {"@grafana/mimir-squad"},
+		"docs/index.yaml":                                       {"@grafana/docs-root"},
+		"docs/nested/index.yaml":                                {"@grafana/platform"},
+		"flux/ops-eu-0/logs/Deployment-promtail.yaml":           {"@grafana/logs"},
+	}
+
+	for path, exp := range tests {
+		if got := co.Owners(path); !reflect.DeepEqual(exp, got) {
+			t.Errorf("expecting owners %v for %s, got %v", exp, path, got)
+		}
+	}
+}
+
+func TestResolver_Team(t *testing.T) {
+	co, err := ParseCodeOwners(strings.NewReader("/flux/*/mimir/ @grafana/mimir-squad\n"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing CODEOWNERS: %v", err)
+	}
+
+	r := Resolver{
+		Keys:       []string{DefaultKey, "app.kubernetes.io/team"},
+		CodeOwners: co,
+		Namespaces: map[string]string{"loki": "loki-squad", "mimir": "mimir-namespace"},
+	}
+
+	tests := map[string]struct {
+		path string
+		req  costmodel.Requirements
+		exp  string
+	}{
+		"label": {
+			path: "flux/dev/mimir/Deployment-foo.yaml",
+			req:  costmodel.Requirements{Namespace: "mimir", Labels: map[string]string{"team": "label-team"}},
+			exp:  "label-team",
+		},
+		"second label key": {
+			req: costmodel.Requirements{Labels: map[string]string{"app.kubernetes.io/team": "other-team"}},
+			exp: "other-team",
+		},
+		"annotation": {
+			path: "flux/dev/mimir/Deployment-foo.yaml",
+			req:  costmodel.Requirements{Annotations: map[string]string{"team": "annotation-team"}},
+			exp:  "annotation-team",
+		},
+		"codeowners": {
+			path: "flux/dev/mimir/Deployment-foo.yaml",
+			req:  costmodel.Requirements{Namespace: "mimir"},
+			exp:  "@grafana/mimir-squad",
+		},
+		"namespace": {
+			path: "flux/dev/loki/Deployment-foo.yaml",
+			req:  costmodel.Requirements{Namespace: "loki"},
+			exp:  "loki-squad",
+		},
+		"unowned": {
+			path: "flux/dev/default/Deployment-foo.yaml",
+			req:  costmodel.Requirements{Namespace: "default"},
+			exp:  "",
+		},
+	}
+
+	for n, tt := range tests {
+		t.Run(n, func(t *testing.T) {
+			if got := r.Team(tt.path, tt.req); tt.exp != got {
+				t.Errorf("expecting team %q, got %q", tt.exp, got)
+			}
+		})
+	}
+}
+
+func TestLoadNamespaces(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "teams.yaml")
+	if err := os.WriteFile(p, []byte("loki: loki-squad\nmimir: mimir-squad\n"), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", p, err)
+	}
+
+	got, err := LoadNamespaces(p)
+	if err != nil {
+		t.Fatalf("unexpected error loading namespaces: %v", err)
+	}
+
+	exp := map[string]string{"loki": "loki-squad", "mimir": "mimir-squad"}
+	if !reflect.DeepEqual(exp, got) {
+		t.Errorf("expecting %v, got %v", exp, got)
+	}
+}
+
+func TestSlugAndMention(t *testing.T) {
+	tests := map[string]struct{ slug, mention string }{
+		"@grafana/platform-monitoring": {"platform-monitoring", "@grafana/platform-monitoring"},
+		"grafana/platform-monitoring":  {"platform-monitoring", "@grafana/platform-monitoring"},
+		"platform-monitoring":          {"platform-monitoring", "@grafana/platform-monitoring"},
+		"@alice":                       {"alice", "@alice"},
+		"alice@example.com":            {"alice@example.com", "alice@example.com"},
+	}
+
+	for team, exp := range tests {
+		if got := Slug(team); exp.slug != got {
+			t.Errorf("expecting slug %q for %q, got %q", exp.slug, team, got)
+		}
+		if got := Mention("grafana", team); exp.mention != got {
+			t.Errorf("expecting mention %q for %q, got %q", exp.mention, team, got)
+		}
+	}
+}
+
+func TestReviewers(t *testing.T) {
+	users, teams := Reviewers([]string{"@grafana/mimir", "@alice", "alice@example.com", "loki", "grafana/tempo", "@bob"})
+	if exp := []string{"alice", "bob"}; !reflect.DeepEqual(exp, users) {
+		t.Errorf("expecting users %v, got %v", exp, users)
+	}
+	if exp := []string{"mimir", "loki", "tempo"}; !reflect.DeepEqual(exp, teams) {
+		t.Errorf("expecting teams %v, got %v", exp, teams)
+	}
+}